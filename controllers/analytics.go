@@ -1,11 +1,7 @@
 package controllers
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"os"
+	"content-clock/tasks"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
@@ -19,6 +15,7 @@ type Post struct {
 
 type Connection struct {
 	ConnectionName string `db:"connection_name" json:"connection_name"`
+	ConnectionId   string `db:"connection_id" json:"connection_id"`
 	AccessToken    string `db:"access_token" json:"access_token"`
 }
 
@@ -40,25 +37,26 @@ func FetchPostsAnalytics(app *pocketbase.PocketBase) {
 
 	for _, post := range posts {
 		connection := Connection{}
-		err := app.DB().Select("connection_name", "access_token").From("connections").Where(dbx.NewExp("id = {:id}", dbx.Params{"id": post.Connection})).One(&connection)
+		err := app.DB().Select("connection_name", "connection_id", "access_token").From("connections").Where(dbx.NewExp("id = {:id}", dbx.Params{"id": post.Connection})).One(&connection)
 		if err != nil {
 			app.Logger().Error("Error in getting the connection", "error", err)
 		}
 
-		switch connection.ConnectionName {
-		case "facebook":
-			FetchFacebookAnalytics(app, post, connection)
-		case "linkedin":
-			FetchLinkedInPostAnalytics(app, post, connection)
-		case "instagram":
-			FetchInstagramPostAnalytics(app, post, connection)
-		case "mastodon":
-			FetchMastodonPostAnalytics(app, post, connection)
-		case "pinterest":
-			FetchPinterestPostAnalytics(app, post, connection)
-		default:
+		publisher, err := tasks.GetPublisher(connection.ConnectionName)
+		if err != nil {
 			app.Logger().Warn("Unsupported connection type", "type", connection.ConnectionName)
+			continue
+		}
+		if !publisher.Capabilities().Metrics {
+			continue
+		}
+
+		data, err := publisher.FetchMetrics(connection.ConnectionId, connection.AccessToken, post.PublishedPostId)
+		if err != nil {
+			app.Logger().Error("Error in fetching "+connection.ConnectionName+" analytics", "postId", post.Id, "error", err.Error())
+			continue
 		}
+		SaveUpdateAnalyticsData(app, post.Id, data)
 	}
 
 }
@@ -90,112 +88,3 @@ func SaveUpdateAnalyticsData(app *pocketbase.PocketBase, postId string, data str
 	}
 
 }
-
-func FetchFacebookAnalytics(app *pocketbase.PocketBase, post Post, connection Connection) {
-	url := fmt.Sprintf("https://graph.facebook.com/%s/insights?metric=post_impressions,post_reactions_like_total,post_reactions_love_total,post_reactions_wow_total&access_token=%s", post.PublishedPostId, connection.AccessToken)
-	method := "GET"
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-
-	if err != nil {
-		app.Logger().Error("Error in fetching facebook analytics", "error", err.Error())
-		return
-	}
-	res, err := client.Do(req)
-	if err != nil {
-		app.Logger().Error("Error in fetching facebook analytics", "error", err.Error())
-		return
-	}
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		app.Logger().Error("Error in fetching facebook analytics", "error", err.Error())
-		return
-	}
-	data := string(body)
-	SaveUpdateAnalyticsData(app, post.Id, data)
-
-}
-
-func FetchLinkedInPostAnalytics(app *pocketbase.PocketBase, post Post, connection Connection) {
-	url := fmt.Sprintf("https://api.linkedin.com/v2/socialActions/%s", post.PublishedPostId)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+connection.AccessToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		app.Logger().Error("Error in fetching linkedin analytics", "error", err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	data := string(body)
-	SaveUpdateAnalyticsData(app, post.Id, data)
-}
-
-func FetchInstagramPostAnalytics(app *pocketbase.PocketBase, post Post, connection Connection) {
-	url := fmt.Sprintf("https://graph.facebook.com/v19.0/%s/insights?metric=impressions,reach,engagement,saved&access_token=%s", post.PublishedPostId, connection.AccessToken)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		app.Logger().Error("Error in fetching instagram analytics", "error", err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	data := string(body)
-	SaveUpdateAnalyticsData(app, post.Id, data)
-}
-
-func FetchPinterestPostAnalytics(app *pocketbase.PocketBase, post Post, connection Connection) {
-	url := fmt.Sprintf("https://api.pinterest.com/v5/pins/%s/analytics", post.PublishedPostId)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+connection.AccessToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		app.Logger().Error("Error in fetching pinterest analytics", "error", err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	data := string(body)
-	SaveUpdateAnalyticsData(app, post.Id, data)
-}
-
-func FetchMastodonPostAnalytics(app *pocketbase.PocketBase, post Post, connection Connection) {
-	instanceBaseURL := os.Getenv("MASTODON_BASE_URL")
-
-	var result struct {
-		ID string `json:"id"`
-	}
-
-	err := json.Unmarshal([]byte(post.PublishedPostId), &result)
-	if err != nil {
-		fmt.Println("Error parsing JSON:", err)
-		return
-	}
-
-	url := fmt.Sprintf("%s/api/v1/statuses/%s", instanceBaseURL, result.ID)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+connection.AccessToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		app.Logger().Error("Error in fetching mastodon analytics", "error", err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	data := string(body)
-	SaveUpdateAnalyticsData(app, post.Id, data)
-}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"encoding/json"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Post statuses of the approval workflow:
+//
+//	draft -> pending_approval -> approved/scheduled -> sending -> published
+//	                         \-> rejected -> draft
+//
+// Connections with requires_approval only publish posts whose last review
+// decision is "approved".
+const (
+	PostStatusDraft           = "draft"
+	PostStatusPendingApproval = "pending_approval"
+	PostStatusApproved        = "approved"
+	PostStatusRejected        = "rejected"
+	PostStatusScheduled       = "scheduled"
+
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// statuses a client may set through the records API; the rest are owned by
+// the approval endpoints and the publisher
+var clientPostStatuses = []string{"", PostStatusDraft, PostStatusPendingApproval, PostStatusScheduled, "deleted"}
+
+// a change to any of these, or to the post's media, after approval sends the
+// post back for review
+var reviewedPostFields = []string{"title", "content", "link", "connection", "variants", "thread_parts"}
+
+type reviewRequest struct {
+	Comment string `json:"comment"`
+}
+
+func SetupApprovalRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.GET("/api/v1/approvals", func(e *core.RequestEvent) error {
+		GetPendingApprovals(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.POST("/api/v1/posts/{id}/approve", func(e *core.RequestEvent) error {
+		ReviewPost(e, app, ReviewApproved)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.POST("/api/v1/posts/{id}/reject", func(e *core.RequestEvent) error {
+		ReviewPost(e, app, ReviewRejected)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// SetupApprovalHooks enforces the workflow on posts written through the
+// records API. Internal saves (scheduler, queue, recovery) are not affected.
+func SetupApprovalHooks(app *pocketbase.PocketBase) {
+	app.OnRecordCreateRequest("posts").BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := applyApprovalRules(app, e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+	app.OnRecordUpdateRequest("posts").BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := applyApprovalRules(app, e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+
+	// the approval settings of a connection are not the post author's to
+	// change: connection owners pass the update rule, so without these a
+	// gated owner could switch the review off or approve their own posts
+	app.OnRecordCreateRequest("connections").BindFunc(func(e *core.RecordRequestEvent) error {
+		if !e.HasSuperuserAuth() {
+			applyNewConnectionApproval(app, e.Record)
+		} else if err := validateApprovers(e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+	app.OnRecordUpdateRequest("connections").BindFunc(func(e *core.RecordRequestEvent) error {
+		original := e.Record.Original()
+		if !canManageApprovals(e, original) {
+			e.Record.Set("requires_approval", original.GetBool("requires_approval"))
+			e.Record.Set("approvers", original.Get("approvers"))
+		}
+		if e.Record.GetBool("requires_approval") != original.GetBool("requires_approval") || e.Record.GetString("approvers") != original.GetString("approvers") {
+			if err := validateApprovers(e.Record); err != nil {
+				return err
+			}
+		}
+		return e.Next()
+	})
+}
+
+// validateApprovers rejects approval settings the owner could satisfy alone:
+// requires_approval needs at least one approver besides the owner.
+func validateApprovers(connection *core.Record) error {
+	if connection.GetBool("requires_approval") && !hasApprovers(connection) {
+		return apis.NewBadRequestError("requires_approval needs at least one approver other than the connection owner.", nil)
+	}
+	return nil
+}
+
+// canManageApprovals reports whether the caller may change a connection's
+// requires_approval and approvers: superusers, anyone while the connection
+// is not gated (or gated without an approver, so nobody could review), and
+// otherwise only those who may approve its posts.
+func canManageApprovals(e *core.RecordRequestEvent, connection *core.Record) bool {
+	if e.HasSuperuserAuth() || !connection.GetBool("requires_approval") || !hasApprovers(connection) {
+		return true
+	}
+	return e.Auth != nil && CanApprove(connection, e.Auth.Id)
+}
+
+// applyNewConnectionApproval sets the approval settings of a connection
+// created through the records API. They start off, unless the same account
+// is already connected with approval required, in which case the new record
+// takes over that gate instead of becoming a way around it.
+func applyNewConnectionApproval(app core.App, record *core.Record) {
+	record.Set("requires_approval", false)
+	record.Set("approvers", nil)
+
+	gated, err := app.FindFirstRecordByFilter(
+		"connections",
+		"connection_name = {:name} && connection_id = {:id} && requires_approval = true && deleted = ''",
+		dbx.Params{"name": record.GetString("connection_name"), "id": record.GetString("connection_id")},
+	)
+	if err != nil {
+		return
+	}
+	record.Set("requires_approval", true)
+	record.Set("approvers", gated.Get("approvers"))
+}
+
+func applyApprovalRules(app core.App, record *core.Record) error {
+	status := record.GetString("status")
+	original := record.Original()
+	if status != original.GetString("status") && !slices.Contains(clientPostStatuses, status) {
+		return apis.NewBadRequestError("Status "+status+" cannot be set directly.", nil)
+	}
+	// review fields are only written by the approve/reject endpoints
+	for _, field := range []string{"review_decision", "reviewed_by", "review_comment"} {
+		record.Set(field, original.GetString(field))
+	}
+	record.Set("reviewed_at", original.GetDateTime("reviewed_at"))
+
+	if !ConnectionRequiresApproval(app, record.GetString("connection")) {
+		return nil
+	}
+
+	if !record.IsNew() && record.GetString("review_decision") != "" && reviewedFieldsChanged(record) {
+		clearReview(record)
+		if status == PostStatusScheduled || status == PostStatusApproved {
+			status = PostStatusPendingApproval
+			record.Set("status", status)
+		}
+	}
+	if status == PostStatusPendingApproval && original.GetString("status") != PostStatusPendingApproval {
+		clearReview(record)
+	}
+	if status == PostStatusScheduled && record.GetString("review_decision") != ReviewApproved {
+		// the post goes into review instead of straight to the account
+		record.Set("status", PostStatusPendingApproval)
+	}
+	return nil
+}
+
+// ReviewPost records an approve or reject decision by a designated approver.
+func ReviewPost(e *core.RequestEvent, app *pocketbase.PocketBase, decision string) {
+	var body reviewRequest
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+			helpers.Error(e, "Invalid request body")
+			return
+		}
+	}
+
+	post, err := app.FindRecordById("posts", e.Request.PathValue("id"))
+	if err != nil || post.GetString("deleted") != "" {
+		helpers.Error(e, "Post not found")
+		return
+	}
+	connection, err := app.FindRecordById("connections", post.GetString("connection"))
+	if err != nil || !CanApprove(connection, e.Auth.Id) {
+		helpers.Error(e, "Post not found")
+		return
+	}
+	if post.GetString("status") != PostStatusPendingApproval {
+		helpers.Error(e, "Post is not waiting for approval")
+		return
+	}
+	if decision == ReviewRejected && body.Comment == "" {
+		helpers.Error(e, "A comment is required when rejecting a post")
+		return
+	}
+
+	post.Set("review_decision", decision)
+	post.Set("reviewed_by", e.Auth.Id)
+	post.Set("reviewed_at", types.NowDateTime())
+	post.Set("review_comment", body.Comment)
+	if decision == ReviewApproved {
+		if post.GetDateTime("publish_at").IsZero() {
+			post.Set("status", PostStatusApproved)
+		} else {
+			post.Set("status", PostStatusScheduled)
+		}
+	} else {
+		post.Set("status", PostStatusRejected)
+	}
+
+	if err := app.Save(post); err != nil {
+		app.Logger().Error("Failed to save review decision", "postId", post.Id, "decision", decision, "error", err.Error())
+		helpers.Error(e, "Failed to save review: "+err.Error())
+		return
+	}
+	app.Logger().Info("Post reviewed", "postId", post.Id, "decision", decision, "reviewer", e.Auth.Id)
+
+	helpers.Success(e, "Post "+decision, map[string]interface{}{
+		"id":              post.Id,
+		"status":          post.GetString("status"),
+		"review_decision": decision,
+		"reviewed_by":     e.Auth.Id,
+		"reviewed_at":     post.GetDateTime("reviewed_at"),
+		"review_comment":  body.Comment,
+	})
+}
+
+// GetPendingApprovals lists posts waiting for the current user's review.
+func GetPendingApprovals(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	connections, err := app.FindRecordsByFilter("connections", "requires_approval = true && deleted = ''", "", 0, 0)
+	if err != nil {
+		helpers.Error(e, "Failed to load connections")
+		return
+	}
+
+	posts := []*core.Record{}
+	for _, connection := range connections {
+		if !CanApprove(connection, e.Auth.Id) {
+			continue
+		}
+		pending, err := app.FindRecordsByFilter(
+			"posts",
+			"connection = {:connection} && status = {:status} && deleted = ''",
+			"publish_at",
+			0,
+			0,
+			dbx.Params{"connection": connection.Id, "status": PostStatusPendingApproval},
+		)
+		if err != nil {
+			helpers.Error(e, "Failed to load posts")
+			return
+		}
+		posts = append(posts, pending...)
+	}
+	helpers.Success(e, "", posts)
+}
+
+// ConnectionRequiresApproval reports whether posts to the connection need a
+// review before they can be published.
+func ConnectionRequiresApproval(app core.App, connectionId string) bool {
+	connection, err := app.FindRecordById("connections", connectionId)
+	if err != nil {
+		return false
+	}
+	return connection.GetBool("requires_approval")
+}
+
+// CanApprove reports whether userId may review posts for the connection: a
+// listed approver other than the owner. Owners never approve their own
+// posts, so a connection without other approvers has no reviewer.
+func CanApprove(connection *core.Record, userId string) bool {
+	return userId != connection.GetString("user") && slices.Contains(connectionApprovers(connection), userId)
+}
+
+// hasApprovers reports whether someone besides the owner may approve the
+// connection's posts.
+func hasApprovers(connection *core.Record) bool {
+	for _, approver := range connectionApprovers(connection) {
+		if approver != "" && approver != connection.GetString("user") {
+			return true
+		}
+	}
+	return false
+}
+
+func connectionApprovers(connection *core.Record) []string {
+	var approvers []string
+	_ = connection.UnmarshalJSONField("approvers", &approvers)
+	return approvers
+}
+
+// IsApproved reports whether the post's latest review approved it.
+func IsApproved(post *core.Record) bool {
+	return post.GetString("review_decision") == ReviewApproved
+}
+
+func reviewedFieldsChanged(record *core.Record) bool {
+	original := record.Original()
+	for _, field := range postFileFields {
+		if len(record.GetUnsavedFiles(field)) > 0 || !slices.Equal(record.GetStringSlice(field), original.GetStringSlice(field)) {
+			return true
+		}
+	}
+	for _, field := range reviewedPostFields {
+		if record.GetString(field) != original.GetString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+func clearReview(record *core.Record) {
+	record.Set("review_decision", "")
+	record.Set("reviewed_by", "")
+	record.Set("reviewed_at", "")
+	record.Set("review_comment", "")
+}
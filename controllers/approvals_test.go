@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"content-clock/models"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestApp bootstraps an app in a temporary data dir with the collections
+// created by DB_MIGRATE.
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+	t.Setenv("DB_MIGRATE", "1")
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	t.Cleanup(func() { _ = app.ResetBootstrapState() })
+	if err := models.MigrateCollectionsIfEnabled(app); err != nil {
+		t.Fatalf("MigrateCollectionsIfEnabled: %v", err)
+	}
+	return app
+}
+
+func saveTestRecord(t *testing.T, app core.App, collection string, fields map[string]any) *core.Record {
+	t.Helper()
+	c, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatalf("FindCollectionByNameOrId(%s): %v", collection, err)
+	}
+	record := core.NewRecord(c)
+	record.Load(fields)
+	if err := app.Save(record); err != nil {
+		t.Fatalf("save %s: %v", collection, err)
+	}
+	return record
+}
+
+// connectionRecord builds an unsaved connections record.
+func connectionRecord(fields map[string]any) *core.Record {
+	collection := core.NewBaseCollection("connections")
+	models.ApplyConnectionsCollectionSchema(collection)
+	record := core.NewRecord(collection)
+	record.Load(fields)
+	return record
+}
+
+func TestCanApprove(t *testing.T) {
+	connection := connectionRecord(map[string]any{"user": "owner", "approvers": []string{"owner", "editor"}})
+	unlisted := connectionRecord(map[string]any{"user": "owner"})
+
+	tests := []struct {
+		name       string
+		connection *core.Record
+		userId     string
+		want       bool
+	}{
+		{name: "listed approver", connection: connection, userId: "editor", want: true},
+		{name: "owner listed as approver", connection: connection, userId: "owner"},
+		{name: "someone else", connection: connection, userId: "stranger"},
+		{name: "owner without approvers", connection: unlisted, userId: "owner"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanApprove(tt.connection, tt.userId); got != tt.want {
+				t.Fatalf("CanApprove(%s) = %v, want %v", tt.userId, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateApprovers(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]any
+		wantFail bool
+	}{
+		{name: "approval off", fields: map[string]any{"user": "owner"}},
+		{name: "another approver", fields: map[string]any{"user": "owner", "requires_approval": true, "approvers": []string{"editor"}}},
+		{name: "no approvers", fields: map[string]any{"user": "owner", "requires_approval": true}, wantFail: true},
+		{name: "only the owner", fields: map[string]any{"user": "owner", "requires_approval": true, "approvers": []string{"owner"}}, wantFail: true},
+		{name: "blank approver", fields: map[string]any{"user": "owner", "requires_approval": true, "approvers": []string{""}}, wantFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateApprovers(connectionRecord(tt.fields)); (err != nil) != tt.wantFail {
+				t.Fatalf("validateApprovers error = %v, want failure %v", err, tt.wantFail)
+			}
+		})
+	}
+}
+
+func TestApplyApprovalRules(t *testing.T) {
+	app := newTestApp(t)
+	gated := saveTestRecord(t, app, "connections", map[string]any{"user": "owner", "requires_approval": true, "approvers": []string{"editor"}})
+	open := saveTestRecord(t, app, "connections", map[string]any{"user": "owner"})
+
+	newPost := func(connection *core.Record, status string) *core.Record {
+		posts, _ := app.FindCollectionByNameOrId("posts")
+		record := core.NewRecord(posts)
+		record.Load(map[string]any{"user": "owner", "connection": connection.Id, "content": "hello", "status": status})
+		return record
+	}
+	// savedPost stores a post as the approve endpoint leaves it and reloads
+	// it, so the record under test has its stored state as Original()
+	savedPost := func(status string, decision string) *core.Record {
+		record := newPost(gated, status)
+		record.Set("review_decision", decision)
+		record.Set("reviewed_by", "editor")
+		if err := app.Save(record); err != nil {
+			t.Fatalf("save post: %v", err)
+		}
+		reloaded, err := app.FindRecordById("posts", record.Id)
+		if err != nil {
+			t.Fatalf("reload post: %v", err)
+		}
+		return reloaded
+	}
+
+	tests := []struct {
+		name         string
+		post         func() *core.Record
+		wantErr      bool
+		wantStatus   string
+		wantDecision string
+	}{
+		{
+			name:       "scheduling on a gated connection asks for review",
+			post:       func() *core.Record { return newPost(gated, PostStatusScheduled) },
+			wantStatus: PostStatusPendingApproval,
+		},
+		{
+			name:       "ungated connection schedules directly",
+			post:       func() *core.Record { return newPost(open, PostStatusScheduled) },
+			wantStatus: PostStatusScheduled,
+		},
+		{
+			name:       "drafts stay drafts",
+			post:       func() *core.Record { return newPost(gated, PostStatusDraft) },
+			wantStatus: PostStatusDraft,
+		},
+		{
+			name:    "publisher statuses cannot be set",
+			post:    func() *core.Record { return newPost(gated, "published") },
+			wantErr: true,
+		},
+		{
+			name:    "approving through the records API",
+			post:    func() *core.Record { return newPost(gated, PostStatusApproved) },
+			wantErr: true,
+		},
+		{
+			name: "clients cannot write the review decision",
+			post: func() *core.Record {
+				record := newPost(gated, PostStatusScheduled)
+				record.Set("review_decision", ReviewApproved)
+				return record
+			},
+			wantStatus: PostStatusPendingApproval,
+		},
+		{
+			name: "editing an approved post sends it back",
+			post: func() *core.Record {
+				record := savedPost(PostStatusScheduled, ReviewApproved)
+				record.Set("content", "hello, edited")
+				return record
+			},
+			wantStatus: PostStatusPendingApproval,
+		},
+		{
+			name: "approved post keeps its review when untouched",
+			post: func() *core.Record {
+				record := savedPost(PostStatusScheduled, ReviewApproved)
+				record.Set("publish_at", "2030-01-01 09:00:00.000Z")
+				return record
+			},
+			wantStatus:   PostStatusScheduled,
+			wantDecision: ReviewApproved,
+		},
+		{
+			name: "resubmitting a rejected post clears the rejection",
+			post: func() *core.Record {
+				record := savedPost(PostStatusDraft, ReviewRejected)
+				record.Set("status", PostStatusPendingApproval)
+				return record
+			},
+			wantStatus: PostStatusPendingApproval,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tt.post()
+			err := applyApprovalRules(app, record)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyApprovalRules accepted status %q", record.GetString("status"))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyApprovalRules: %v", err)
+			}
+			if got := record.GetString("status"); got != tt.wantStatus {
+				t.Fatalf("status = %q, want %q", got, tt.wantStatus)
+			}
+			if got := record.GetString("review_decision"); got != tt.wantDecision {
+				t.Fatalf("review_decision = %q, want %q", got, tt.wantDecision)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"content-clock/tasks"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// oauthCallbackRoute reports whether path is an OAuth callback route. The
+// provider redirects the browser to it, so it cannot carry a PocketBase
+// token; the sealed state names the user who started the flow instead.
+func oauthCallbackRoute(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/auth/") && strings.HasSuffix(path, "/callback")
+}
+
+// RequireAPIAuth rejects /api/v1 requests without a valid PocketBase auth
+// token, except the OAuth callbacks. Handlers take the owning user from
+// e.Auth, never from the request.
+func RequireAPIAuth() *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id: "contentClockRequireAPIAuth",
+		Func: func(e *core.RequestEvent) error {
+			path := e.Request.URL.Path
+			if !strings.HasPrefix(path, "/api/v1/") || oauthCallbackRoute(path) {
+				return e.Next()
+			}
+			if e.Auth == nil {
+				return e.UnauthorizedError("The request requires valid record authorization token.", nil)
+			}
+			return e.Next()
+		},
+	}
+}
+
+// redirectWithHandoff ends an OAuth callback: the tokens stay on the server
+// and the frontend's connect page only gets a one-time code, redeemable by
+// the user who started the flow, to pass to the platform's add-*-pages
+// endpoint.
+func redirectWithHandoff(e *core.RequestEvent, app *pocketbase.PocketBase, flow oauthFlow, handoff tasks.OAuthHandoff) {
+	code, err := tasks.CreateHandoff(app, flow.Platform, flow.User, handoff)
+	if err != nil {
+		app.Logger().Error("Failed to store OAuth handoff", "platform", flow.Platform, "error", err.Error())
+		redirectWithError(e, flow.Platform, "Failed to complete the connection")
+		return
+	}
+	e.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/connect/%s?code=%s", os.Getenv("REDIRECT_HOST"), flow.Platform, url.QueryEscape(code)))
+}
+
+// redirectWithError ends a failed OAuth callback. The provider sent the
+// browser here, so instead of a JSON error the user goes back to the
+// frontend's connect page, which shows the message.
+func redirectWithError(e *core.RequestEvent, platform string, message string) {
+	e.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/connect/%s?error=%s", os.Getenv("REDIRECT_HOST"), platform, url.QueryEscape(message)))
+}
+
+// redeemHandoff returns the bundle for the code query parameter of an
+// add-*-pages request. On failure it has already written the response.
+func redeemHandoff(e *core.RequestEvent, app *pocketbase.PocketBase, platform string) (tasks.OAuthHandoff, bool) {
+	handoff, err := tasks.RedeemHandoff(app, platform, e.Auth.Id, e.Request.URL.Query().Get("code"))
+	if errors.Is(err, tasks.ErrHandoffInvalid) {
+		helpers.Error(e, err.Error())
+		return handoff, false
+	}
+	if err != nil {
+		app.Logger().Error("Failed to redeem OAuth handoff", "platform", platform, "error", err.Error())
+		helpers.Error(e, "Failed to complete the connection")
+		return handoff, false
+	}
+	return handoff, true
+}
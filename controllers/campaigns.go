@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Campaign statuses, computed from the statuses of its targets.
+const (
+	CampaignStatusDraft           = "draft"
+	CampaignStatusScheduled       = "scheduled"
+	CampaignStatusPublishing      = "publishing"
+	CampaignStatusPublished       = "published"
+	CampaignStatusPartiallyFailed = "partially_failed"
+	CampaignStatusFailed          = "failed"
+)
+
+// campaign fields owned by the status aggregation
+var computedCampaignFields = []string{"status", "summary", "target_count", "published_count", "failed_count"}
+
+// targets that have not been handed to the publisher yet follow changes to
+// the campaign's publish_at
+var unsentPostStatuses = []string{PostStatusDraft, PostStatusPendingApproval, PostStatusApproved, PostStatusScheduled}
+
+// campaignTarget is one connection of a campaign. Empty text fields use the
+// campaign's; images lists which campaign images to attach (all when
+// omitted, none for []).
+type campaignTarget struct {
+	Connection     string   `json:"connection"`
+	Title          string   `json:"title"`
+	Content        string   `json:"content"`
+	Link           string   `json:"link"`
+	Images         []string `json:"images"`
+	PublishAt      string   `json:"publish_at"`
+	PublishAtLocal string   `json:"publish_at_local"`
+}
+
+type addCampaignTargetsRequest struct {
+	Targets []campaignTarget `json:"targets"`
+	// draft or scheduled; defaults to scheduled when the target has a time
+	Status string `json:"status"`
+}
+
+func SetupCampaignRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.GET("/api/v1/campaigns/{id}/targets", func(e *core.RequestEvent) error {
+		GetCampaignTargets(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.POST("/api/v1/campaigns/{id}/targets", func(e *core.RequestEvent) error {
+		AddCampaignTargets(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.POST("/api/v1/campaigns/{id}/retry-failed", func(e *core.RequestEvent) error {
+		RetryFailedCampaignTargets(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// SetupCampaignHooks keeps campaign statuses in sync with their targets and
+// carries campaign schedule changes and deletes over to unsent targets.
+func SetupCampaignHooks(app *pocketbase.PocketBase) {
+	app.OnRecordCreateRequest("campaigns").BindFunc(func(e *core.RecordRequestEvent) error {
+		for _, field := range computedCampaignFields {
+			e.Record.Set(field, nil)
+		}
+		e.Record.Set("status", CampaignStatusDraft)
+		return e.Next()
+	})
+	app.OnRecordUpdateRequest("campaigns").BindFunc(func(e *core.RecordRequestEvent) error {
+		original := e.Record.Original()
+		for _, field := range computedCampaignFields {
+			e.Record.Set(field, original.Get(field))
+		}
+		return e.Next()
+	})
+
+	validateTimezone := func(e *core.RecordEvent) error {
+		if !helpers.ValidTimezone(e.Record.GetString("timezone")) {
+			return apis.NewBadRequestError("Unknown timezone "+e.Record.GetString("timezone")+".", nil)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("campaigns").BindFunc(validateTimezone)
+	app.OnRecordUpdate("campaigns").BindFunc(validateTimezone)
+
+	app.OnRecordUpdate("campaigns").BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+		previousPublishAt := original.GetDateTime("publish_at")
+		wasDeleted := original.GetString("deleted") != ""
+		if err := e.Next(); err != nil {
+			return err
+		}
+		if !wasDeleted && e.Record.GetString("deleted") != "" {
+			return deleteUnsentTargets(e.App, e.Record)
+		}
+		if publishAt := e.Record.GetDateTime("publish_at"); !publishAt.Equal(previousPublishAt) && !publishAt.IsZero() {
+			return moveUnsentTargets(e.App, e.Record, previousPublishAt, publishAt)
+		}
+		return nil
+	})
+	app.OnRecordDelete("campaigns").BindFunc(func(e *core.RecordEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+		return deleteUnsentTargets(e.App, e.Record)
+	})
+
+	// a post joins a campaign when it is created and stays in it
+	app.OnRecordCreateRequest("posts").BindFunc(func(e *core.RecordRequestEvent) error {
+		campaignId := e.Record.GetString("campaign")
+		if campaignId == "" {
+			return e.Next()
+		}
+		campaign, err := app.FindRecordById("campaigns", campaignId)
+		if err != nil || campaign.GetString("user") != e.Record.GetString("user") || campaign.GetString("deleted") != "" {
+			return apis.NewBadRequestError("Campaign not found.", nil)
+		}
+		return e.Next()
+	})
+	app.OnRecordUpdateRequest("posts").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.Set("campaign", e.Record.Original().GetString("campaign"))
+		return e.Next()
+	})
+
+	refresh := func(e *core.RecordEvent) error {
+		if campaignId := e.Record.GetString("campaign"); campaignId != "" {
+			if err := RefreshCampaignStatus(app, campaignId); err != nil {
+				app.Logger().Error("Failed to refresh campaign status", "campaignId", campaignId, "postId", e.Record.Id, "error", err.Error())
+			}
+		}
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess("posts").BindFunc(refresh)
+	app.OnRecordAfterUpdateSuccess("posts").BindFunc(refresh)
+	app.OnRecordAfterDeleteSuccess("posts").BindFunc(refresh)
+}
+
+// GetCampaignTargets returns a campaign with its targets.
+func GetCampaignTargets(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	campaign, ok := findCampaign(e, app)
+	if !ok {
+		return
+	}
+	targets, err := campaignTargets(app, campaign.Id, "")
+	if err != nil {
+		helpers.Error(e, "Failed to load campaign targets")
+		return
+	}
+	helpers.Success(e, "", map[string]interface{}{
+		"campaign": campaign,
+		"targets":  targets,
+	})
+}
+
+// AddCampaignTargets creates one post per connection, using the campaign's
+// content and media unless the target overrides them.
+func AddCampaignTargets(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	var body addCampaignTargetsRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+		helpers.Error(e, "Invalid request body")
+		return
+	}
+	if len(body.Targets) == 0 {
+		helpers.Error(e, "At least one target is required")
+		return
+	}
+	if body.Status != "" && body.Status != PostStatusDraft && body.Status != PostStatusScheduled {
+		helpers.Error(e, "status must be draft or scheduled")
+		return
+	}
+
+	campaign, ok := findCampaign(e, app)
+	if !ok {
+		return
+	}
+	existing, err := campaignTargets(app, campaign.Id, "")
+	if err != nil {
+		helpers.Error(e, "Failed to load campaign targets")
+		return
+	}
+	connections := make([]string, 0, len(existing)+len(body.Targets))
+	for _, target := range existing {
+		connections = append(connections, target.GetString("connection"))
+	}
+	for _, target := range body.Targets {
+		if slices.Contains(connections, target.Connection) {
+			helpers.Error(e, "Connection "+target.Connection+" is already a target of this campaign")
+			return
+		}
+		connection, err := app.FindRecordById("connections", target.Connection)
+		if err != nil || connection.GetString("user") != e.Auth.Id || connection.GetString("deleted") != "" {
+			helpers.Error(e, "Connection "+target.Connection+" not found")
+			return
+		}
+		connections = append(connections, target.Connection)
+	}
+
+	posts, err := app.FindCollectionByNameOrId("posts")
+	if err != nil {
+		helpers.Error(e, "Failed to load posts collection")
+		return
+	}
+	created := make([]*core.Record, 0, len(body.Targets))
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, target := range body.Targets {
+			post, err := newCampaignTarget(app, posts, campaign, target, body.Status)
+			if err != nil {
+				return fmt.Errorf("connection %s: %w", target.Connection, err)
+			}
+			if err := txApp.Save(post); err != nil {
+				return fmt.Errorf("connection %s: %w", target.Connection, err)
+			}
+			created = append(created, post)
+		}
+		return nil
+	})
+	if err != nil {
+		helpers.Error(e, "Failed to add campaign targets: "+err.Error())
+		return
+	}
+	app.Logger().Info("Campaign targets added", "campaignId", campaign.Id, "targets", len(created), "user", e.Auth.Id)
+
+	if refreshed, err := app.FindRecordById("campaigns", campaign.Id); err == nil {
+		campaign = refreshed
+	}
+	helpers.Success(e, "Campaign targets added", map[string]interface{}{
+		"campaign": campaign,
+		"targets":  created,
+	})
+}
+
+// RetryFailedCampaignTargets puts only the failed targets of a campaign back
+// in the schedule; published and pending targets are left alone.
+func RetryFailedCampaignTargets(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	campaign, ok := findCampaign(e, app)
+	if !ok {
+		return
+	}
+	failed, err := campaignTargets(app, campaign.Id, PostStatusFailed)
+	if err != nil {
+		helpers.Error(e, "Failed to load campaign targets")
+		return
+	}
+
+	retried := []string{}
+	errs := map[string]string{}
+	now := time.Now()
+	for _, post := range failed {
+		if err := requeuePost(app, post, now, ""); err != nil {
+			errs[post.Id] = err.Error()
+			continue
+		}
+		retried = append(retried, post.Id)
+	}
+	app.Logger().Info("Failed campaign targets retried", "campaignId", campaign.Id, "user", e.Auth.Id, "retried", len(retried), "failed", len(errs))
+
+	helpers.Success(e, "", map[string]interface{}{
+		"retried": retried,
+		"errors":  errs,
+	})
+}
+
+// RefreshCampaignStatus recomputes a campaign's status, summary and counts
+// from its targets, e.g. "partially_failed" with summary "partially failed 2/7".
+func RefreshCampaignStatus(app core.App, campaignId string) error {
+	campaign, err := app.FindRecordById("campaigns", campaignId)
+	if err != nil {
+		return nil
+	}
+	targets, err := campaignTargets(app, campaignId, "")
+	if err != nil {
+		return err
+	}
+
+	total := len(targets)
+	published, failed, sending, drafts := 0, 0, 0, 0
+	for _, target := range targets {
+		switch target.GetString("status") {
+		case "published":
+			published++
+		case PostStatusFailed:
+			failed++
+		case "sending", "retrying":
+			sending++
+		case PostStatusDraft, PostStatusRejected, "":
+			drafts++
+		}
+	}
+
+	status := CampaignStatusScheduled
+	count := published
+	switch {
+	case total == 0 || drafts == total:
+		status = CampaignStatusDraft
+	case published == total:
+		status = CampaignStatusPublished
+	case failed == total:
+		status, count = CampaignStatusFailed, failed
+	case failed > 0:
+		status, count = CampaignStatusPartiallyFailed, failed
+	case published > 0 || sending > 0:
+		status = CampaignStatusPublishing
+	}
+	summary := fmt.Sprintf("%s %d/%d", strings.ReplaceAll(status, "_", " "), count, total)
+
+	if campaign.GetString("summary") == summary && campaign.GetString("status") == status {
+		return nil
+	}
+	campaign.Set("status", status)
+	campaign.Set("summary", summary)
+	campaign.Set("target_count", total)
+	campaign.Set("published_count", published)
+	campaign.Set("failed_count", failed)
+	return app.Save(campaign)
+}
+
+func findCampaign(e *core.RequestEvent, app *pocketbase.PocketBase) (*core.Record, bool) {
+	campaign, err := app.FindRecordById("campaigns", e.Request.PathValue("id"))
+	if err != nil || campaign.GetString("user") != e.Auth.Id || campaign.GetString("deleted") != "" {
+		helpers.Error(e, "Campaign not found")
+		return nil, false
+	}
+	return campaign, true
+}
+
+// campaignTargets lists the campaign's posts that are not deleted, optionally
+// only those with the given status.
+func campaignTargets(app core.App, campaignId string, status string) ([]*core.Record, error) {
+	filter := "campaign = {:campaign} && deleted = '' && status != 'deleted'"
+	params := dbx.Params{"campaign": campaignId}
+	if status != "" {
+		filter += " && status = {:status}"
+		params["status"] = status
+	}
+	return app.FindRecordsByFilter("posts", filter, "created", 0, 0, params)
+}
+
+func newCampaignTarget(app *pocketbase.PocketBase, posts *core.Collection, campaign *core.Record, target campaignTarget, status string) (*core.Record, error) {
+	post := core.NewRecord(posts)
+	post.Set("campaign", campaign.Id)
+	post.Set("user", campaign.GetString("user"))
+	post.Set("connection", target.Connection)
+	post.Set("timezone", campaign.GetString("timezone"))
+	for field, variant := range map[string]string{"title": target.Title, "content": target.Content, "link": target.Link} {
+		if variant == "" {
+			variant = campaign.GetString(field)
+		}
+		post.Set(field, variant)
+	}
+
+	switch {
+	case target.PublishAtLocal != "":
+		post.Set("publish_at_local", target.PublishAtLocal)
+	case target.PublishAt != "":
+		publishAt, err := types.ParseDateTime(target.PublishAt)
+		if err != nil || publishAt.IsZero() {
+			return nil, fmt.Errorf("invalid publish_at")
+		}
+		post.Set("publish_at", publishAt)
+	default:
+		post.Set("publish_at", campaign.GetDateTime("publish_at"))
+	}
+
+	if status == "" {
+		status = PostStatusDraft
+		if target.PublishAtLocal != "" || !post.GetDateTime("publish_at").IsZero() {
+			status = PostStatusScheduled
+		}
+	}
+	post.Set("status", status)
+
+	images := campaign.GetStringSlice("images")
+	if target.Images != nil {
+		for _, name := range target.Images {
+			if !slices.Contains(images, name) {
+				return nil, fmt.Errorf("image %s is not part of the campaign", name)
+			}
+		}
+		images = target.Images
+	}
+	if len(images) > 0 {
+		files, err := copyPostFiles(app, campaign, images)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy media: %w", err)
+		}
+		post.Set("images", files)
+	}
+
+	// the same review rules as a post scheduled through the records API
+	if err := applyApprovalRules(app, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func moveUnsentTargets(app core.App, campaign *core.Record, from types.DateTime, to types.DateTime) error {
+	targets, err := campaignTargets(app, campaign.Id, "")
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if !slices.Contains(unsentPostStatuses, target.GetString("status")) || !target.GetDateTime("publish_at").Equal(from) {
+			continue
+		}
+		target.Set("publish_at", to)
+		if err := app.Save(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUnsentTargets soft deletes the targets of a deleted campaign that
+// have not been published yet, so they are not sent on their own.
+func deleteUnsentTargets(app core.App, campaign *core.Record) error {
+	targets, err := campaignTargets(app, campaign.Id, "")
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if !slices.Contains(unsentPostStatuses, target.GetString("status")) && target.GetString("status") != PostStatusPaused {
+			continue
+		}
+		target.Set("deleted", types.NowDateTime())
+		if err := app.Save(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
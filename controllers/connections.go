@@ -3,17 +3,43 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
 	"fmt"
+	"time"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 type ConnectionResult struct {
 	ID string `db:"id"`
 }
 
+// expiryTime is the expires_at of a token that expires in expiresIn seconds;
+// nil when it does not expire.
+func expiryTime(expiresIn int64) *time.Time {
+	expiresAt := tasks.TokenExpiry(expiresIn)
+	if expiresAt.IsZero() {
+		return nil
+	}
+	return &expiresAt
+}
+
+// longLivedUserToken exchanges a Facebook login token for a long-lived one so
+// the page tokens read with it do not expire. On failure the short-lived
+// token is used as before.
+func longLivedUserToken(app *pocketbase.PocketBase, accessToken string) string {
+	grant, err := tasks.ExchangeFacebookToken(app, accessToken)
+	if err != nil {
+		app.Logger().Warn("Failed to exchange for a long-lived Facebook token; page tokens will expire", "error", err.Error())
+		return accessToken
+	}
+	return grant.AccessToken
+}
+
 func AddNewConnection(app *pocketbase.PocketBase, connection *models.Connections) error {
 	if err := EnsureTables(app, "connections"); err != nil {
 		app.Logger().Error("Schema check failed", "error", err.Error())
@@ -37,21 +63,37 @@ func AddNewConnection(app *pocketbase.PocketBase, connection *models.Connections
 
 	if isConnection.ID != "" {
 		app.Logger().Info("Connection already exists", "id", isConnection.ID)
-		return nil
+		return reconnectConnection(app, isConnection.ID, connection)
 	}
 
-	result, err := app.DB().Insert("connections", dbx.Params{
+	accessToken, err := tasks.EncryptToken(connection.AccessToken)
+	if err != nil {
+		app.Logger().Error("Failed to encrypt connection token", "error", err.Error())
+		return err
+	}
+	refreshToken, err := tasks.EncryptToken(connection.RefreshToken)
+	if err != nil {
+		app.Logger().Error("Failed to encrypt connection token", "error", err.Error())
+		return err
+	}
+	params := dbx.Params{
 		"name":              connection.Name,
 		"username":          connection.Username,
 		"connection_name":   connection.ConnectionName,
 		"connection_id":     connection.ConnectionId,
-		"access_token":      connection.AccessToken,
-		"refresh_token":     connection.RefreshToken,
+		"access_token":      accessToken,
+		"refresh_token":     refreshToken,
 		"meta_data":         connection.MetaData,
 		"timezone":          connection.Timezone,
 		"user":              connection.UserId,
 		"profile_image_url": connection.ProfileImage,
-	}).Execute()
+	}
+	if connection.ExpiresAt != nil {
+		expiresAt, _ := types.ParseDateTime(*connection.ExpiresAt)
+		params["expires_at"] = expiresAt.String()
+		params["token_refreshed_at"] = types.NowDateTime().String()
+	}
+	result, err := app.DB().Insert("connections", params).Execute()
 
 	if err != nil {
 		app.Logger().Error("Error inserting new connection", "error", err.Error())
@@ -119,3 +161,51 @@ func AddNewConnection(app *pocketbase.PocketBase, connection *models.Connections
 	return nil
 
 }
+
+// reconnectConnection stores the fresh tokens and expiry of an account that
+// was connected again and clears any health flag and refresh error set by
+// earlier failures.
+func reconnectConnection(app *pocketbase.PocketBase, id string, connection *models.Connections) error {
+	record, err := app.FindRecordById("connections", id)
+	if err != nil {
+		return err
+	}
+	// plain tokens are encrypted by the connections save hook
+	record.Set("access_token", connection.AccessToken)
+	if connection.RefreshToken != "" {
+		record.Set("refresh_token", connection.RefreshToken)
+	}
+	if connection.ExpiresAt != nil {
+		record.Set("expires_at", *connection.ExpiresAt)
+	} else {
+		record.Set("expires_at", "")
+	}
+	record.Set("token_refreshed_at", types.NowDateTime())
+	record.Set("token_refresh_error", "")
+	record.Set("token_refresh_failed_at", "")
+	record.Set("health", tasks.ConnectionHealthOK)
+	record.Set("health_error", "")
+	record.Set("health_checked_at", types.NowDateTime())
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Error updating reconnected connection", "id", id, "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// SetupConnectionHooks encrypts tokens written through record saves (reconnects,
+// the admin UI, the records API) the same way AddNewConnection does.
+func SetupConnectionHooks(app *pocketbase.PocketBase) {
+	encryptTokens := func(e *core.RecordEvent) error {
+		for _, field := range []string{"access_token", "refresh_token"} {
+			encrypted, err := tasks.EncryptToken(e.Record.GetString(field))
+			if err != nil {
+				return fmt.Errorf("failed to encrypt %s: %w", field, err)
+			}
+			e.Record.Set(field, encrypted)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("connections").BindFunc(encryptTokens)
+	app.OnRecordUpdate("connections").BindFunc(encryptTokens)
+}
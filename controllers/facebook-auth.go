@@ -3,15 +3,17 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"os"
 
-	"github.com/markbates/goth"
-	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/facebook"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/oauth2"
 )
 
 type Response struct {
@@ -60,7 +62,7 @@ func SetupFacebookRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 		return nil
 	})
 	se.Router.GET("/api/v1/auth/facebook/callback", func(e *core.RequestEvent) error {
-		FacebookOAuthCallback(e)
+		FacebookOAuthCallback(e, app)
 		return nil
 	})
 	se.Router.GET("/api/v1/add-facebook-pages", func(e *core.RequestEvent) error {
@@ -70,46 +72,95 @@ func SetupFacebookRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 }
 
 func BeginFacebookAuth(e *core.RequestEvent) {
-	var apiHost string = os.Getenv("API_HOST")
-	var fbAppId string = os.Getenv("FACEBOOK_APP_ID")
-	var fbAppSecret string = os.Getenv("FACEBOOK_SECRET")
-	if fbAppId == "" || fbAppSecret == "" {
-		helpers.Error(e, "Facebook App ID or Secret is not set")
+	beginFacebookLogin(e, "facebook", FacebookOAuthScopes())
+}
+
+func FacebookOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	flow, handoff, ok := completeFacebookLogin(e, app, "facebook", FacebookOAuthScopes())
+	if !ok {
 		return
 	}
-	scopes := FacebookOAuthScopes()
-	goth.UseProviders(facebook.New(fbAppId, fbAppSecret, apiHost+"/api/v1/auth/facebook/callback", scopes...))
-	q := e.Request.URL.Query()
-	q.Add("provider", "facebook")
-	e.Request.URL.RawQuery = q.Encode()
-	gothic.BeginAuthHandler(e.Response, e.Request)
+	redirectWithHandoff(e, app, flow, handoff)
+}
+
+// facebookEndpoint is Facebook Login on the Graph API version the
+// publishers use.
+var facebookEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://www.facebook.com/v19.0/dialog/oauth",
+	TokenURL: "https://graph.facebook.com/v19.0/oauth/access_token",
+}
+
+// facebookOAuthConfig is the Facebook Login app shared by the facebook and
+// instagram flows; they differ in callback and scopes.
+func facebookOAuthConfig(platform string, scopes []string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("FACEBOOK_APP_ID"),
+		ClientSecret: os.Getenv("FACEBOOK_SECRET"),
+		RedirectURL:  os.Getenv("API_HOST") + "/api/v1/auth/" + platform + "/callback",
+		Scopes:       scopes,
+		Endpoint:     facebookEndpoint,
+	}
 }
 
-func FacebookOAuthCallback(e *core.RequestEvent) {
-	// Complete the user authentication
-	user, err := gothic.CompleteUserAuth(e.Response, e.Request)
+func beginFacebookLogin(e *core.RequestEvent, platform string, scopes []string) {
+	if os.Getenv("FACEBOOK_APP_ID") == "" || os.Getenv("FACEBOOK_SECRET") == "" {
+		helpers.Error(e, "Facebook App ID or Secret is not set")
+		return
+	}
+	flow, err := newOAuthFlow(e, platform, false)
 	if err != nil {
-		e.Response.WriteHeader(http.StatusInternalServerError)
+		helpers.Error(e, err.Error())
 		return
 	}
+	startOAuth(e, facebookOAuthConfig(platform, scopes).AuthCodeURL(flow.State, flow.AuthCodeOptions()...))
+}
 
-	accessToken := user.AccessToken
-	userId := user.UserID
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-	e.Redirect(http.StatusTemporaryRedirect, redirectHost+"/connect/facebook?accessToken="+accessToken+"&userId="+userId)
-	return
+// completeFacebookLogin checks the state of a facebook or instagram callback,
+// exchanges the code and reads the id of the Facebook user who logged in.
+// On failure it has already written the response.
+func completeFacebookLogin(e *core.RequestEvent, app *pocketbase.PocketBase, platform string, scopes []string) (oauthFlow, tasks.OAuthHandoff, bool) {
+	flow, err := finishOAuthFlow(e, platform)
+	if err != nil {
+		redirectWithError(e, platform, err.Error())
+		return flow, tasks.OAuthHandoff{}, false
+	}
+	token, err := facebookOAuthConfig(platform, scopes).Exchange(context.Background(), e.Request.URL.Query().Get("code"), flow.ExchangeOptions()...)
+	if err != nil {
+		app.Logger().Error("Failed to exchange Facebook token", "platform", platform, "error", err.Error())
+		redirectWithError(e, platform, "Failed to exchange token")
+		return flow, tasks.OAuthHandoff{}, false
+	}
+
+	params := url.Values{"fields": {"id"}, "access_token": {token.AccessToken}}
+	me, err := helpers.MakeHTTPRequest[struct {
+		ID string `json:"id"`
+	}](app, "GET", "https://graph.facebook.com/v19.0/me", nil, params, nil)
+	if err != nil || me.ID == "" {
+		if err == nil {
+			err = errors.New("response has no id")
+		}
+		app.Logger().Error("Failed to read Facebook user", "platform", platform, "error", err.Error())
+		redirectWithError(e, platform, "Failed to read Facebook user")
+		return flow, tasks.OAuthHandoff{}, false
+	}
+	return flow, tasks.OAuthHandoff{AccessToken: token.AccessToken, AccountId: me.ID}, true
 }
 
 func AddFacebookPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 
-	userId := e.Request.URL.Query().Get("fbUserId")
-	accessToken := e.Request.URL.Query().Get("accessToken")
-	authUserId := e.Request.URL.Query().Get("userId")
+	handoff, ok := redeemHandoff(e, app, "facebook")
+	if !ok {
+		return
+	}
+	userId := handoff.AccountId
+	accessToken := handoff.AccessToken
+	authUserId := e.Auth.Id
 
 	if userId == "" || accessToken == "" || authUserId == "" {
 		helpers.Error(e, "Missing required parameters")
 		return
 	}
+	accessToken = longLivedUserToken(app, accessToken)
 
 	resp, err := http.Get("https://graph.facebook.com/" + userId + "/accounts?fields=picture,name,access_token&access_token=" + accessToken)
 	if err != nil {
@@ -133,8 +184,10 @@ func AddFacebookPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 	}
 
 	for _, data := range response.Data {
-
-		jsonData, err := json.Marshal(data)
+		// the page token is stored encrypted in access_token, keep it out of meta_data
+		pageInfo := data
+		pageInfo.AccessToken = ""
+		jsonData, err := json.Marshal(pageInfo)
 		if err != nil {
 			app.Logger().Error("Failed to marshal Facebook page data: " + err.Error())
 			helpers.Error(e, err.Error())
@@ -5,11 +5,7 @@ import (
 	"content-clock/models"
 	"encoding/json"
 	"net/http"
-	"os"
 
-	"github.com/markbates/goth"
-	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/facebook"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -30,61 +26,16 @@ func SetupInstagramRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 }
 
 func BeginInstagramAuth(e *core.RequestEvent) {
-	var apiHost string = os.Getenv("API_HOST")
-	var fbAppId string = os.Getenv("FACEBOOK_APP_ID")
-	var fbAppSecret string = os.Getenv("FACEBOOK_SECRET")
-
-	if fbAppId == "" || fbAppSecret == "" {
-		helpers.Error(e, "Facebook App ID or Secret is not set")
-		return
-	}
-	scopes := InstagramOAuthScopes()
-
-	goth.UseProviders(facebook.New(
-		fbAppId,
-		fbAppSecret,
-		apiHost+"/api/v1/auth/instagram/callback",
-		scopes...,
-	))
-
-	q := e.Request.URL.Query()
-	q.Add("provider", "facebook")
-	e.Request.URL.RawQuery = q.Encode()
-	gothic.BeginAuthHandler(e.Response, e.Request)
+	beginFacebookLogin(e, "instagram", InstagramOAuthScopes())
 }
 
 func InstagramOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
-	// Initialize providers again in callback to ensure consistency
-	var apiHost string = os.Getenv("API_HOST")
-	var fbAppId string = os.Getenv("FACEBOOK_APP_ID")
-	var fbAppSecret string = os.Getenv("FACEBOOK_SECRET")
-	scopes := InstagramOAuthScopes()
-
-	goth.UseProviders(facebook.New(
-		fbAppId,
-		fbAppSecret,
-		apiHost+"/api/v1/auth/instagram/callback",
-		scopes...,
-	))
-
-	q := e.Request.URL.Query()
-	q.Add("provider", "facebook")
-	e.Request.URL.RawQuery = q.Encode()
-
-	user, err := gothic.CompleteUserAuth(e.Response, e.Request)
-	if err != nil {
-		e.Response.WriteHeader(http.StatusInternalServerError)
-		app.Logger().Error("Instagram OAuth callback failed: " + err.Error())
+	// AccountId is the Facebook user whose pages carry the Instagram accounts
+	flow, handoff, ok := completeFacebookLogin(e, app, "instagram", InstagramOAuthScopes())
+	if !ok {
 		return
 	}
-
-	accessToken := user.AccessToken
-	userId := user.UserID
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-
-	// Pass the Facebook user ID as fbUserId to match the expected parameter in AddInstagramPages
-	e.Redirect(http.StatusTemporaryRedirect, redirectHost+"/connect/instagram?accessToken="+accessToken+"&fbUserId="+userId+"&userId="+userId)
-	return
+	redirectWithHandoff(e, app, flow, handoff)
 }
 
 // InstagramBusinessAccount represents the Instagram business account details.
@@ -118,20 +69,25 @@ type InstaResponse struct {
 }
 
 func AddInstagramPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
-	fbUserId := e.Request.URL.Query().Get("fbUserId") // Fixed: was "userId"
-	accessToken := e.Request.URL.Query().Get("accessToken")
-	authUserId := e.Request.URL.Query().Get("userId")
+	handoff, ok := redeemHandoff(e, app, "instagram")
+	if !ok {
+		return
+	}
+	fbUserId := handoff.AccountId
+	accessToken := handoff.AccessToken
+	authUserId := e.Auth.Id
 
 	if fbUserId == "" || accessToken == "" || authUserId == "" {
 		app.Logger().Error("Missing required parameters: fbUserId, accessToken, or userId")
 		helpers.Error(e, "Missing required parameters")
 		return
 	}
+	accessToken = longLivedUserToken(app, accessToken)
 
 	// Updated API URL to include access_token for pages and their Instagram accounts
 	graphApi := "https://graph.facebook.com/" + fbUserId + "/accounts?fields=name,access_token,instagram_business_account{id,name,username,profile_picture_url}&access_token=" + accessToken
 
-	app.Logger().Info("Connecting to Instagram API", "url", graphApi)
+	app.Logger().Info("Connecting to Instagram API", "fbUserId", fbUserId)
 	resp, err := http.Get(graphApi)
 	if err != nil {
 		app.Logger().Error("Failed to connect to Instagram API: " + err.Error())
@@ -175,7 +131,10 @@ func AddInstagramPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 			"instagramName", data.InstagramBusinessAccount.Name,
 			"instagramUsername", data.InstagramBusinessAccount.Username)
 
-		jsonData, err := json.Marshal(data)
+		// the page token is stored encrypted in access_token, keep it out of meta_data
+		accountInfo := data
+		accountInfo.AccessToken = ""
+		jsonData, err := json.Marshal(accountInfo)
 		if err != nil {
 			app.Logger().Error("Failed to marshal Instagram business account data: " + err.Error())
 			continue // Continue with other accounts instead of returning
@@ -7,37 +7,46 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 )
 
 type ScheduledPost struct {
-	ID         string `json:"id"`
-	Title      string `json:"title"`
-	Content    string `json:"content"`
-	Link       string `json:"link"`
-	Images     string `json:"images"`
-	Status     string `json:"status"`
-	Connection string `json:"connection"`
+	ID             string `json:"id"`
+	Title          string `json:"title"`
+	Content        string `json:"content"`
+	Link           string `json:"link"`
+	Images         string `json:"images"`
+	Status         string `json:"status"`
+	Connection     string `json:"connection"`
+	User           string `json:"user"`
+	ReviewDecision string `json:"review_decision"`
+	Variants       string `json:"variants"`
+	ThreadParts    string `json:"thread_parts"`
 }
 
 type Connections struct {
-	ConnectionName string `json:"connection_name"`
-	AccessToken    string `json:"access_token"`
-	ConnectionId   string `json:"connection_id"`
+	ConnectionName   string `json:"connection_name"`
+	RequiresApproval bool   `json:"requires_approval"`
+	AccessToken      string `json:"access_token"`
+	ConnectionId     string `json:"connection_id"`
 }
 
 func GetScheduledPosts(app *pocketbase.PocketBase) {
-	time.Sleep(5 * time.Second) // wait for 5 seconds before executing the task
-
 	if err := EnsureTables(app, "posts", "connections"); err != nil {
 		app.Logger().Warn("Skipping scheduled post worker", "error", err.Error())
 		return
 	}
 
+	// recurring series only spawn occurrences; the occurrences get published below
+	ExpandRecurringPosts(app)
+	ReleaseExpiredPauses(app)
+
 	var posts []ScheduledPost
 	selectPostsQuery := `SELECT * FROM posts
 			WHERE status = 'scheduled'
 			AND datetime(publish_at) <= datetime('now')
+			AND coalesce(recurrence, '') = ''
 			AND deleted = '';`
 	// get all scheduled posts
 	err := app.DB().NewQuery(selectPostsQuery).All(&posts)
@@ -51,14 +60,20 @@ func GetScheduledPosts(app *pocketbase.PocketBase) {
 		for _, post := range posts {
 			postId := post.ID
 
-			record, err := app.FindRecordById("posts", postId)
+			// claim the post atomically so overlapping ticks or other instances skip it
+			claimed, err := tasks.ClaimPost(app, postId)
 			if err != nil {
-				app.Logger().Error("Failed to find post record ", "postId", postId, "error", err.Error())
+				app.Logger().Error("Failed to claim post.", "postId", postId, "error", err.Error())
+				continue
+			}
+			if !claimed {
+				app.Logger().Info("Post already claimed by another worker", "postId", postId)
 				continue
 			}
-			record.Set("status", "sending")
-			if err := app.Save(record); err != nil {
-				app.Logger().Error("Failed to update post status to sending.", "postId", postId, "error", err.Error())
+
+			// paused or blacked-out targets keep their posts instead of publishing
+			if pause, resumeAt := tasks.ActivePause(app, post.User, post.Connection, time.Now()); pause != nil {
+				holdForPause(app, postId, pause, resumeAt)
 				continue
 			}
 
@@ -73,14 +88,26 @@ func GetScheduledPosts(app *pocketbase.PocketBase) {
 				continue
 			}
 
+			variants, err := tasks.ParseVariants(post.Variants)
+			if err != nil {
+				markPostFailed(app, postId, "scheduler: failed to parse variants", err)
+				continue
+			}
+			threadParts, err := tasks.ParseThreadParts(post.ThreadParts)
+			if err != nil {
+				markPostFailed(app, postId, "scheduler: failed to parse thread parts", err)
+				continue
+			}
+
 			connectionId := post.Connection
 
 			var connections []Connections
 
-			selectConnectionsQuery := `SELECT connection_id, connection_name, access_token FROM connections WHERE id = '` + connectionId + `' AND deleted = "" ORDER BY id DESC;`
+			selectConnectionsQuery := `SELECT connection_id, connection_name, access_token, requires_approval FROM connections WHERE id = {:id} AND user = {:user} AND deleted = "" ORDER BY id DESC;`
 
-			// get social media connection details (access_token)
-			err = app.DB().NewQuery(selectConnectionsQuery).All(&connections)
+			// get social media connection details (access_token); only the
+			// post owner's own connection may publish it
+			err = app.DB().NewQuery(selectConnectionsQuery).Bind(dbx.Params{"id": connectionId, "user": post.User}).All(&connections)
 
 			if err != nil {
 				markPostFailed(app, postId, "scheduler: failed to fetch connection details", err)
@@ -88,7 +115,12 @@ func GetScheduledPosts(app *pocketbase.PocketBase) {
 			}
 
 			if len(connections) == 0 {
-				markPostFailed(app, postId, "scheduler: no active connection found for post", errors.New("connection not found or deleted"))
+				markPostFailed(app, postId, "scheduler: no active connection found for post", errors.New("connection not found, deleted or owned by another user"))
+				continue
+			}
+
+			if connections[0].RequiresApproval && post.ReviewDecision != ReviewApproved {
+				holdForApproval(app, postId)
 				continue
 			}
 
@@ -99,38 +131,16 @@ func GetScheduledPosts(app *pocketbase.PocketBase) {
 
 				app.Logger().Info("Posting to social media"+connectionName, "connectionName", connectionName, "postId", postId, "content", content, "images", images)
 
-				var postErr error
-				switch connectionName {
-				case "facebook":
-					// schedule facebook posts
-					postErr = tasks.FacebookPagePost(app, content, images, connectionId, accessToken, postId, link)
-				case "instagram":
-					// Post On Instagram
-					postErr = tasks.InstagramPost(app, content, images, connectionId, accessToken, postId)
-				case "twitter":
-					// Post on twitter
-					postErr = tasks.PostToTwitterProfile(app, content, images, connectionId, accessToken, postId)
-				case "linkedin":
-					// Post on linkedin
-					postErr = tasks.LinkedinPost(app, content, images, connectionId, accessToken, postId)
-				case "pinterest":
-					// Post on linkedin
-					postErr = tasks.PostToPinterestBoard(app, title, content, images, connectionId, accessToken, postId)
-				case "discord":
-					// Post on linkedin
-					postErr = tasks.PostToDiscordChannel(app, content, images, connectionId, accessToken, postId)
-				case "mastodon":
-					// Post to mastadon
-					postErr = tasks.PostToMastodon(app, content, images, connectionId, accessToken, postId)
-				case "threads":
-					// Post to mastadon
-					postErr = tasks.PostToThreads(app, content, images, connectionId, accessToken, postId)
-				case "reddit":
-					// Post to mastadon
-					postErr = tasks.PostToReddit(app, content, images, connectionId, accessToken, postId)
-				default:
-					postErr = fmt.Errorf("unsupported connection type: %s", connectionName)
-				}
+				postErr := tasks.StartQueue(app, connectionName, tasks.PostToSocialPayload{
+					Title:        title,
+					Content:      content,
+					Link:         link,
+					Images:       images,
+					ConnectionId: connectionId,
+					AccessToken:  accessToken,
+					SocialPostId: postId,
+					ThreadParts:  threadParts,
+				}.WithVariant(variants, connectionName))
 
 				if postErr != nil {
 					markPostFailed(app, postId, "scheduler: failed to dispatch post to platform "+connectionName, postErr)
@@ -147,3 +157,22 @@ func markPostFailed(app *pocketbase.PocketBase, postId string, context string, e
 	tasks.FailedPost(app, "scheduler", postId, errors.New(logMessage))
 	app.Logger().Error("Scheduled post failed", "postId", postId, "context", context, "error", err.Error())
 }
+
+// holdForApproval returns a claimed post that was never approved to review
+// instead of publishing it.
+func holdForApproval(app *pocketbase.PocketBase, postId string) {
+	record, err := app.FindRecordById("posts", postId)
+	if err != nil {
+		app.Logger().Error("Failed to load unapproved post", "postId", postId, "error", err.Error())
+		return
+	}
+	record.Set("status", PostStatusPendingApproval)
+	record.Set("lease_owner", "")
+	record.Set("lease_expires_at", "")
+	record.Set("logs", "scheduler: connection requires approval before publishing")
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Failed to hold unapproved post", "postId", postId, "error", err.Error())
+		return
+	}
+	app.Logger().Warn("Refused to publish unapproved post", "postId", postId)
+}
@@ -3,11 +3,13 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
 	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
@@ -47,8 +49,12 @@ func BeginLinkedinAuth(e *core.RequestEvent) {
 		Endpoint:     linkedin.Endpoint,
 	}
 
-	url := linkedinOauthConfig.AuthCodeURL("state")
-	e.Redirect(http.StatusTemporaryRedirect, url)
+	flow, err := newOAuthFlow(e, "linkedin", false)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+	startOAuth(e, linkedinOauthConfig.AuthCodeURL(flow.State, flow.AuthCodeOptions()...))
 }
 
 func LinkedinOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
@@ -61,18 +67,28 @@ func LinkedinOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
 		Endpoint:     linkedin.Endpoint,
 	}
 
+	flow, err := finishOAuthFlow(e, "linkedin")
+	if err != nil {
+		redirectWithError(e, "linkedin", err.Error())
+		return
+	}
 	code := e.Request.URL.Query().Get("code")
 	ctx := context.Background()
-	token, err := linkedinOauthConfig.Exchange(ctx, code)
+	token, err := linkedinOauthConfig.Exchange(ctx, code, flow.ExchangeOptions()...)
 	if err != nil {
 		app.Logger().Error("Failed to exchange LinkedIn token: " + err.Error())
 		e.String(http.StatusInternalServerError, "Failed to exchange token")
 		return
 	}
-	accessToken := token.AccessToken
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-	e.Redirect(http.StatusTemporaryRedirect, redirectHost+"/connect/linkedin?accessToken="+accessToken)
-	return
+	var expiresIn int64
+	if !token.Expiry.IsZero() {
+		expiresIn = int64(time.Until(token.Expiry).Seconds())
+	}
+	redirectWithHandoff(e, app, flow, tasks.OAuthHandoff{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresIn:    expiresIn,
+	})
 }
 
 // Struct to match the JSON response
@@ -92,8 +108,12 @@ type User struct {
 
 func AddLinkedinPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 
-	accessToken := e.Request.URL.Query().Get("accessToken")
-	authUserId := e.Request.URL.Query().Get("userId")
+	handoff, ok := redeemHandoff(e, app, "linkedin")
+	if !ok {
+		return
+	}
+	accessToken := handoff.AccessToken
+	authUserId := e.Auth.Id
 
 	if accessToken == "" || authUserId == "" {
 		helpers.Error(e, "Missing required parameters")
@@ -148,7 +168,8 @@ func AddLinkedinPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 		MetaData:       string(body),
 		ProfileImage:   user.Picture,
 		Username:       user.Sub,
-		RefreshToken:   "",
+		RefreshToken:   handoff.RefreshToken,
+		ExpiresAt:      expiryTime(handoff.ExpiresIn),
 	}
 
 	err = AddNewConnection(app, &userData)
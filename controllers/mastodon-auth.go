@@ -3,15 +3,14 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
-	"fmt"
-	"net/http"
+	"content-clock/tasks"
+	"context"
 	"os"
+	"strings"
 
-	"github.com/markbates/goth"
-	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/mastodon"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/oauth2"
 )
 
 func SetupMastodonRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
@@ -20,7 +19,7 @@ func SetupMastodonRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 		return nil
 	})
 	se.Router.GET("/api/v1/auth/mastodon/callback", func(e *core.RequestEvent) error {
-		MastodonCallback(e)
+		MastodonCallback(e, app)
 		return nil
 	})
 	se.Router.GET("/api/v1/add-mastodon-pages", func(e *core.RequestEvent) error {
@@ -29,64 +28,96 @@ func SetupMastodonRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 	})
 }
 
-// GET /api/v1/auth/mastodon
-func BeginMastodonAuth(e *core.RequestEvent) {
+// mastodonOAuthConfig is the app registered on the MASTODON_BASE_URL
+// instance, the same instance the publisher posts to.
+func mastodonOAuthConfig() *oauth2.Config {
+	instance := strings.TrimRight(os.Getenv("MASTODON_BASE_URL"), "/")
+	return &oauth2.Config{
+		ClientID:     os.Getenv("MASTODON_CLIENT_KEY"),
+		ClientSecret: os.Getenv("MASTODON_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("API_HOST") + "/api/v1/auth/mastodon/callback",
+		Scopes:       strings.Fields(MastodonOAuthScopes()),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  instance + "/oauth/authorize",
+			TokenURL: instance + "/oauth/token",
+		},
+	}
+}
 
-	var apiHost string = os.Getenv("API_HOST")
-	var mdApiKey string = os.Getenv("MASTODON_CLIENT_KEY")
-	var mdSecret string = os.Getenv("MASTODON_CLIENT_SECRET")
-	if mdApiKey == "" || mdSecret == "" {
+// GET /api/v1/auth/mastodon/start
+func BeginMastodonAuth(e *core.RequestEvent) {
+	if os.Getenv("MASTODON_CLIENT_KEY") == "" || os.Getenv("MASTODON_CLIENT_SECRET") == "" {
 		helpers.Error(e, "Mastodon Client Key or Secret is not set")
 		return
 	}
-	// var mdBaseUrl string = os.Getenv("MASTODON_BASE_URL")
-	goth.UseProviders(mastodon.New(mdApiKey, mdSecret, apiHost+"/api/v1/auth/mastodon/callback", MastodonOAuthScopes()))
-	q := e.Request.URL.Query()
-	q.Add("provider", "mastodon")
-	e.Request.URL.RawQuery = q.Encode()
-	gothic.BeginAuthHandler(e.Response, e.Request)
+	if os.Getenv("MASTODON_BASE_URL") == "" {
+		helpers.Error(e, "Mastodon Base URL is not set")
+		return
+	}
+	flow, err := newOAuthFlow(e, "mastodon", false)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+	startOAuth(e, mastodonOAuthConfig().AuthCodeURL(flow.State, flow.AuthCodeOptions()...))
+}
+
+// MastodonAccount is the part of verify_credentials the connection needs.
+type MastodonAccount struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
 }
 
 // GET /api/v1/auth/mastodon/callback
-func MastodonCallback(e *core.RequestEvent) {
-	user, err := gothic.CompleteUserAuth(e.Response, e.Request)
+func MastodonCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	flow, err := finishOAuthFlow(e, "mastodon")
 	if err != nil {
-		helpers.Error(e, "Authentication failed: "+err.Error())
+		redirectWithError(e, "mastodon", "Authentication failed: "+err.Error())
+		return
+	}
+	token, err := mastodonOAuthConfig().Exchange(context.Background(), e.Request.URL.Query().Get("code"), flow.ExchangeOptions()...)
+	if err != nil {
+		app.Logger().Error("Mastodon: Failed to exchange token: " + err.Error())
+		redirectWithError(e, "mastodon", "Authentication failed: could not exchange token")
 		return
 	}
 
-	// You can save token or user info to DB here
-	// For now, just show user data
-	// helpers.Success(c, "Mastodon authenticated", gin.H{
-	// 	"name":        user.Name,
-	// 	"email":       user.Email,
-	// 	"nickname":    user.NickName,
-	// 	"accessToken": user.AccessToken,
-	// 	"avatar":      user.AvatarURL,
-	// })
-
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-	redirectURL := fmt.Sprintf(
-		"%s/connect/mastodon?token=%s&user=%s&name=%s&username=%s&avatar=%s",
-		redirectHost,
-		user.AccessToken,
-		user.UserID,
-		user.Name,
-		user.NickName,
-		user.AvatarURL,
-	)
-
-	e.Redirect(http.StatusTemporaryRedirect, redirectURL)
+	account, err := helpers.MakeHTTPRequest[MastodonAccount](app, "GET", strings.TrimRight(os.Getenv("MASTODON_BASE_URL"), "/")+"/api/v1/accounts/verify_credentials", map[string]string{
+		"Authorization": "Bearer " + token.AccessToken,
+	}, nil, nil)
+	if err != nil {
+		app.Logger().Error("Mastodon: Failed to read account: " + err.Error())
+		redirectWithError(e, "mastodon", "Authentication failed: could not read account")
+		return
+	}
+	name := account.DisplayName
+	if name == "" {
+		name = account.Username
+	}
 
+	redirectWithHandoff(e, app, flow, tasks.OAuthHandoff{
+		AccessToken: token.AccessToken,
+		AccountId:   account.ID,
+		Name:        name,
+		Username:    account.Username,
+		Avatar:      account.Avatar,
+	})
 }
+
 func AddMastodonPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
-	accessToken := e.Request.URL.Query().Get("token")
-	authUserId := e.Request.URL.Query().Get("userId")
+	handoff, ok := redeemHandoff(e, app, "mastodon")
+	if !ok {
+		return
+	}
+	accessToken := handoff.AccessToken
+	authUserId := e.Auth.Id
 
-	// These come from the redirect query
-	name := e.Request.URL.Query().Get("name")
-	userID := e.Request.URL.Query().Get("user")
-	image := e.Request.URL.Query().Get("avatar")
+	// profile details were read by the callback
+	name := handoff.Name
+	userID := handoff.AccountId
+	image := handoff.Avatar
 	if accessToken == "" || authUserId == "" || userID == "" || name == "" || image == "" {
 		helpers.Error(e, "Missing required parameters")
 		return
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/oauth2"
+)
+
+// oauthFlowTTL is how long a user has to finish a provider's consent screen.
+const oauthFlowTTL = 10 * time.Minute
+
+var errOAuthState = errors.New("the connect link is invalid or expired, please start connecting the account again")
+
+// oauthFlow is one connect attempt. It travels as the OAuth state parameter,
+// sealed with AES-GCM under a key derived from OAUTH_STATE_SECRET (JWT_KEY
+// when unset): the state cannot be forged, it names the user who started the
+// flow and when it expires, and the PKCE verifier in it cannot be read by
+// anyone who sees the redirect.
+type oauthFlow struct {
+	Platform string `json:"p"`
+	User     string `json:"u"`
+	// Verifier is the PKCE code verifier; empty for providers without PKCE
+	Verifier string `json:"v,omitempty"`
+	Nonce    string `json:"n"`
+	Expires  int64  `json:"e"`
+
+	// State is the sealed flow sent to the provider
+	State string `json:"-"`
+}
+
+func oauthStateAEAD() (cipher.AEAD, error) {
+	secret := os.Getenv("OAUTH_STATE_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_KEY")
+	}
+	if secret == "" {
+		return nil, errors.New("OAUTH_STATE_SECRET is not set")
+	}
+	key := sha256.Sum256([]byte("content-clock oauth state:" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newOAuthFlow starts a connect flow for the authenticated user. With pkce
+// set the flow gets a code verifier whose S256 challenge goes to the provider.
+func newOAuthFlow(e *core.RequestEvent, platform string, pkce bool) (oauthFlow, error) {
+	if e.Auth == nil {
+		return oauthFlow{}, errors.New("sign in before connecting an account")
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return oauthFlow{}, err
+	}
+	flow := oauthFlow{
+		Platform: platform,
+		User:     e.Auth.Id,
+		Nonce:    base64.RawURLEncoding.EncodeToString(nonce),
+		Expires:  time.Now().Add(oauthFlowTTL).Unix(),
+	}
+	if pkce {
+		flow.Verifier = oauth2.GenerateVerifier()
+	}
+	return sealOAuthFlow(flow)
+}
+
+// sealOAuthFlow sets flow.State to the sealed flow.
+func sealOAuthFlow(flow oauthFlow) (oauthFlow, error) {
+	aead, err := oauthStateAEAD()
+	if err != nil {
+		return oauthFlow{}, err
+	}
+	plaintext, err := json.Marshal(flow)
+	if err != nil {
+		return oauthFlow{}, err
+	}
+	sealed := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(sealed); err != nil {
+		return oauthFlow{}, err
+	}
+	sealed = aead.Seal(sealed, sealed, plaintext, []byte(flow.Platform))
+	flow.State = base64.RawURLEncoding.EncodeToString(sealed)
+	return flow, nil
+}
+
+// finishOAuthFlow checks the state a provider sent back to platform's
+// callback and returns the flow it belongs to.
+func finishOAuthFlow(e *core.RequestEvent, platform string) (oauthFlow, error) {
+	query := e.Request.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		if description := query.Get("error_description"); description != "" {
+			return oauthFlow{}, errors.New(description)
+		}
+		return oauthFlow{}, errors.New("authorization was not granted: " + providerErr)
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(query.Get("state"))
+	if err != nil {
+		return oauthFlow{}, errOAuthState
+	}
+	aead, err := oauthStateAEAD()
+	if err != nil {
+		return oauthFlow{}, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return oauthFlow{}, errOAuthState
+	}
+	// the platform is authenticated data, so a state from another
+	// provider's flow is rejected
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(platform))
+	if err != nil {
+		return oauthFlow{}, errOAuthState
+	}
+	var flow oauthFlow
+	if err := json.Unmarshal(plaintext, &flow); err != nil || flow.Platform != platform || flow.User == "" {
+		return oauthFlow{}, errOAuthState
+	}
+	if time.Now().Unix() > flow.Expires {
+		return oauthFlow{}, errOAuthState
+	}
+	return flow, nil
+}
+
+// Challenge is the S256 PKCE code challenge, or "" without PKCE.
+func (f oauthFlow) Challenge() string {
+	if f.Verifier == "" {
+		return ""
+	}
+	return oauth2.S256ChallengeFromVerifier(f.Verifier)
+}
+
+// AuthCodeOptions are the PKCE parameters for oauth2.Config.AuthCodeURL.
+func (f oauthFlow) AuthCodeOptions() []oauth2.AuthCodeOption {
+	if f.Verifier == "" {
+		return nil
+	}
+	return []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(f.Verifier)}
+}
+
+// ExchangeOptions are the PKCE parameters for oauth2.Config.Exchange.
+func (f oauthFlow) ExchangeOptions() []oauth2.AuthCodeOption {
+	if f.Verifier == "" {
+		return nil
+	}
+	return []oauth2.AuthCodeOption{oauth2.VerifierOption(f.Verifier)}
+}
+
+// startOAuth answers a /start request with the provider's authorization URL.
+// The frontend navigates to it; the route itself needs the user's token, so
+// it cannot be opened as a plain link.
+func startOAuth(e *core.RequestEvent, authURL string) {
+	helpers.Success(e, "Authorization URL created", map[string]interface{}{"url": authURL})
+}
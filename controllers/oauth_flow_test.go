@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"golang.org/x/oauth2"
+)
+
+func oauthStartEvent(userId string) *core.RequestEvent {
+	e := &core.RequestEvent{Event: router.Event{Request: httptest.NewRequest("GET", "/api/v1/auth/twitter/start", nil)}}
+	if userId != "" {
+		e.Auth = &core.Record{}
+		e.Auth.Id = userId
+	}
+	return e
+}
+
+func oauthCallbackEvent(query url.Values) *core.RequestEvent {
+	return &core.RequestEvent{Event: router.Event{Request: httptest.NewRequest("GET", "/api/v1/auth/twitter/callback?"+query.Encode(), nil)}}
+}
+
+func TestNewOAuthFlow(t *testing.T) {
+	t.Setenv("OAUTH_STATE_SECRET", "state-secret")
+
+	tests := []struct {
+		name    string
+		userId  string
+		pkce    bool
+		wantErr bool
+	}{
+		{name: "with PKCE", userId: "user1", pkce: true},
+		{name: "without PKCE", userId: "user1"},
+		{name: "signed out", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow, err := newOAuthFlow(oauthStartEvent(tt.userId), "twitter", tt.pkce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("newOAuthFlow succeeded without a signed-in user")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newOAuthFlow: %v", err)
+			}
+			if flow.State == "" || flow.User != tt.userId || flow.Platform != "twitter" {
+				t.Fatalf("unexpected flow %+v", flow)
+			}
+			if (flow.Verifier != "") != tt.pkce || (flow.Challenge() != "") != tt.pkce || (len(flow.AuthCodeOptions()) > 0) != tt.pkce {
+				t.Fatalf("PKCE = %v, flow %+v", tt.pkce, flow)
+			}
+			if tt.pkce && flow.Challenge() != oauth2.S256ChallengeFromVerifier(flow.Verifier) {
+				t.Fatal("challenge is not the S256 of the verifier")
+			}
+		})
+	}
+
+	first, _ := newOAuthFlow(oauthStartEvent("user1"), "twitter", true)
+	second, _ := newOAuthFlow(oauthStartEvent("user1"), "twitter", true)
+	if first.State == second.State || first.Nonce == second.Nonce || first.Verifier == second.Verifier {
+		t.Fatal("two flows share state, nonce or verifier")
+	}
+}
+
+func TestFinishOAuthFlow(t *testing.T) {
+	t.Setenv("OAUTH_STATE_SECRET", "state-secret")
+
+	flow, err := newOAuthFlow(oauthStartEvent("user1"), "twitter", true)
+	if err != nil {
+		t.Fatalf("newOAuthFlow: %v", err)
+	}
+	expired, err := sealOAuthFlow(oauthFlow{Platform: "twitter", User: "user1", Nonce: "n", Expires: time.Now().Add(-time.Second).Unix()})
+	if err != nil {
+		t.Fatalf("sealOAuthFlow: %v", err)
+	}
+	anonymous, err := sealOAuthFlow(oauthFlow{Platform: "twitter", Nonce: "n", Expires: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("sealOAuthFlow: %v", err)
+	}
+	reddit, err := sealOAuthFlow(oauthFlow{Platform: "reddit", User: "user1", Nonce: "n", Expires: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("sealOAuthFlow: %v", err)
+	}
+	sealed, _ := base64.RawURLEncoding.DecodeString(flow.State)
+	sealed[len(sealed)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(sealed)
+
+	tests := []struct {
+		name      string
+		query     url.Values
+		secret    string
+		wantState bool
+		wantErr   error
+	}{
+		{name: "valid state", query: url.Values{"code": {"c"}, "state": {flow.State}}, wantState: true},
+		{name: "tampered state", query: url.Values{"code": {"c"}, "state": {tampered}}, wantErr: errOAuthState},
+		{name: "expired state", query: url.Values{"code": {"c"}, "state": {expired.State}}, wantErr: errOAuthState},
+		{name: "state of another platform", query: url.Values{"code": {"c"}, "state": {reddit.State}}, wantErr: errOAuthState},
+		{name: "state without a user", query: url.Values{"code": {"c"}, "state": {anonymous.State}}, wantErr: errOAuthState},
+		{name: "state sealed with another secret", query: url.Values{"code": {"c"}, "state": {flow.State}}, secret: "rotated", wantErr: errOAuthState},
+		{name: "missing state", query: url.Values{"code": {"c"}}, wantErr: errOAuthState},
+		{name: "not base64", query: url.Values{"code": {"c"}, "state": {"%%%"}}, wantErr: errOAuthState},
+		{name: "truncated state", query: url.Values{"code": {"c"}, "state": {"abc"}}, wantErr: errOAuthState},
+		{name: "consent denied", query: url.Values{"error": {"access_denied"}, "state": {flow.State}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.secret != "" {
+				t.Setenv("OAUTH_STATE_SECRET", tt.secret)
+			}
+			got, err := finishOAuthFlow(oauthCallbackEvent(tt.query), "twitter")
+			if tt.wantState {
+				if err != nil {
+					t.Fatalf("finishOAuthFlow: %v", err)
+				}
+				if got.User != flow.User || got.Verifier != flow.Verifier || got.Nonce != flow.Nonce {
+					t.Fatalf("finishOAuthFlow = %+v, want %+v", got, flow)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("finishOAuthFlow accepted the callback: %+v", got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("finishOAuthFlow error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOAuthStateSecretFallsBackToJWTKey(t *testing.T) {
+	t.Setenv("OAUTH_STATE_SECRET", "")
+	t.Setenv("JWT_KEY", "jwt-key")
+	flow, err := newOAuthFlow(oauthStartEvent("user1"), "twitter", false)
+	if err != nil {
+		t.Fatalf("newOAuthFlow: %v", err)
+	}
+	if _, err := finishOAuthFlow(oauthCallbackEvent(url.Values{"state": {flow.State}}), "twitter"); err != nil {
+		t.Fatalf("finishOAuthFlow: %v", err)
+	}
+
+	t.Setenv("JWT_KEY", "")
+	if _, err := newOAuthFlow(oauthStartEvent("user1"), "twitter", false); err == nil {
+		t.Fatal("newOAuthFlow succeeded without any state secret")
+	}
+}
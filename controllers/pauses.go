@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"content-clock/tasks"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// PostStatusPaused is set on posts that came due during a pause. They keep
+// their publish_at and are released when the pause is lifted.
+const PostStatusPaused = "paused"
+
+type liftPauseRequest struct {
+	Mode string `json:"mode"`
+}
+
+func SetupPauseRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.POST("/api/v1/pauses/{id}/lift", func(e *core.RequestEvent) error {
+		LiftPauseRequest(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.GET("/api/v1/connections/{id}/pause", func(e *core.RequestEvent) error {
+		GetConnectionPause(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// SetupPauseHooks validates pauses and blackout windows and makes sure held
+// posts are released however a pause ends.
+func SetupPauseHooks(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		if err := validatePause(app, e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("publish_pauses").BindFunc(validate)
+	app.OnRecordUpdate("publish_pauses").BindFunc(validate)
+
+	// lifting goes through the lift endpoint so held posts are released
+	app.OnRecordCreateRequest("publish_pauses").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.Set("lifted_at", "")
+		e.Record.Set("lifted_by", "")
+		return e.Next()
+	})
+	app.OnRecordUpdateRequest("publish_pauses").BindFunc(func(e *core.RecordRequestEvent) error {
+		original := e.Record.Original()
+		e.Record.Set("lifted_at", original.GetDateTime("lifted_at"))
+		e.Record.Set("lifted_by", original.GetString("lifted_by"))
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess("publish_pauses").BindFunc(func(e *core.RecordEvent) error {
+		releaseHeldPosts(app, e.Record, tasks.ResumePublish, 0)
+		return e.Next()
+	})
+}
+
+func validatePause(app core.App, record *core.Record) error {
+	kind := record.GetString("kind")
+	if kind == "" {
+		kind = tasks.PauseKindPause
+		record.Set("kind", kind)
+	}
+	if kind != tasks.PauseKindPause && kind != tasks.PauseKindBlackout {
+		return apis.NewBadRequestError("kind must be pause or blackout.", nil)
+	}
+	if mode := record.GetString("resume_mode"); mode != "" && mode != tasks.ResumePublish && mode != tasks.ResumeShift {
+		return apis.NewBadRequestError("resume_mode must be publish or shift.", nil)
+	}
+	if !helpers.ValidTimezone(record.GetString("timezone")) {
+		return apis.NewBadRequestError("Unknown timezone "+record.GetString("timezone")+".", nil)
+	}
+	if connectionId := record.GetString("connection"); connectionId != "" {
+		connection, err := app.FindRecordById("connections", connectionId)
+		if err != nil || (record.GetString("user") != "" && connection.GetString("user") != record.GetString("user")) {
+			return apis.NewBadRequestError("Connection not found.", nil)
+		}
+	}
+
+	startsAt := record.GetDateTime("starts_at")
+	if startsAt.IsZero() {
+		if kind == tasks.PauseKindBlackout {
+			return apis.NewBadRequestError("Blackout windows need starts_at for the first window.", nil)
+		}
+		startsAt = types.NowDateTime()
+		record.Set("starts_at", startsAt)
+	}
+	if endsAt := record.GetDateTime("ends_at"); !endsAt.IsZero() && !endsAt.After(startsAt) {
+		return apis.NewBadRequestError("ends_at must be after starts_at.", nil)
+	}
+
+	if kind == tasks.PauseKindBlackout {
+		rule, err := helpers.ParseRRule(strings.TrimSpace(record.GetString("recurrence")))
+		if err != nil {
+			return apis.NewBadRequestError("Invalid recurrence rule: "+err.Error(), nil)
+		}
+		if rule.Count > 0 {
+			return apis.NewBadRequestError("Blackout windows use UNTIL instead of COUNT.", nil)
+		}
+		if record.GetInt("duration_minutes") <= 0 {
+			return apis.NewBadRequestError("duration_minutes must be greater than 0.", nil)
+		}
+	}
+	return nil
+}
+
+// LiftPauseRequest lifts a pause. The body's mode ("publish" or "shift")
+// overrides the pause's resume_mode.
+func LiftPauseRequest(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	var body liftPauseRequest
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+			helpers.Error(e, "Invalid request body")
+			return
+		}
+	}
+
+	pause, err := app.FindRecordById("publish_pauses", e.Request.PathValue("id"))
+	if err != nil || !canManagePause(e, pause) {
+		helpers.Error(e, "Pause not found")
+		return
+	}
+	if pause.GetString("kind") != tasks.PauseKindPause {
+		helpers.Error(e, "Blackout windows cannot be lifted; delete the window instead")
+		return
+	}
+	if !pause.GetDateTime("lifted_at").IsZero() {
+		helpers.Error(e, "Pause is already lifted")
+		return
+	}
+	mode := body.Mode
+	if mode == "" {
+		mode = pause.GetString("resume_mode")
+	}
+	if mode != "" && mode != tasks.ResumePublish && mode != tasks.ResumeShift {
+		helpers.Error(e, "mode must be publish or shift")
+		return
+	}
+
+	released, err := LiftPause(app, pause, mode, e.Auth.Id, time.Now())
+	if err != nil {
+		helpers.Error(e, "Failed to lift pause: "+err.Error())
+		return
+	}
+	helpers.Success(e, "Pause lifted", map[string]interface{}{
+		"id":        pause.Id,
+		"lifted_at": pause.GetDateTime("lifted_at"),
+		"mode":      pause.GetString("resume_mode"),
+		"released":  released,
+	})
+}
+
+// GetConnectionPause reports whether a connection is paused or inside a
+// blackout window right now.
+func GetConnectionPause(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	connection, err := app.FindRecordById("connections", e.Request.PathValue("id"))
+	if err != nil || connection.GetString("user") != e.Auth.Id {
+		helpers.Error(e, "Connection not found")
+		return
+	}
+	pause, resumeAt := tasks.ActivePause(app, connection.GetString("user"), connection.Id, time.Now())
+	result := map[string]interface{}{"paused": pause != nil, "pause": pause, "resume_at": nil}
+	if !resumeAt.IsZero() {
+		result["resume_at"] = resumeAt.UTC().Format(time.RFC3339)
+	}
+	helpers.Success(e, "", result)
+}
+
+// LiftPause ends a pause at liftedAt and releases the posts it held. With
+// mode "shift" every held post moves later by the length of the pause;
+// otherwise held posts are published on the next scheduler run.
+func LiftPause(app core.App, pause *core.Record, mode string, liftedBy string, liftedAt time.Time) (int, error) {
+	if mode == "" {
+		mode = tasks.ResumePublish
+	}
+	pause.Set("lifted_at", liftedAt.UTC())
+	pause.Set("lifted_by", liftedBy)
+	pause.Set("resume_mode", mode)
+	if err := app.Save(pause); err != nil {
+		return 0, err
+	}
+
+	length := liftedAt.Sub(pause.GetDateTime("starts_at").Time())
+	released := releaseHeldPosts(app, pause, mode, length)
+	app.Logger().Info("Publishing pause lifted", "pauseId", pause.Id, "mode", mode, "released", released, "length", length.String())
+	return released, nil
+}
+
+// ReleaseExpiredPauses lifts pauses whose ends_at has passed, using each
+// pause's resume_mode.
+func ReleaseExpiredPauses(app core.App) {
+	if _, err := app.FindCollectionByNameOrId("publish_pauses"); err != nil {
+		return
+	}
+	pauses, err := app.FindRecordsByFilter(
+		"publish_pauses",
+		"kind = {:kind} && lifted_at = '' && ends_at != '' && ends_at <= @now",
+		"ends_at",
+		0,
+		0,
+		dbx.Params{"kind": tasks.PauseKindPause},
+	)
+	if err != nil {
+		app.Logger().Error("Failed to load expired pauses", "error", err.Error())
+		return
+	}
+	for _, pause := range pauses {
+		if _, err := LiftPause(app, pause, pause.GetString("resume_mode"), "", pause.GetDateTime("ends_at").Time()); err != nil {
+			app.Logger().Error("Failed to lift expired pause", "pauseId", pause.Id, "error", err.Error())
+		}
+	}
+}
+
+// holdForPause takes a claimed post out of the publish run. Posts hit by a
+// pause wait in "paused" until it is lifted; posts hit by a blackout window
+// are rescheduled to the end of the window.
+func holdForPause(app *pocketbase.PocketBase, postId string, pause *core.Record, resumeAt time.Time) {
+	record, err := app.FindRecordById("posts", postId)
+	if err != nil {
+		app.Logger().Error("Failed to load paused post", "postId", postId, "error", err.Error())
+		return
+	}
+	record.Set("lease_owner", "")
+	record.Set("lease_expires_at", "")
+	if pause.GetString("kind") == tasks.PauseKindBlackout {
+		record.Set("status", PostStatusScheduled)
+		record.Set("publish_at", resumeAt.UTC())
+		record.Set("logs", "scheduler: blackout window, moved to "+resumeAt.UTC().Format(time.RFC3339))
+	} else {
+		record.Set("status", PostStatusPaused)
+		record.Set("paused_by", pause.Id)
+		record.Set("logs", "scheduler: publishing is paused: "+pause.GetString("reason"))
+	}
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Failed to hold paused post", "postId", postId, "pauseId", pause.Id, "error", err.Error())
+		return
+	}
+	app.Logger().Info("Post held by publishing pause", "postId", postId, "pauseId", pause.Id, "kind", pause.GetString("kind"))
+}
+
+func releaseHeldPosts(app core.App, pause *core.Record, mode string, length time.Duration) int {
+	posts, err := app.FindRecordsByFilter(
+		"posts",
+		"paused_by = {:pause} && status = {:status}",
+		"publish_at",
+		0,
+		0,
+		dbx.Params{"pause": pause.Id, "status": PostStatusPaused},
+	)
+	if err != nil {
+		app.Logger().Error("Failed to load held posts", "pauseId", pause.Id, "error", err.Error())
+		return 0
+	}
+
+	released := 0
+	for _, post := range posts {
+		resumeAt := time.Now()
+		post.Set("status", PostStatusScheduled)
+		post.Set("paused_by", "")
+		if mode == tasks.ResumeShift && length > 0 {
+			resumeAt = post.GetDateTime("publish_at").Time().Add(length)
+			post.Set("publish_at", resumeAt.UTC())
+		}
+		if tasks.ResumeHeldJob(app, post.Id, resumeAt) {
+			// held by the queue; its job publishes it
+			post.Set("status", "retrying")
+			post.Set("logs", "queue: pause lifted; publishing at "+resumeAt.UTC().Format(time.RFC3339))
+		}
+		if err := app.Save(post); err != nil {
+			app.Logger().Error("Failed to release held post", "postId", post.Id, "pauseId", pause.Id, "error", err.Error())
+			continue
+		}
+		released++
+	}
+	return released
+}
+
+func canManagePause(e *core.RequestEvent, pause *core.Record) bool {
+	if e.HasSuperuserAuth() {
+		return true
+	}
+	return pause.GetString("user") != "" && pause.GetString("user") == e.Auth.Id
+}
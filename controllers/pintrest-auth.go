@@ -3,6 +3,7 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -50,7 +51,7 @@ func SetupPinterestRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 		return nil
 	})
 	se.Router.GET("/api/v1/auth/pinterest/callback", func(e *core.RequestEvent) error {
-		PinterestOAuthCallback(e)
+		PinterestOAuthCallback(e, app)
 		return nil
 	})
 	se.Router.GET("/api/v1/add-pinterest-pages", func(e *core.RequestEvent) error {
@@ -68,40 +69,33 @@ func BeginPinterestAuth(e *core.RequestEvent) {
 		return
 	}
 
-	state := os.Getenv("JWT_KEY")
-
-	scopes := strings.Join(PinterestOAuthScopes(), ",")
-
-	redirect_uri := apiHost + "/api/v1/auth/pinterest/callback"
-
-	url := "https://www.pinterest.com/oauth/?client_id=" + pinterestAppId + "&redirect_uri=" + redirect_uri + "&response_type=code&scope=" + scopes + "&state=" + state
-	e.Redirect(http.StatusTemporaryRedirect, url)
-}
-
-func PinterestOAuthCallback(e *core.RequestEvent) {
-
-	code := e.Request.URL.Query().Get("code")
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-	e.Redirect(http.StatusTemporaryRedirect, redirectHost+"/connect/pinterest?code="+code)
-	return
-}
+	flow, err := newOAuthFlow(e, "pinterest", true)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
 
-type PinterestResponse struct {
-	AccessToken           string `json:"access_token"`
-	RefreshToken          string `json:"refresh_token"`
-	ResponseType          string `json:"response_type"`
-	TokenType             string `json:"token_type"`
-	ExpiresIn             int    `json:"expires_in"`
-	RefreshTokenExpiresIn int    `json:"refresh_token_expires_in"`
-	Scope                 string `json:"scope"`
+	params := url.Values{
+		"client_id":             {pinterestAppId},
+		"redirect_uri":          {apiHost + "/api/v1/auth/pinterest/callback"},
+		"response_type":         {"code"},
+		"scope":                 {strings.Join(PinterestOAuthScopes(), ",")},
+		"state":                 {flow.State},
+		"code_challenge":        {flow.Challenge()},
+		"code_challenge_method": {"S256"},
+	}
+	startOAuth(e, "https://www.pinterest.com/oauth/?"+params.Encode())
 }
 
-func AddPinterestPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
-
+func PinterestOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	flow, err := finishOAuthFlow(e, "pinterest")
+	if err != nil {
+		redirectWithError(e, "pinterest", err.Error())
+		return
+	}
 	code := e.Request.URL.Query().Get("code")
-	authUserId := e.Request.URL.Query().Get("userId")
-	if code == "" || authUserId == "" {
-		helpers.Error(e, "Missing required parameters")
+	if code == "" {
+		redirectWithError(e, "pinterest", "Code not found")
 		return
 	}
 
@@ -110,16 +104,20 @@ func AddPinterestPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 
 	var apiHost string = os.Getenv("API_HOST")
 	redirect_uri := apiHost + "/api/v1/auth/pinterest/callback"
-	urlEncode := url.QueryEscape(redirect_uri)
 
-	payload := strings.NewReader("grant_type=authorization_code&code=" + code + "&redirect_uri=" + urlEncode)
+	payload := strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirect_uri},
+		"code_verifier": {flow.Verifier},
+	}.Encode())
 
 	client := &http.Client{}
 	req, err := http.NewRequest(method, pinUrl, payload)
 
 	if err != nil {
 		app.Logger().Error("Pinterest: Failed to create HTTP request: " + err.Error())
-		helpers.Error(e, err.Error())
+		redirectWithError(e, "pinterest", err.Error())
 		return
 	}
 	var pinterestAppSecret string = os.Getenv("PINTEREST_SECRET")
@@ -129,7 +127,7 @@ func AddPinterestPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 	res, err := client.Do(req)
 	if err != nil {
 		app.Logger().Error("Pinterest: Failed to send HTTP request: " + err.Error())
-		helpers.Error(e, err.Error())
+		redirectWithError(e, "pinterest", err.Error())
 		return
 	}
 	defer res.Body.Close()
@@ -137,7 +135,7 @@ func AddPinterestPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		app.Logger().Error("Pinterest: Failed to read response body: " + err.Error())
-		helpers.Error(e, err.Error())
+		redirectWithError(e, "pinterest", err.Error())
 		return
 	}
 
@@ -146,11 +144,46 @@ func AddPinterestPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 	err = json.Unmarshal(body, &response)
 	if err != nil {
 		app.Logger().Error("Pinterest: Failed to parse JSON response: " + err.Error())
-		helpers.Error(e, err.Error())
+		redirectWithError(e, "pinterest", err.Error())
+		return
+	}
+	if response.AccessToken == "" {
+		app.Logger().Error("Pinterest: token exchange failed", "status", res.Status)
+		redirectWithError(e, "pinterest", "Pinterest token exchange failed")
+		return
+	}
+
+	// keep the grant details but not the tokens themselves
+	tokenInfo := response
+	tokenInfo.AccessToken, tokenInfo.RefreshToken = "", ""
+	metaData, _ := json.Marshal(tokenInfo)
+
+	redirectWithHandoff(e, app, flow, tasks.OAuthHandoff{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresIn:    int64(response.ExpiresIn),
+		MetaData:     string(metaData),
+	})
+}
+
+type PinterestResponse struct {
+	AccessToken           string `json:"access_token"`
+	RefreshToken          string `json:"refresh_token"`
+	ResponseType          string `json:"response_type"`
+	TokenType             string `json:"token_type"`
+	ExpiresIn             int    `json:"expires_in"`
+	RefreshTokenExpiresIn int    `json:"refresh_token_expires_in"`
+	Scope                 string `json:"scope"`
+}
+
+func AddPinterestPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	handoff, ok := redeemHandoff(e, app, "pinterest")
+	if !ok {
 		return
 	}
+	authUserId := e.Auth.Id
 
-	boards, err := GetUserBoards(response.AccessToken, app)
+	boards, err := GetUserBoards(handoff.AccessToken, app)
 
 	if err != nil {
 		app.Logger().Error("Pinterest: Failed to get user boards: " + err.Error())
@@ -164,11 +197,12 @@ func AddPinterestPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
 			Name:           board.Name,
 			ConnectionName: "pinterest",
 			ConnectionId:   board.ID,
-			AccessToken:    response.AccessToken,
-			MetaData:       string(body),
+			AccessToken:    handoff.AccessToken,
+			MetaData:       handoff.MetaData,
 			ProfileImage:   board.Media.ImageCoverURL,
 			Username:       board.Owner.Username,
-			RefreshToken:   response.RefreshToken,
+			RefreshToken:   handoff.RefreshToken,
+			ExpiresAt:      expiryTime(handoff.ExpiresIn),
 		}
 
 		err = AddNewConnection(app, &userData)
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"content-clock/tasks"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type PlatformInfo struct {
+	Name         string             `json:"name"`
+	Capabilities tasks.Capabilities `json:"capabilities"`
+}
+
+func SetupPlatformRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.GET("/api/v1/platforms", func(e *core.RequestEvent) error {
+		GetPlatforms(e, app)
+		return nil
+	})
+	se.Router.GET("/api/v1/rate-limits", func(e *core.RequestEvent) error {
+		GetRateLimits(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// GetPlatforms lists every registered publisher and what it supports.
+func GetPlatforms(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	platforms := []PlatformInfo{}
+	for _, publisher := range tasks.Publishers() {
+		platforms = append(platforms, PlatformInfo{
+			Name:         publisher.Name(),
+			Capabilities: publisher.Capabilities(),
+		})
+	}
+	helpers.Success(e, "", platforms)
+}
+
+// GetRateLimits shows the last known request budget of the caller's
+// connections and the app-wide budget of each platform.
+func GetRateLimits(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	limits := []tasks.RateLimitStatus{}
+	owned := map[string]bool{}
+	for _, status := range tasks.RateLimits() {
+		if status.Connection != "" {
+			mine, checked := owned[status.Connection]
+			if !checked {
+				connection, err := app.FindRecordById("connections", status.Connection)
+				mine = err == nil && connection.GetString("user") == e.Auth.Id
+				owned[status.Connection] = mine
+			}
+			if !mine {
+				continue
+			}
+		}
+		limits = append(limits, status)
+	}
+	helpers.Success(e, "", limits)
+}
@@ -1,23 +1,123 @@
 package controllers
 
 import (
+	"content-clock/helpers"
+	"content-clock/tasks"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// file fields of a post; publishers read all of them from the same record
+var postFileFields = []string{"images", "variant_images", "thread_images"}
+
 func SetupPostHooks(app *pocketbase.PocketBase) {
+	validateRecurrence := func(e *core.RecordEvent) error {
+		if recurrence := strings.TrimSpace(e.Record.GetString("recurrence")); recurrence != "" {
+			if _, err := helpers.ParseRRule(recurrence); err != nil {
+				return apis.NewBadRequestError("Invalid recurrence rule: "+err.Error(), nil)
+			}
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("posts").BindFunc(validateRecurrence)
+	app.OnRecordUpdate("posts").BindFunc(validateRecurrence)
+
+	validateVariants := func(e *core.RecordEvent) error {
+		variants, err := tasks.ParseVariants(e.Record.GetString("variants"))
+		if err == nil {
+			sizes := map[string]int64{}
+			err = variants.Check(append(postFiles(e.Record, "images", sizes), postFiles(e.Record, "variant_images", sizes)...))
+		}
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("posts").BindFunc(validateVariants)
+	app.OnRecordUpdate("posts").BindFunc(validateVariants)
+
+	validateThreadParts := func(e *core.RecordEvent) error {
+		parts, err := tasks.ParseThreadParts(e.Record.GetString("thread_parts"))
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		sizes := map[string]int64{}
+		files := append(postFiles(e.Record, "images", sizes), postFiles(e.Record, "thread_images", sizes)...)
+		for i, part := range parts {
+			for _, name := range part.Images {
+				if !slices.Contains(files, name) {
+					return apis.NewBadRequestError(fmt.Sprintf("thread_parts: part %d image %s is not attached to the post", i+2, name), nil)
+				}
+			}
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("posts").BindFunc(validateThreadParts)
+	app.OnRecordUpdate("posts").BindFunc(validateThreadParts)
+
+	// a post can only be published through its owner's own connection
+	validateConnectionOwner := func(e *core.RecordEvent) error {
+		if connectionId := e.Record.GetString("connection"); connectionId != "" {
+			connection, err := app.FindRecordById("connections", connectionId)
+			if err == nil && connection.GetString("user") != e.Record.GetString("user") {
+				return apis.NewBadRequestError("Connection belongs to another user.", nil)
+			}
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("posts").BindFunc(validateConnectionOwner)
+	app.OnRecordUpdate("posts").BindFunc(validateConnectionOwner)
+
+	// thread_progress is written by the publisher only
+	app.OnRecordCreateRequest("posts").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.Set("thread_progress", nil)
+		return e.Next()
+	})
+	app.OnRecordUpdateRequest("posts").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.Set("thread_progress", e.Record.Original().Get("thread_progress"))
+		return e.Next()
+	})
+
+	resolveSchedule := func(e *core.RecordEvent) error {
+		if err := resolvePublishAt(app, e.Record); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("posts").BindFunc(resolveSchedule)
+	app.OnRecordUpdate("posts").BindFunc(resolveSchedule)
+
+	app.OnRecordEnrich("posts").BindFunc(func(e *core.RecordEnrichEvent) error {
+		publishAt := e.Record.GetDateTime("publish_at")
+		if publishAt.IsZero() {
+			return e.Next()
+		}
+		timezone := PostTimezone(app, e.Record)
+		e.Record.WithCustomData(true)
+		e.Record.Set("timezone", timezone)
+		e.Record.Set("publish_at_utc", publishAt.Time().UTC().Format(time.RFC3339))
+		e.Record.Set("publish_at_local", publishAt.Time().In(helpers.LoadLocation(timezone)).Format(helpers.LocalTimeLayout))
+		return e.Next()
+	})
+
 	app.OnRecordUpdate("posts").BindFunc(func(e *core.RecordEvent) error {
 		deletedAt := strings.TrimSpace(e.Record.GetString("deleted"))
 		status := strings.ToLower(strings.TrimSpace(e.Record.GetString("status")))
 
 		// Soft deleted posts should not keep media files in storage.
 		if deletedAt != "" || status == "deleted" {
-			images := e.Record.GetStringSlice("images")
-			if len(images) > 0 {
-				e.Record.Set("images", []string{})
-				app.Logger().Info("Post media cleared on soft delete", "post", e.Record.Id, "files", len(images))
+			for _, field := range postFileFields {
+				images := e.Record.GetStringSlice(field)
+				if len(images) > 0 {
+					e.Record.Set(field, []string{})
+					app.Logger().Info("Post media cleared on soft delete", "post", e.Record.Id, "field", field, "files", len(images))
+				}
 			}
 		}
 
@@ -25,3 +125,45 @@ func SetupPostHooks(app *pocketbase.PocketBase) {
 	})
 }
 
+// PostTimezone returns the timezone a post is scheduled in: its own
+// timezone override, else the timezone of its connection, else UTC.
+func PostTimezone(app core.App, record *core.Record) string {
+	if timezone := strings.TrimSpace(record.GetString("timezone")); timezone != "" {
+		return timezone
+	}
+	if connection, err := app.FindRecordById("connections", record.GetString("connection")); err == nil {
+		if timezone := strings.TrimSpace(connection.GetString("timezone")); timezone != "" && helpers.ValidTimezone(timezone) {
+			return timezone
+		}
+	}
+	return "UTC"
+}
+
+// resolvePublishAt keeps publish_at (UTC) and publish_at_local (wall clock in
+// the post's timezone) in sync. A changed publish_at_local or timezone wins;
+// otherwise publish_at is the source and the local time is derived from it.
+func resolvePublishAt(app core.App, record *core.Record) error {
+	if !helpers.ValidTimezone(record.GetString("timezone")) {
+		return fmt.Errorf("unknown timezone %q", record.GetString("timezone"))
+	}
+
+	loc := helpers.LoadLocation(PostTimezone(app, record))
+	local := strings.TrimSpace(record.GetString("publish_at_local"))
+	original := record.Original()
+	localChanged := local != "" && (record.IsNew() ||
+		local != original.GetString("publish_at_local") ||
+		record.GetString("timezone") != original.GetString("timezone"))
+
+	if localChanged {
+		publishAt, err := helpers.ParseLocalTime(local, loc)
+		if err != nil {
+			return err
+		}
+		record.Set("publish_at", publishAt.UTC())
+	}
+
+	if publishAt := record.GetDateTime("publish_at"); !publishAt.IsZero() {
+		record.Set("publish_at_local", publishAt.Time().In(loc).Format(helpers.LocalTimeLayout))
+	}
+	return nil
+}
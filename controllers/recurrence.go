@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const recurringBatchSize = 100
+
+// ExpandRecurringPosts turns every recurring series whose next occurrence is
+// due into a concrete scheduled post. The series record itself is never
+// published: its publish_at always points at the next occurrence and it is
+// marked "completed" once COUNT or UNTIL is reached.
+func ExpandRecurringPosts(app *pocketbase.PocketBase) {
+	series, err := app.FindRecordsByFilter(
+		"posts",
+		"recurrence != '' && status = 'scheduled' && deleted = '' && publish_at <= @now",
+		"publish_at",
+		recurringBatchSize,
+		0,
+	)
+	if err != nil {
+		app.Logger().Error("Failed to fetch recurring posts", "error", err.Error())
+		return
+	}
+
+	for _, record := range series {
+		if err := expandSeries(app, record.Id); err != nil {
+			markPostFailed(app, record.Id, "recurrence: failed to expand series", err)
+		}
+	}
+}
+
+func expandSeries(app *pocketbase.PocketBase, seriesId string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		// re-read inside the transaction so concurrent ticks don't expand twice
+		series, err := txApp.FindRecordById("posts", seriesId)
+		if err != nil {
+			return err
+		}
+		if series.GetString("status") != "scheduled" || series.GetDateTime("publish_at").Time().After(time.Now()) {
+			return nil
+		}
+
+		rule, err := helpers.ParseRRule(series.GetString("recurrence"))
+		if err != nil {
+			return err
+		}
+
+		// expand in the post's timezone so wall-clock times survive DST changes
+		loc := helpers.LoadLocation(PostTimezone(txApp, series))
+		occurrence := series.GetDateTime("publish_at").Time().In(loc)
+		start := series.GetDateTime("recurrence_start").Time().In(loc)
+		if start.IsZero() {
+			start = occurrence
+			series.Set("recurrence_start", start)
+		}
+		count := series.GetInt("occurrence_count")
+		now := time.Now()
+
+		// only the latest due occurrence is published; ones missed while the
+		// scheduler was down are skipped but still count towards COUNT
+		for {
+			next, ok := rule.Next(start, occurrence)
+			if !ok || next.After(now) || (rule.Count > 0 && count+1 >= rule.Count) {
+				break
+			}
+			app.Logger().Warn("Skipping missed recurring occurrence", "seriesId", seriesId, "occurrence", occurrence)
+			occurrence = next
+			count++
+		}
+
+		if err := createOccurrence(app, txApp, series, occurrence); err != nil {
+			return err
+		}
+		count++
+		series.Set("occurrence_count", count)
+
+		next, ok := rule.Next(start, occurrence)
+		if !ok || (rule.Count > 0 && count >= rule.Count) {
+			series.Set("status", "completed")
+			app.Logger().Info("Recurring series completed", "seriesId", seriesId, "occurrences", count)
+		} else {
+			series.Set("publish_at", next)
+		}
+
+		return txApp.Save(series)
+	})
+}
+
+func createOccurrence(app *pocketbase.PocketBase, txApp core.App, series *core.Record, occurrence time.Time) error {
+	existing, err := txApp.FindFirstRecordByFilter(
+		"posts",
+		"recurrence_parent = {:parent} && occurrence_at = {:occurrence}",
+		dbx.Params{"parent": series.Id, "occurrence": occurrence.UTC().Format("2006-01-02 15:04:05.000Z")},
+	)
+	if err == nil && existing != nil {
+		return nil
+	}
+
+	instance := core.NewRecord(series.Collection())
+	for _, field := range []string{"title", "content", "link", "type", "group_id", "connection", "user", "timezone", "review_decision", "reviewed_by", "reviewed_at", "review_comment", "variants", "thread_parts"} {
+		instance.Set(field, series.Get(field))
+	}
+	instance.Set("status", "scheduled")
+	instance.Set("publish_at", occurrence)
+	instance.Set("occurrence_at", occurrence)
+	instance.Set("recurrence_parent", series.Id)
+
+	for _, field := range postFileFields {
+		names := series.GetStringSlice(field)
+		if len(names) == 0 {
+			continue
+		}
+		files, err := copyPostFiles(app, series, names)
+		if err != nil {
+			return fmt.Errorf("failed to copy media for occurrence: %w", err)
+		}
+		instance.Set(field, files)
+	}
+
+	if err := txApp.Save(instance); err != nil {
+		return err
+	}
+	app.Logger().Info("Recurring occurrence created", "seriesId", series.Id, "postId", instance.Id, "publishAt", occurrence)
+	return nil
+}
+
+func copyPostFiles(app *pocketbase.PocketBase, record *core.Record, names []string) ([]*filesystem.File, error) {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	files := make([]*filesystem.File, 0, len(names))
+	for _, name := range names {
+		file, err := fsys.GetReuploadableFile(record.BaseFilesPath()+"/"+name, true)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
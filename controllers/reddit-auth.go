@@ -3,6 +3,7 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -36,12 +37,10 @@ func SetupRedditRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 		return nil
 	})
 	se.Router.GET("/api/v1/reddit/post", func(e *core.RequestEvent) error {
-		PostToReddit(e)
-		return nil
+		return PostToReddit(e, app)
 	})
 	se.Router.GET("/api/v1/reddit/analytics", func(e *core.RequestEvent) error {
-		GetRedditAnalytics(e)
-		return nil
+		return GetRedditAnalytics(e, app)
 	})
 }
 
@@ -49,11 +48,23 @@ func BeginRedditAuth(e *core.RequestEvent) {
 	var clientID string = os.Getenv("REDDIT_CLIENT_ID")
 	var redirectURL string = os.Getenv("API_HOST") + "/api/v1/auth/reddit/callback"
 	var scopes string = RedditOAuthScopes()
-	//
-	state := os.Getenv("JWT_KEY")
-	url := fmt.Sprintf("https://www.reddit.com/api/v1/authorize?client_id=%s&response_type=code&state=%s&redirect_uri=%s&duration=permanent&scope=%s", clientID, state, redirectURL, scopes)
 
-	http.Redirect(e.Response, e.Request, url, http.StatusTemporaryRedirect)
+	flow, err := newOAuthFlow(e, "reddit", true)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+	params := url.Values{
+		"client_id":             {clientID},
+		"response_type":         {"code"},
+		"state":                 {flow.State},
+		"redirect_uri":          {redirectURL},
+		"duration":              {"permanent"},
+		"scope":                 {scopes},
+		"code_challenge":        {flow.Challenge()},
+		"code_challenge_method": {"S256"},
+	}
+	startOAuth(e, "https://www.reddit.com/api/v1/authorize?"+params.Encode())
 }
 
 type RedditTokenResponse struct {
@@ -67,15 +78,15 @@ func RedditOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
 	var clientSecret string = os.Getenv("REDDIT_SECRET")
 	var redirectURL string = os.Getenv("API_HOST") + "/api/v1/auth/reddit/callback"
 
-	state := e.Request.URL.Query().Get("state")
-	if state != os.Getenv("JWT_KEY") {
-		helpers.Error(e, "Invalid state")
+	flow, err := finishOAuthFlow(e, "reddit")
+	if err != nil {
+		redirectWithError(e, "reddit", err.Error())
 		return
 	}
 
 	code := e.Request.URL.Query().Get("code")
 	if code == "" {
-		helpers.Error(e, "Code not found")
+		redirectWithError(e, "reddit", "Code not found")
 		return
 	}
 
@@ -93,15 +104,19 @@ func RedditOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
 	data.Set("grant_type", "authorization_code")
 	data.Set("code", code)
 	data.Set("redirect_uri", redirectURL)
+	data.Set("code_verifier", flow.Verifier)
 	resp, err := helpers.MakeHTTPRequest[RedditTokenResponse](app, method, exchangeUrl, header, nil, data)
 	if err != nil {
-		helpers.Error(e, "Error in reddit token exchange")
+		redirectWithError(e, "reddit", "Error in reddit token exchange")
 		app.Logger().Error("Error in reddit token exchange", "error", err.Error())
 		return
 	}
 
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-	e.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/connect/reddit?accessToken=%s&refreshToken=%s&expiresIn=%d", redirectHost, resp.AccessToken, resp.RefreshToken, resp.ExpiresIn))
+	redirectWithHandoff(e, app, flow, tasks.OAuthHandoff{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		ExpiresIn:    int64(resp.ExpiresIn),
+	})
 
 }
 
@@ -120,10 +135,13 @@ type RedditUserDetails struct {
 
 func AddRedditConnection(e *core.RequestEvent, app *pocketbase.PocketBase) {
 
-	accessToken := e.Request.URL.Query().Get("accessToken")
-	refreshToken := e.Request.URL.Query().Get("refreshToken")
-	authUserId := e.Request.URL.Query().Get("userId")
-	expiresIn := e.Request.URL.Query().Get("expiresIn")
+	handoff, ok := redeemHandoff(e, app, "reddit")
+	if !ok {
+		return
+	}
+	accessToken := handoff.AccessToken
+	refreshToken := handoff.RefreshToken
+	authUserId := e.Auth.Id
 
 	reqUrl := "https://oauth.reddit.com/api/v1/me"
 	header := map[string]string{
@@ -144,10 +162,11 @@ func AddRedditConnection(e *core.RequestEvent, app *pocketbase.PocketBase) {
 		ConnectionName: "reddit",
 		ConnectionId:   resp.Name,
 		AccessToken:    accessToken,
-		MetaData:       "expiresIn=" + expiresIn,
+		MetaData:       "",
 		ProfileImage:   resp.SnoovatarImg,
 		Username:       resp.Name,
 		RefreshToken:   refreshToken,
+		ExpiresAt:      expiryTime(handoff.ExpiresIn),
 	}
 
 	err = AddNewConnection(app, &userData)
@@ -162,22 +181,41 @@ func AddRedditConnection(e *core.RequestEvent, app *pocketbase.PocketBase) {
 	return
 }
 
-func PostToReddit(e *core.RequestEvent) error {
+// redditConnection loads the caller's Reddit connection named by the
+// `connection` query parameter and returns it with its decrypted token.
+func redditConnection(e *core.RequestEvent, app *pocketbase.PocketBase) (*core.Record, string, bool) {
+	connection, err := app.FindRecordById("connections", e.Request.URL.Query().Get("connection"))
+	if err != nil || connection.GetString("user") != e.Auth.Id || connection.GetString("connection_name") != "reddit" || connection.GetString("deleted") != "" {
+		helpers.Error(e, "Connection not found")
+		return nil, "", false
+	}
+	token, err := tasks.ConnectionAccessToken(connection)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return nil, "", false
+	}
+	return connection, token, true
+}
+
+func PostToReddit(e *core.RequestEvent, app *pocketbase.PocketBase) error {
 	subreddit := e.Request.URL.Query().Get("subreddit")
 	title := e.Request.URL.Query().Get("title")
 	text := e.Request.URL.Query().Get("text")
-	token := e.Request.URL.Query().Get("accessToken")
 
-	if subreddit == "" || title == "" || token == "" {
+	if subreddit == "" || title == "" {
 		helpers.Error(e, "Missing required fields")
 		return nil
 	}
+	connection, token, ok := redditConnection(e, app)
+	if !ok {
+		return nil
+	}
 
-	req, _ := http.NewRequest("POST", "https://oauth.reddit.com/api/submit", strings.NewReader("sr="+subreddit+"&title="+title+"&text="+text+"&kind=self"))
+	form := url.Values{"sr": {subreddit}, "title": {title}, "text": {text}, "kind": {"self"}}
+	req, _ := http.NewRequest("POST", "https://oauth.reddit.com/api/submit", strings.NewReader(form.Encode()))
 	req.Header.Set("Authorization", "bearer "+token)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := tasks.PlatformClient("reddit", connection.Id).Do(req)
 	if err != nil {
 		helpers.Error(e, "Failed to post: "+err.Error())
 		return nil
@@ -190,18 +228,20 @@ func PostToReddit(e *core.RequestEvent) error {
 	return nil
 }
 
-func GetRedditAnalytics(e *core.RequestEvent) error {
+func GetRedditAnalytics(e *core.RequestEvent, app *pocketbase.PocketBase) error {
 	postID := e.Request.URL.Query().Get("postId")
-	token := e.Request.URL.Query().Get("accessToken")
-	if postID == "" || token == "" {
-		helpers.Error(e, "Missing postId or accessToken")
+	if postID == "" {
+		helpers.Error(e, "Missing postId")
+		return nil
+	}
+	connection, token, ok := redditConnection(e, app)
+	if !ok {
 		return nil
 	}
 
-	req, _ := http.NewRequest("GET", "https://oauth.reddit.com/api/info?id=t3_"+postID, nil)
+	req, _ := http.NewRequest("GET", "https://oauth.reddit.com/api/info?"+url.Values{"id": {"t3_" + postID}}.Encode(), nil)
 	req.Header.Set("Authorization", "bearer "+token)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := tasks.PlatformClient("reddit", connection.Id).Do(req)
 	if err != nil {
 		helpers.Error(e, "Failed to get analytics: "+err.Error())
 		return nil
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const PostStatusFailed = "failed"
+
+// upper bound for one bulk retry call
+const maxBulkRetry = 500
+
+type reschedulePostRequest struct {
+	PublishAt      string `json:"publish_at"`
+	PublishAtLocal string `json:"publish_at_local"`
+}
+
+type bulkRetryRequest struct {
+	Connection string `json:"connection"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	ErrorClass string `json:"error_class"`
+}
+
+func SetupRetryRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.POST("/api/v1/posts/{id}/retry", func(e *core.RequestEvent) error {
+		RetryPost(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.POST("/api/v1/posts/{id}/reschedule", func(e *core.RequestEvent) error {
+		ReschedulePost(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.POST("/api/v1/posts/retry-failed", func(e *core.RequestEvent) error {
+		RetryFailedPosts(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.GET("/api/v1/posts/{id}/attempts", func(e *core.RequestEvent) error {
+		GetPostAttempts(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// RetryPost puts a failed post back in the schedule to be published now.
+func RetryPost(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	post, ok := findFailedPost(e, app)
+	if !ok {
+		return
+	}
+	if err := requeuePost(app, post, time.Now(), ""); err != nil {
+		helpers.Error(e, "Failed to retry post: "+err.Error())
+		return
+	}
+	app.Logger().Info("Failed post retried", "postId", post.Id, "user", e.Auth.Id)
+	helpers.Success(e, "Post queued for retry", requeuedPost(post))
+}
+
+// ReschedulePost puts a failed post back in the schedule at a new time, given
+// as publish_at (UTC) or publish_at_local (in the post's timezone).
+func ReschedulePost(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	var body reschedulePostRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+		helpers.Error(e, "Invalid request body")
+		return
+	}
+	var publishAt time.Time
+	if strings.TrimSpace(body.PublishAtLocal) == "" {
+		parsed, err := types.ParseDateTime(body.PublishAt)
+		if err != nil || parsed.IsZero() {
+			helpers.Error(e, "publish_at or publish_at_local is required")
+			return
+		}
+		publishAt = parsed.Time()
+	}
+
+	post, ok := findFailedPost(e, app)
+	if !ok {
+		return
+	}
+	if err := requeuePost(app, post, publishAt, strings.TrimSpace(body.PublishAtLocal)); err != nil {
+		helpers.Error(e, "Failed to reschedule post: "+err.Error())
+		return
+	}
+	app.Logger().Info("Failed post rescheduled", "postId", post.Id, "publishAt", post.GetDateTime("publish_at").String(), "user", e.Auth.Id)
+	helpers.Success(e, "Post rescheduled", requeuedPost(post))
+}
+
+// RetryFailedPosts retries every failed post of the caller, optionally only
+// for one connection, a publish_at range (from/to) or an error_class.
+func RetryFailedPosts(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	var body bulkRetryRequest
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+			helpers.Error(e, "Invalid request body")
+			return
+		}
+	}
+
+	filter := "user = {:user} && status = {:status} && deleted = ''"
+	params := dbx.Params{"user": e.Auth.Id, "status": PostStatusFailed}
+	if body.Connection != "" {
+		filter += " && connection = {:connection}"
+		params["connection"] = body.Connection
+	}
+	if body.ErrorClass != "" {
+		filter += " && error_class = {:errorClass}"
+		params["errorClass"] = body.ErrorClass
+	}
+	for _, bound := range []struct{ key, value, op string }{{"from", body.From, ">="}, {"to", body.To, "<="}} {
+		if bound.value == "" {
+			continue
+		}
+		parsed, err := types.ParseDateTime(bound.value)
+		if err != nil || parsed.IsZero() {
+			helpers.Error(e, "Invalid "+bound.key+" date")
+			return
+		}
+		filter += " && publish_at " + bound.op + " {:" + bound.key + "}"
+		params[bound.key] = parsed.String()
+	}
+
+	posts, err := app.FindRecordsByFilter("posts", filter, "publish_at", maxBulkRetry, 0, params)
+	if err != nil {
+		helpers.Error(e, "Failed to load failed posts")
+		return
+	}
+
+	retried := []string{}
+	errs := map[string]string{}
+	now := time.Now()
+	for _, post := range posts {
+		if err := requeuePost(app, post, now, ""); err != nil {
+			errs[post.Id] = err.Error()
+			continue
+		}
+		retried = append(retried, post.Id)
+	}
+	app.Logger().Info("Bulk retry of failed posts", "user", e.Auth.Id, "retried", len(retried), "failed", len(errs))
+
+	helpers.Success(e, "", map[string]interface{}{
+		"retried": retried,
+		"errors":  errs,
+	})
+}
+
+// GetPostAttempts returns the publish attempt history of a post, oldest first.
+func GetPostAttempts(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	post, err := app.FindRecordById("posts", e.Request.PathValue("id"))
+	if err != nil || post.GetString("user") != e.Auth.Id {
+		helpers.Error(e, "Post not found")
+		return
+	}
+	attempts := []*core.Record{}
+	if _, err := app.FindCollectionByNameOrId("publish_attempts"); err == nil {
+		attempts, err = app.FindRecordsByFilter("publish_attempts", "post = {:post}", "started_at", 0, 0, dbx.Params{"post": post.Id})
+		if err != nil {
+			helpers.Error(e, "Failed to load attempts")
+			return
+		}
+	}
+	helpers.Success(e, "", attempts)
+}
+
+func findFailedPost(e *core.RequestEvent, app *pocketbase.PocketBase) (*core.Record, bool) {
+	post, err := app.FindRecordById("posts", e.Request.PathValue("id"))
+	if err != nil || post.GetString("user") != e.Auth.Id || post.GetString("deleted") != "" {
+		helpers.Error(e, "Post not found")
+		return nil, false
+	}
+	if post.GetString("status") != PostStatusFailed {
+		helpers.Error(e, "Only failed posts can be retried")
+		return nil, false
+	}
+	return post, true
+}
+
+// requeuePost moves a failed post back to "scheduled". The scheduler then
+// treats it like any other due post, so pauses, approval and validation still
+// apply, and the new attempts are added to its history.
+func requeuePost(app core.App, post *core.Record, publishAt time.Time, publishAtLocal string) error {
+	post.Set("status", PostStatusScheduled)
+	post.Set("error_class", "")
+	post.Set("lease_owner", "")
+	post.Set("lease_expires_at", "")
+	if publishAtLocal != "" {
+		post.Set("publish_at_local", publishAtLocal)
+	} else {
+		post.Set("publish_at", publishAt.UTC())
+	}
+	return app.Save(post)
+}
+
+func requeuedPost(post *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               post.Id,
+		"status":           post.GetString("status"),
+		"publish_at":       post.GetDateTime("publish_at"),
+		"publish_at_local": post.GetString("publish_at_local"),
+	}
+}
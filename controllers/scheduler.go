@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"container/heap"
+	"content-clock/tasks"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// publishScheduler keeps a timer queue of upcoming publish_at values and runs
+// the publisher at the scheduled second. The minute cron stays as a safety net
+// for other instances' writes and for queued retries.
+type publishScheduler struct {
+	mu      sync.Mutex
+	entries scheduleHeap
+	byPost  map[string]*scheduleEntry
+	timer   *time.Timer
+
+	running atomic.Bool
+	pending atomic.Bool
+}
+
+type scheduleEntry struct {
+	postId string
+	at     time.Time
+	index  int
+}
+
+type scheduleHeap []*scheduleEntry
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *scheduleHeap) Push(x any) {
+	entry := x.(*scheduleEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+func (h *scheduleHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	entry.index = -1
+	return entry
+}
+
+var scheduler = &publishScheduler{byPost: map[string]*scheduleEntry{}}
+
+type upcomingPost struct {
+	Id        string `db:"id"`
+	PublishAt string `db:"publish_at"`
+}
+
+// StartScheduler loads every upcoming scheduled post into the timer queue.
+// It must run after the collections exist.
+func StartScheduler(app *pocketbase.PocketBase) {
+	if err := EnsureTables(app, "posts"); err != nil {
+		app.Logger().Warn("Skipping publish scheduler", "error", err.Error())
+		return
+	}
+
+	var rows []upcomingPost
+	err := app.DB().NewQuery(`SELECT id, publish_at FROM posts
+			WHERE status = 'scheduled'
+			AND coalesce(deleted, '') = ''
+			AND coalesce(publish_at, '') != '';`).All(&rows)
+	if err != nil {
+		app.Logger().Error("Failed to load upcoming posts into scheduler", "error", err.Error())
+		return
+	}
+
+	for _, row := range rows {
+		publishAt, err := time.Parse("2006-01-02 15:04:05.000Z", row.PublishAt)
+		if err != nil {
+			continue
+		}
+		scheduler.schedule(app, row.Id, publishAt)
+	}
+	app.Logger().Info("Publish scheduler started", "upcoming", len(rows))
+}
+
+// SetupSchedulerHooks keeps the timer queue in sync with posts records.
+func SetupSchedulerHooks(app *pocketbase.PocketBase) {
+	track := func(e *core.RecordEvent) error {
+		record := e.Record
+		publishAt := record.GetDateTime("publish_at")
+		if record.GetString("status") == "scheduled" && record.GetString("deleted") == "" && !publishAt.IsZero() {
+			scheduler.schedule(app, record.Id, publishAt.Time())
+		} else {
+			scheduler.remove(record.Id)
+		}
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess("posts").BindFunc(track)
+	app.OnRecordAfterUpdateSuccess("posts").BindFunc(track)
+	app.OnRecordAfterDeleteSuccess("posts").BindFunc(func(e *core.RecordEvent) error {
+		scheduler.remove(e.Record.Id)
+		return e.Next()
+	})
+}
+
+// RunPublisher publishes every due post and dispatches queued jobs. Calls
+// that arrive while a run is in progress are coalesced into one more run.
+func RunPublisher(app *pocketbase.PocketBase) {
+	scheduler.pending.Store(true)
+	for scheduler.pending.Load() {
+		if !scheduler.running.CompareAndSwap(false, true) {
+			return
+		}
+		scheduler.pending.Store(false)
+		GetScheduledPosts(app)
+		tasks.ProcessQueue(app)
+		scheduler.running.Store(false)
+	}
+}
+
+func (s *publishScheduler) schedule(app *pocketbase.PocketBase, postId string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.byPost[postId]; ok {
+		entry.at = at
+		heap.Fix(&s.entries, entry.index)
+	} else {
+		entry := &scheduleEntry{postId: postId, at: at}
+		heap.Push(&s.entries, entry)
+		s.byPost[postId] = entry
+	}
+	s.arm(app)
+}
+
+func (s *publishScheduler) remove(postId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.byPost[postId]; ok {
+		heap.Remove(&s.entries, entry.index)
+		delete(s.byPost, postId)
+	}
+	if len(s.entries) == 0 && s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+// arm points the single timer at the earliest entry. Callers hold s.mu.
+func (s *publishScheduler) arm(app *pocketbase.PocketBase) {
+	if len(s.entries) == 0 {
+		return
+	}
+	delay := time.Until(s.entries[0].at)
+	if delay < 0 {
+		delay = 0
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(delay, func() { s.fire(app) })
+		return
+	}
+	s.timer.Stop()
+	s.timer.Reset(delay)
+}
+
+func (s *publishScheduler) fire(app *pocketbase.PocketBase) {
+	s.mu.Lock()
+	now := time.Now()
+	due := 0
+	for len(s.entries) > 0 && !s.entries[0].at.After(now) {
+		entry := heap.Pop(&s.entries).(*scheduleEntry)
+		delete(s.byPost, entry.postId)
+		due++
+	}
+	s.arm(app)
+	s.mu.Unlock()
+
+	if due > 0 {
+		RunPublisher(app)
+	}
+}
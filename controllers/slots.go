@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// PostingSlot is one entry of a connection's weekly slot template, in the
+// connection's timezone.
+type PostingSlot struct {
+	Day  string `json:"day"`  // mon, tue, ... sun
+	Time string `json:"time"` // HH:MM
+}
+
+type slotTime struct {
+	weekday time.Weekday
+	hour    int
+	minute  int
+}
+
+// how far ahead the queue looks for a free slot
+const slotSearchWeeks = 52
+
+var slotWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func SetupSlotRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.POST("/api/v1/posts/{id}/queue", func(e *core.RequestEvent) error {
+		AddPostToQueue(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.GET("/api/v1/connections/{id}/slots", func(e *core.RequestEvent) error {
+		GetNextFreeSlots(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// AddPostToQueue schedules a post into the next free slot of its connection.
+func AddPostToQueue(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	post, err := app.FindRecordById("posts", e.Request.PathValue("id"))
+	if err != nil || post.GetString("user") != e.Auth.Id {
+		helpers.Error(e, "Post not found")
+		return
+	}
+	if post.GetString("deleted") != "" {
+		helpers.Error(e, "Post is deleted")
+		return
+	}
+	if post.GetString("recurrence") != "" {
+		helpers.Error(e, "Recurring posts cannot be queued")
+		return
+	}
+	switch post.GetString("status") {
+	case "sending", "retrying", "published", PostStatusRejected:
+		helpers.Error(e, "Post has already been sent")
+		return
+	}
+
+	connection, err := app.FindRecordById("connections", post.GetString("connection"))
+	if err != nil {
+		helpers.Error(e, "Connection not found")
+		return
+	}
+
+	slots, err := nextFreeSlots(app, connection, time.Now(), 1, post.Id)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+
+	post.Set("publish_at", slots[0])
+	post.Set("queued", true)
+	if connection.GetBool("requires_approval") && !IsApproved(post) {
+		post.Set("status", PostStatusPendingApproval)
+	} else {
+		post.Set("status", PostStatusScheduled)
+	}
+	if err := app.Save(post); err != nil {
+		app.Logger().Error("Failed to queue post", "postId", post.Id, "error", err.Error())
+		helpers.Error(e, "Failed to queue post")
+		return
+	}
+
+	helpers.Success(e, "Post added to queue", map[string]interface{}{
+		"id":         post.Id,
+		"publish_at": post.GetDateTime("publish_at"),
+	})
+}
+
+// GetNextFreeSlots lists the upcoming free slots of a connection.
+func GetNextFreeSlots(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	connection, err := app.FindRecordById("connections", e.Request.PathValue("id"))
+	if err != nil || connection.GetString("user") != e.Auth.Id {
+		helpers.Error(e, "Connection not found")
+		return
+	}
+
+	count, _ := strconv.Atoi(e.Request.URL.Query().Get("count"))
+	if count < 1 || count > 50 {
+		count = 10
+	}
+
+	slots, err := nextFreeSlots(app, connection, time.Now(), count, "")
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+	helpers.Success(e, "", slots)
+}
+
+// ParsePostingSlots validates a connection's posting_slots value.
+func ParsePostingSlots(connection *core.Record) ([]slotTime, error) {
+	var slots []PostingSlot
+	if err := connection.UnmarshalJSONField("posting_slots", &slots); err != nil {
+		return nil, fmt.Errorf("invalid posting_slots: %w", err)
+	}
+
+	parsed := make([]slotTime, 0, len(slots))
+	for _, slot := range slots {
+		weekday, ok := slotWeekdays[strings.ToLower(strings.TrimSpace(slot.Day))]
+		if !ok {
+			return nil, fmt.Errorf("invalid slot day %q", slot.Day)
+		}
+		clock, err := time.Parse("15:04", strings.TrimSpace(slot.Time))
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot time %q (use HH:MM)", slot.Time)
+		}
+		parsed = append(parsed, slotTime{weekday: weekday, hour: clock.Hour(), minute: clock.Minute()})
+	}
+	return parsed, nil
+}
+
+// nextFreeSlots returns up to count slot times after `from` that no other
+// scheduled post of the connection occupies. ignorePostId lets a post that is
+// being re-queued release its current slot.
+func nextFreeSlots(app *pocketbase.PocketBase, connection *core.Record, from time.Time, count int, ignorePostId string) ([]time.Time, error) {
+	slots, err := ParsePostingSlots(connection)
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("connection has no posting slots configured")
+	}
+
+	occupied, err := occupiedSlots(app, connection.Id, ignorePostId)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := helpers.LoadLocation(connection.GetString("timezone"))
+	local := from.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	free := make([]time.Time, 0, count)
+	for i := 0; i < slotSearchWeeks*7 && len(free) < count; i++ {
+		candidateDay := day.AddDate(0, 0, i)
+		var dayTimes []time.Time
+		for _, slot := range slots {
+			if slot.weekday != candidateDay.Weekday() {
+				continue
+			}
+			dayTimes = append(dayTimes, time.Date(candidateDay.Year(), candidateDay.Month(), candidateDay.Day(), slot.hour, slot.minute, 0, 0, loc))
+		}
+		sort.Slice(dayTimes, func(a, b int) bool { return dayTimes[a].Before(dayTimes[b]) })
+
+		for _, candidate := range dayTimes {
+			if !candidate.After(from) || occupied[candidate.UTC().Unix()] {
+				continue
+			}
+			free = append(free, candidate.UTC())
+			if len(free) == count {
+				break
+			}
+		}
+	}
+
+	if len(free) == 0 {
+		return nil, fmt.Errorf("no free posting slot in the next %d weeks", slotSearchWeeks)
+	}
+	return free, nil
+}
+
+type occupiedSlot struct {
+	PublishAt string `db:"publish_at"`
+}
+
+func occupiedSlots(app *pocketbase.PocketBase, connectionId string, ignorePostId string) (map[int64]bool, error) {
+	var rows []occupiedSlot
+	err := app.DB().Select("publish_at").From("posts").Where(dbx.NewExp(
+		"connection = {:connection} AND status = 'scheduled' AND coalesce(deleted, '') = '' AND id != {:ignore} AND datetime(publish_at) >= datetime('now')",
+		dbx.Params{"connection": connectionId, "ignore": ignorePostId},
+	)).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	occupied := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		publishAt, err := time.Parse("2006-01-02 15:04:05.000Z", row.PublishAt)
+		if err != nil {
+			continue
+		}
+		occupied[publishAt.Unix()] = true
+	}
+	return occupied, nil
+}
+
+// reflowQueue moves every later queued post of the connection up by one
+// position after the post at vacated left the queue.
+func reflowQueue(app *pocketbase.PocketBase, connectionId string, vacated time.Time) {
+	later, err := app.FindRecordsByFilter(
+		"posts",
+		"connection = {:connection} && queued = true && status = 'scheduled' && deleted = '' && publish_at > {:vacated}",
+		"publish_at",
+		0,
+		0,
+		dbx.Params{"connection": connectionId, "vacated": vacated.UTC().Format("2006-01-02 15:04:05.000Z")},
+	)
+	if err != nil {
+		app.Logger().Error("Failed to load queued posts for reflow", "connection", connectionId, "error", err.Error())
+		return
+	}
+
+	for _, post := range later {
+		previous := post.GetDateTime("publish_at").Time()
+		post.Set("publish_at", vacated)
+		if err := app.Save(post); err != nil {
+			app.Logger().Error("Failed to move queued post up", "postId", post.Id, "error", err.Error())
+			return
+		}
+		vacated = previous
+	}
+	if len(later) > 0 {
+		app.Logger().Info("Queue reflowed after removal", "connection", connectionId, "moved", len(later))
+	}
+}
+
+// SetupSlotHooks keeps posting_slots valid and closes gaps in the queue when
+// a queued post is deleted.
+func SetupSlotHooks(app *pocketbase.PocketBase) {
+	validateSlots := func(e *core.RecordEvent) error {
+		if _, err := ParsePostingSlots(e.Record); err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("connections").BindFunc(validateSlots)
+	app.OnRecordUpdate("connections").BindFunc(validateSlots)
+
+	app.OnRecordAfterUpdateSuccess("posts").BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+		wasQueued := original.GetBool("queued") && original.GetString("status") == "scheduled" && original.GetString("deleted") == ""
+		nowRemoved := e.Record.GetString("deleted") != "" || e.Record.GetString("status") == "deleted"
+		if wasQueued && nowRemoved {
+			reflowQueue(app, original.GetString("connection"), original.GetDateTime("publish_at").Time())
+		}
+		return e.Next()
+	})
+	app.OnRecordAfterDeleteSuccess("posts").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetBool("queued") && e.Record.GetString("status") == "scheduled" {
+			reflowQueue(app, e.Record.GetString("connection"), e.Record.GetDateTime("publish_at").Time())
+		}
+		return e.Next()
+	})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -37,11 +38,19 @@ func BeginThreadsAuth(e *core.RequestEvent, app *pocketbase.PocketBase) {
 		return
 	}
 
-	callbackUrl := apiHost + "/api/v1/auth/threads/callback"
-	scopes := ThreadsOAuthScopes()
-
-	redirectUrl := fmt.Sprintf("https://threads.net/oauth/authorize?client_id=%s&redirect_uri=%s&response_type=code&scope=%s", threadsAppId, callbackUrl, scopes)
-	e.Redirect(http.StatusTemporaryRedirect, redirectUrl)
+	flow, err := newOAuthFlow(e, "threads", false)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+	params := url.Values{
+		"client_id":     {threadsAppId},
+		"redirect_uri":  {apiHost + "/api/v1/auth/threads/callback"},
+		"response_type": {"code"},
+		"scope":         {ThreadsOAuthScopes()},
+		"state":         {flow.State},
+	}
+	startOAuth(e, "https://threads.net/oauth/authorize?"+params.Encode())
 }
 
 type TokenResponse struct {
@@ -51,9 +60,15 @@ type TokenResponse struct {
 
 type LongLivedTokenResponse struct {
 	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
 }
 
 func ThreadsOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	flow, err := finishOAuthFlow(e, "threads")
+	if err != nil {
+		redirectWithError(e, "threads", err.Error())
+		return
+	}
 	var apiHost string = os.Getenv("API_HOST")
 	code := e.Request.URL.Query().Get("code")
 	var url string = "https://graph.threads.net/oauth/access_token"
@@ -76,11 +91,10 @@ func ThreadsOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
 		return
 	}
 
-	var accessToken string = resp.AccessToken
-	var userId any = resp.UserId
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-	e.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/connect/threads?accessToken=%s&userId=%v", redirectHost, accessToken, userId))
-	return
+	redirectWithHandoff(e, app, flow, tasks.OAuthHandoff{
+		AccessToken: resp.AccessToken,
+		AccountId:   fmt.Sprintf("%v", resp.UserId),
+	})
 }
 
 type ThreadsProfileResponse struct {
@@ -91,9 +105,13 @@ type ThreadsProfileResponse struct {
 }
 
 func AddThreadsAccounts(e *core.RequestEvent, app *pocketbase.PocketBase) {
-	userId := e.Request.URL.Query().Get("threadsUserId")
-	accessToken := e.Request.URL.Query().Get("accessToken")
-	authUserId := e.Request.URL.Query().Get("userId")
+	handoff, ok := redeemHandoff(e, app, "threads")
+	if !ok {
+		return
+	}
+	userId := handoff.AccountId
+	accessToken := handoff.AccessToken
+	authUserId := e.Auth.Id
 
 	if userId == "" || accessToken == "" || authUserId == "" {
 		helpers.Error(e, "Missing required parameters")
@@ -140,6 +158,7 @@ func AddThreadsAccounts(e *core.RequestEvent, app *pocketbase.PocketBase) {
 		ProfileImage:   resp.Image,
 		Username:       resp.Username,
 		RefreshToken:   "",
+		ExpiresAt:      expiryTime(lResp.ExpiresIn),
 	}
 
 	err = AddNewConnection(app, &userData)
@@ -3,15 +3,15 @@ package controllers
 import (
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
+	"context"
 	"fmt"
-	"net/http"
+	"net/url"
 	"os"
 
-	"github.com/markbates/goth"
-	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/twitter"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/oauth2"
 )
 
 func SetupTwitterRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
@@ -20,7 +20,7 @@ func SetupTwitterRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 		return nil
 	})
 	se.Router.GET("/api/v1/auth/twitter/callback", func(e *core.RequestEvent) error {
-		TwitterOAuthCallback(e)
+		TwitterOAuthCallback(e, app)
 		return nil
 	})
 	se.Router.GET("/api/v1/add-twitter-pages", func(e *core.RequestEvent) error {
@@ -29,43 +29,81 @@ func SetupTwitterRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
 	})
 }
 
+// twitterOAuthConfig is X's OAuth 2.0 authorization code flow with PKCE.
+// Connections made earlier with OAuth 1.0a (TWITTER_KEY/TWITTER_SECRET)
+// keep publishing with their stored token and secret.
+func twitterOAuthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("TWITTER_CLIENT_ID"),
+		ClientSecret: os.Getenv("TWITTER_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("API_HOST") + "/api/v1/auth/twitter/callback",
+		Scopes:       []string{"tweet.read", "tweet.write", "users.read", "offline.access", "media.write"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://x.com/i/oauth2/authorize",
+			TokenURL:  "https://api.x.com/2/oauth2/token",
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+	}
+}
+
 func BeginTwitterAuth(e *core.RequestEvent) {
-	var apiHost string = os.Getenv("API_HOST")
-	var twApiKey string = os.Getenv("TWITTER_KEY")
-	var twSecret string = os.Getenv("TWITTER_SECRET")
+	if os.Getenv("TWITTER_CLIENT_ID") == "" || os.Getenv("TWITTER_CLIENT_SECRET") == "" {
+		helpers.Error(e, "Twitter Client ID or Secret is not set")
+		return
+	}
 
-	if twApiKey == "" || twSecret == "" {
-		helpers.Error(e, "Twitter API Key or Secret is not set")
+	flow, err := newOAuthFlow(e, "twitter", true)
+	if err != nil {
+		helpers.Error(e, err.Error())
 		return
 	}
+	startOAuth(e, twitterOAuthConfig().AuthCodeURL(flow.State, flow.AuthCodeOptions()...))
+}
 
-	goth.UseProviders(twitter.New(twApiKey, twSecret, apiHost+"/api/v1/auth/twitter/callback"))
-	q := e.Request.URL.Query()
-	q.Add("provider", "twitter")
-	e.Request.URL.RawQuery = q.Encode()
-	gothic.BeginAuthHandler(e.Response, e.Request)
+// TwitterUser is the users/me response.
+type TwitterUser struct {
+	Data struct {
+		ID              string `json:"id"`
+		Name            string `json:"name"`
+		Username        string `json:"username"`
+		ProfileImageURL string `json:"profile_image_url"`
+	} `json:"data"`
 }
 
-func TwitterOAuthCallback(e *core.RequestEvent) {
-	user, err := gothic.CompleteUserAuth(e.Response, e.Request)
+func TwitterOAuthCallback(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	flow, err := finishOAuthFlow(e, "twitter")
 	if err != nil {
-		helpers.Error(e, err.Error())
+		redirectWithError(e, "twitter", err.Error())
+		return
+	}
+	token, err := twitterOAuthConfig().Exchange(context.Background(), e.Request.URL.Query().Get("code"), flow.ExchangeOptions()...)
+	if err != nil {
+		app.Logger().Error("Twitter: Failed to exchange token: " + err.Error())
+		redirectWithError(e, "twitter", "Failed to exchange token")
+		return
+	}
+
+	user, err := helpers.MakeHTTPRequest[TwitterUser](app, "GET", "https://api.x.com/2/users/me", map[string]string{
+		"Authorization": "Bearer " + token.AccessToken,
+	}, url.Values{"user.fields": {"profile_image_url"}}, nil)
+	if err != nil || user.Data.ID == "" {
+		if err == nil {
+			err = fmt.Errorf("response has no user id")
+		}
+		app.Logger().Error("Twitter: Failed to read user: " + err.Error())
+		redirectWithError(e, "twitter", "Failed to read Twitter user")
 		return
 	}
 
-	var redirectHost string = os.Getenv("REDIRECT_HOST")
-	redirectURL := fmt.Sprintf(
-		"%s/connect/twitter?token=%s&secret=%s&user=%s&name=%s&username=%s&avatar=%s",
-		redirectHost,
-		user.AccessToken,
-		user.AccessTokenSecret,
-		user.UserID,
-		user.Name,
-		user.NickName,
-		user.AvatarURL,
-	)
-
-	e.Redirect(http.StatusTemporaryRedirect, redirectURL)
+	redirectWithHandoff(e, app, flow, tasks.OAuthHandoff{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresIn:    token.ExpiresIn,
+		AccountId:    user.Data.ID,
+		Name:         user.Data.Name,
+		Username:     user.Data.Username,
+		Avatar:       user.Data.ProfileImageURL,
+	})
 }
 
 type TwitterSuccessResponse struct {
@@ -77,32 +115,34 @@ type TwitterSuccessResponse struct {
 }
 
 func AddTwitterPages(e *core.RequestEvent, app *pocketbase.PocketBase) {
-	accessToken := e.Request.URL.Query().Get("token")
-	accessSecret := e.Request.URL.Query().Get("secret")
-	authUserId := e.Request.URL.Query().Get("userId")
-
-	// These come from the redirect query
-	name := e.Request.URL.Query().Get("name")
-	userID := e.Request.URL.Query().Get("user")
-	username := e.Request.URL.Query().Get("username")
-	image := e.Request.URL.Query().Get("avatar")
-	if accessToken == "" || accessSecret == "" || authUserId == "" || userID == "" || name == "" || username == "" || image == "" {
+	handoff, ok := redeemHandoff(e, app, "twitter")
+	if !ok {
+		return
+	}
+	accessToken := handoff.AccessToken
+	authUserId := e.Auth.Id
+
+	// profile details were read by the callback
+	name := handoff.Name
+	userID := handoff.AccountId
+	username := handoff.Username
+	image := handoff.Avatar
+	if accessToken == "" || authUserId == "" || userID == "" || name == "" || username == "" || image == "" {
 		helpers.Error(e, "Missing required parameters")
 		return
 	}
 
-	uAccessToken := accessToken + " " + accessSecret
-
 	userData := models.Connections{
 		UserId:         authUserId,
 		Name:           name,
 		ConnectionName: "twitter",
 		ConnectionId:   userID,
-		AccessToken:    uAccessToken,
+		AccessToken:    accessToken,
 		MetaData:       fmt.Sprintf(`{"user_id": "%s", "username": "%s"}`, userID, username),
 		ProfileImage:   image,
 		Username:       username,
-		RefreshToken:   "", // Twitter OAuth1.0a has no refresh tokens
+		RefreshToken:   handoff.RefreshToken,
+		ExpiresAt:      expiryTime(handoff.ExpiresIn),
 	}
 
 	if err := AddNewConnection(app, &userData); err != nil {
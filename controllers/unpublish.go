@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"content-clock/tasks"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const PostStatusUnpublished = "unpublished"
+
+func SetupUnpublishRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.POST("/api/v1/posts/{id}/unpublish", func(e *core.RequestEvent) error {
+		UnpublishPost(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// UnpublishPost deletes a published post from its platform through the
+// publisher registry. Threads are deleted from the last part to the first;
+// when a part fails, thread_progress keeps the parts still live so the call
+// can be repeated.
+func UnpublishPost(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	post, err := app.FindRecordById("posts", e.Request.PathValue("id"))
+	if err != nil || post.GetString("user") != e.Auth.Id || post.GetString("deleted") != "" {
+		helpers.Error(e, "Post not found")
+		return
+	}
+	if post.GetString("status") != "published" || post.GetString("published_post_id") == "" {
+		helpers.Error(e, "Only published posts can be unpublished")
+		return
+	}
+	connection, err := app.FindRecordById("connections", post.GetString("connection"))
+	if err != nil || connection.GetString("user") != e.Auth.Id {
+		helpers.Error(e, "Connection not found")
+		return
+	}
+	platform := connection.GetString("connection_name")
+	publisher, err := tasks.GetPublisher(platform)
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+	if !publisher.Capabilities().Delete {
+		helpers.Error(e, "Deleting posts is not supported for "+platform)
+		return
+	}
+
+	var parts []string
+	_ = post.UnmarshalJSONField("thread_progress", &parts)
+	if len(parts) == 0 {
+		parts = []string{post.GetString("published_post_id")}
+	}
+	for i := len(parts) - 1; i >= 0; i-- {
+		if err := publisher.Delete(connection.GetString("connection_id"), connection.GetString("access_token"), parts[i]); err != nil {
+			app.Logger().Error("Failed to delete published post", "postId", post.Id, "platform", platform, "publishedPostId", parts[i], "error", err.Error())
+			if i < len(parts)-1 {
+				post.Set("thread_progress", parts[:i+1])
+				if saveErr := app.Save(post); saveErr != nil {
+					app.Logger().Error("Failed to save thread progress", "postId", post.Id, "error", saveErr.Error())
+				}
+			}
+			helpers.Error(e, "Failed to delete the post: "+err.Error())
+			return
+		}
+	}
+
+	post.Set("status", PostStatusUnpublished)
+	post.Set("thread_progress", nil)
+	post.Set("logs", "unpublished: deleted from "+platform)
+	if err := app.Save(post); err != nil {
+		helpers.Error(e, "Post was deleted but could not be updated: "+err.Error())
+		return
+	}
+	app.Logger().Info("Published post deleted", "postId", post.Id, "platform", platform, "user", e.Auth.Id)
+	helpers.Success(e, "Post deleted from "+platform, map[string]interface{}{
+		"id":     post.Id,
+		"status": post.GetString("status"),
+	})
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"content-clock/helpers"
+	"content-clock/tasks"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// fields whose change re-runs validation on an already scheduled post
+var validatedPostFields = []string{"title", "content", "link", "connection", "status", "variants", "thread_parts"}
+
+type validatePostRequest struct {
+	Post       string             `json:"post"`
+	Connection string             `json:"connection"`
+	Title      string             `json:"title"`
+	Content    string             `json:"content"`
+	Link       string             `json:"link"`
+	Images     []string           `json:"images"`
+	Variants   tasks.PostVariants `json:"variants"`
+}
+
+type ValidationResult struct {
+	Valid    bool                    `json:"valid"`
+	Platform string                  `json:"platform"`
+	Issues   []tasks.ValidationIssue `json:"issues"`
+}
+
+func SetupValidationRoutes(se *core.ServeEvent, app *pocketbase.PocketBase) {
+	se.Router.POST("/api/v1/posts/validate", func(e *core.RequestEvent) error {
+		ValidatePost(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+	se.Router.POST("/api/v1/posts/{id}/dry-run", func(e *core.RequestEvent) error {
+		DryRunPost(e, app)
+		return nil
+	}).Bind(apis.RequireAuth())
+}
+
+// SetupValidationHooks rejects scheduled posts that the target platform would
+// refuse, so they fail when saved instead of at publish time. Drafts are not
+// checked.
+func SetupValidationHooks(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		if !needsValidation(e.Record) {
+			return e.Next()
+		}
+		err := ValidatePostRecord(app, e.Record)
+		var validationErr *tasks.ValidationError
+		if errors.As(err, &validationErr) {
+			return apis.NewBadRequestError("Post is not valid for "+validationErr.Platform+".", validationErr.FieldErrors())
+		}
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("posts").BindFunc(validate)
+	app.OnRecordUpdate("posts").BindFunc(validate)
+}
+
+// ValidatePost is the dry-run validation endpoint. It checks either a saved
+// post ({"post": id}) or an unsaved draft sent inline.
+func ValidatePost(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	var body validatePostRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+		helpers.Error(e, "Invalid request body")
+		return
+	}
+
+	var connectionId string
+	var payload tasks.PostToSocialPayload
+	variants := body.Variants
+	if body.Post != "" {
+		post, err := app.FindRecordById("posts", body.Post)
+		if err != nil || post.GetString("user") != e.Auth.Id {
+			helpers.Error(e, "Post not found")
+			return
+		}
+		connectionId = post.GetString("connection")
+		payload = postPayload(post)
+		variants = recordVariants(post)
+	} else {
+		connectionId = body.Connection
+		payload = tasks.PostToSocialPayload{Title: body.Title, Content: body.Content, Link: body.Link, Images: body.Images}
+	}
+
+	connection, err := app.FindRecordById("connections", connectionId)
+	if err != nil || connection.GetString("user") != e.Auth.Id {
+		helpers.Success(e, "", ValidationResult{Issues: []tasks.ValidationIssue{
+			{Field: "connection", Code: "connection_required", Message: "a connection is required"},
+		}})
+		return
+	}
+
+	result := ValidationResult{Valid: true, Platform: connection.GetString("connection_name"), Issues: []tasks.ValidationIssue{}}
+	err = validatePayload(connection, payload, variants)
+	var validationErr *tasks.ValidationError
+	if errors.As(err, &validationErr) {
+		result.Valid = false
+		result.Issues = validationErr.Issues
+	} else if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+	helpers.Success(e, "", result)
+}
+
+// DryRunPost runs a saved post through its platform's publish code with all
+// platform calls recorded instead of sent, and returns those requests along
+// with any validation issues. The post itself is not modified.
+func DryRunPost(e *core.RequestEvent, app *pocketbase.PocketBase) {
+	post, err := app.FindRecordById("posts", e.Request.PathValue("id"))
+	if err != nil || post.GetString("user") != e.Auth.Id {
+		helpers.Error(e, "Post not found")
+		return
+	}
+	connection, err := app.FindRecordById("connections", post.GetString("connection"))
+	if err != nil || connection.GetString("user") != e.Auth.Id {
+		helpers.Error(e, "Connection not found")
+		return
+	}
+	publisher, err := tasks.GetPublisher(connection.GetString("connection_name"))
+	if err != nil {
+		helpers.Error(e, err.Error())
+		return
+	}
+
+	payload := postPayload(post).WithVariant(recordVariants(post), connection.GetString("connection_name"))
+	payload.ConnectionId = connection.GetString("connection_id")
+	payload.AccessToken = connection.GetString("access_token")
+
+	helpers.Success(e, "", tasks.DryRun(app, publisher, payload))
+}
+
+// ValidatePostRecord checks a posts record against its connection's platform.
+func ValidatePostRecord(app core.App, record *core.Record) error {
+	connection, err := app.FindRecordById("connections", record.GetString("connection"))
+	if err != nil {
+		return &tasks.ValidationError{Platform: "unknown", Issues: []tasks.ValidationIssue{
+			{Field: "connection", Code: "connection_required", Message: "a valid connection is required"},
+		}}
+	}
+	return validatePayload(connection, postPayload(record), recordVariants(record))
+}
+
+// validatePayload checks the payload, with the variant for the connection's
+// platform applied, against that platform.
+func validatePayload(connection *core.Record, payload tasks.PostToSocialPayload, variants tasks.PostVariants) error {
+	publisher, err := tasks.GetPublisher(connection.GetString("connection_name"))
+	if err != nil {
+		return err
+	}
+	payload = payload.WithVariant(variants, connection.GetString("connection_name"))
+	payload.ConnectionId = connection.GetString("connection_id")
+	return publisher.Validate(payload)
+}
+
+// postPayload builds the publish payload for a record, including files that
+// are being uploaded with the current request. Variant and thread images are
+// sized too so variants and thread parts that use them can be validated.
+func postPayload(record *core.Record) tasks.PostToSocialPayload {
+	payload := tasks.PostToSocialPayload{
+		Title:        record.GetString("title"),
+		Content:      record.GetString("content"),
+		Link:         record.GetString("link"),
+		SocialPostId: record.Id,
+		MediaSizes:   map[string]int64{},
+	}
+	payload.Images = postFiles(record, "images", payload.MediaSizes)
+	postFiles(record, "variant_images", payload.MediaSizes)
+	postFiles(record, "thread_images", payload.MediaSizes)
+	payload.ThreadParts, _ = tasks.ParseThreadParts(record.GetString("thread_parts"))
+	return payload
+}
+
+// postFiles lists the names of a file field, recording the sizes of files
+// that are being uploaded.
+func postFiles(record *core.Record, field string, sizes map[string]int64) []string {
+	files, ok := record.Get(field).([]any)
+	if !ok {
+		return record.GetStringSlice(field)
+	}
+	var names []string
+	for _, file := range files {
+		switch value := file.(type) {
+		case string:
+			names = append(names, value)
+		case *filesystem.File:
+			names = append(names, value.Name)
+			sizes[value.Name] = value.Size
+		}
+	}
+	return names
+}
+
+// recordVariants returns the post's variants; the post hooks reject records
+// whose variants do not parse.
+func recordVariants(record *core.Record) tasks.PostVariants {
+	variants, _ := tasks.ParseVariants(record.GetString("variants"))
+	return variants
+}
+
+func needsValidation(record *core.Record) bool {
+	if record.GetString("status") != "scheduled" || record.GetString("deleted") != "" {
+		return false
+	}
+	if record.IsNew() {
+		return true
+	}
+	original := record.Original()
+	for _, field := range validatedPostFields {
+		if record.GetString(field) != original.GetString(field) {
+			return true
+		}
+	}
+	for _, field := range postFileFields {
+		if len(record.GetUnsavedFiles(field)) > 0 || !slices.Equal(record.GetStringSlice(field), original.GetStringSlice(field)) {
+			return true
+		}
+	}
+	return false
+}
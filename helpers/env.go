@@ -0,0 +1,20 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetEnvInt reads an integer env variable, returning fallback when it is unset or invalid.
+func GetEnvInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
@@ -3,15 +3,36 @@ package helpers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 )
 
+// default for PUBLISH_HTTP_TIMEOUT_SECONDS: long enough for media uploads,
+// short enough to free a publish worker well before its lease runs out
+const defaultHTTPTimeoutSeconds = 120
+
+// HTTPTimeout is the longest a single platform request may take, including
+// reading its response (PUBLISH_HTTP_TIMEOUT_SECONDS).
+func HTTPTimeout() time.Duration {
+	seconds := GetEnvInt("PUBLISH_HTTP_TIMEOUT_SECONDS", defaultHTTPTimeoutSeconds)
+	if seconds <= 0 {
+		seconds = defaultHTTPTimeoutSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// NewHTTPClient returns a client whose requests give up after HTTPTimeout.
+func NewHTTPClient() *http.Client {
+	return &http.Client{Timeout: HTTPTimeout()}
+}
+
 // Universal HTTP request function
 func MakeHTTPRequest[T any](
 	app *pocketbase.PocketBase,
@@ -20,6 +41,19 @@ func MakeHTTPRequest[T any](
 	headers map[string]string,
 	queryParams url.Values,
 	body interface{},
+) (T, error) {
+	return MakeHTTPRequestWithClient[T](NewHTTPClient(), app, method, fullURL, headers, queryParams, body)
+}
+
+// MakeHTTPRequestWithClient is MakeHTTPRequest with a caller-supplied client.
+func MakeHTTPRequestWithClient[T any](
+	client *http.Client,
+	app *pocketbase.PocketBase,
+	method string,
+	fullURL string,
+	headers map[string]string,
+	queryParams url.Values,
+	body interface{},
 ) (T, error) {
 	var result T
 
@@ -77,7 +111,6 @@ func MakeHTTPRequest[T any](
 	}
 
 	// Send request
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return result, err
@@ -93,7 +126,7 @@ func MakeHTTPRequest[T any](
 	app.Logger().Debug("HTTP response", "url", u.String(), "body", string(respBytes))
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return result, &httpError{Status: resp.Status, Body: string(respBytes)}
+		return result, &httpError{Status: resp.Status, StatusCode: resp.StatusCode, Body: string(respBytes)}
 	}
 
 	// Try to unmarshal the response into result
@@ -105,10 +138,21 @@ func MakeHTTPRequest[T any](
 }
 
 type httpError struct {
-	Status string
-	Body   string
+	Status     string
+	StatusCode int
+	Body       string
 }
 
 func (e *httpError) Error() string {
 	return e.Status + ": " + e.Body
 }
+
+// HTTPErrorResponse returns the status code and body of a non-2xx response
+// returned by MakeHTTPRequest, if err carries one.
+func HTTPErrorResponse(err error) (int, string, bool) {
+	var httpErr *httpError
+	if !errors.As(err, &httpErr) {
+		return 0, "", false
+	}
+	return httpErr.StatusCode, httpErr.Body, true
+}
@@ -0,0 +1,240 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is the subset of RFC 5545 recurrence rules supported for recurring
+// posts: FREQ=DAILY|WEEKLY|MONTHLY with INTERVAL, BYDAY, COUNT and UNTIL.
+type RRule struct {
+	Freq     string
+	Interval int
+	ByDay    []RRuleDay
+	Count    int
+	Until    time.Time
+}
+
+// RRuleDay is a BYDAY entry; Ordinal is only meaningful for MONTHLY rules
+// (1MO = first Monday, -1FR = last Friday, 0 = every matching weekday).
+type RRuleDay struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+// maxRRuleSearchDays bounds the search for the next occurrence.
+const maxRRuleSearchDays = 366 * 10
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// A leading "RRULE:" prefix is accepted.
+func ParseRRule(raw string) (*RRule, error) {
+	raw = strings.TrimPrefix(strings.TrimSpace(raw), "RRULE:")
+	if raw == "" {
+		return nil, fmt.Errorf("recurrence rule is empty")
+	}
+
+	rule := &RRule{Interval: 1}
+	for _, part := range strings.Split(raw, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+
+		switch key {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" && value != "MONTHLY" {
+				return nil, fmt.Errorf("unsupported FREQ %q (use DAILY, WEEKLY or MONTHLY)", value)
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			rule.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, err := parseRRuleTime(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, item := range strings.Split(value, ",") {
+				day, err := parseRRuleDay(item)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("recurrence rule requires FREQ")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	for _, day := range rule.ByDay {
+		if day.Ordinal != 0 && rule.Freq != "MONTHLY" {
+			return nil, fmt.Errorf("ordinal BYDAY values are only supported with FREQ=MONTHLY")
+		}
+	}
+
+	return rule, nil
+}
+
+// Next returns the first occurrence strictly after `after` for a series that
+// starts at dtstart. Dates are computed in dtstart's location, so wall-clock
+// times stay fixed across DST changes. It returns false once UNTIL is passed.
+// COUNT is not applied here because it depends on how many occurrences the
+// caller has already consumed.
+func (r *RRule) Next(dtstart time.Time, after time.Time) (time.Time, bool) {
+	loc := dtstart.Location()
+	after = after.In(loc)
+	if after.Before(dtstart) {
+		after = dtstart.Add(-time.Nanosecond)
+	}
+
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i <= maxRRuleSearchDays; i++ {
+		candidateDay := day.AddDate(0, 0, i)
+		if !r.matches(dtstart, candidateDay) {
+			continue
+		}
+		candidate := time.Date(candidateDay.Year(), candidateDay.Month(), candidateDay.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, loc)
+		if !candidate.After(after) {
+			continue
+		}
+		if !r.Until.IsZero() && candidate.After(r.Until) {
+			return time.Time{}, false
+		}
+		return candidate, true
+	}
+	return time.Time{}, false
+}
+
+func (r *RRule) matches(dtstart time.Time, day time.Time) bool {
+	startDay := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, dtstart.Location())
+
+	switch r.Freq {
+	case "DAILY":
+		if daysBetween(startDay, day)%r.Interval != 0 {
+			return false
+		}
+		return len(r.ByDay) == 0 || r.hasWeekday(day.Weekday())
+	case "WEEKLY":
+		if daysBetween(weekStart(startDay), weekStart(day))/7%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByDay) == 0 {
+			return day.Weekday() == dtstart.Weekday()
+		}
+		return r.hasWeekday(day.Weekday())
+	case "MONTHLY":
+		months := (day.Year()-startDay.Year())*12 + int(day.Month()) - int(startDay.Month())
+		if months%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByDay) == 0 {
+			return day.Day() == dtstart.Day()
+		}
+		for _, byDay := range r.ByDay {
+			if byDay.Weekday != day.Weekday() {
+				continue
+			}
+			if byDay.Ordinal == 0 || byDay.Ordinal == weekdayOrdinal(day) || byDay.Ordinal == -weekdayOrdinalFromEnd(day) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *RRule) hasWeekday(weekday time.Weekday) bool {
+	for _, day := range r.ByDay {
+		if day.Weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRRuleDay(raw string) (RRuleDay, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) < 2 {
+		return RRuleDay{}, fmt.Errorf("invalid BYDAY value %q", raw)
+	}
+	weekday, ok := rruleWeekdays[raw[len(raw)-2:]]
+	if !ok {
+		return RRuleDay{}, fmt.Errorf("invalid BYDAY value %q", raw)
+	}
+	ordinal := 0
+	if prefix := raw[:len(raw)-2]; prefix != "" {
+		parsed, err := strconv.Atoi(prefix)
+		if err != nil || parsed == 0 || parsed > 5 || parsed < -5 {
+			return RRuleDay{}, fmt.Errorf("invalid BYDAY ordinal %q", raw)
+		}
+		ordinal = parsed
+	}
+	return RRuleDay{Ordinal: ordinal, Weekday: weekday}, nil
+}
+
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// a date-only UNTIL includes the whole day
+				return parsed.Add(24*time.Hour - time.Second), nil
+			}
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+func daysBetween(from time.Time, to time.Time) int {
+	fromUTC := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toUTC := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toUTC.Sub(fromUTC).Hours() / 24)
+}
+
+// weekStart returns the Monday of the day's week (RFC 5545 default WKST=MO).
+func weekStart(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func weekdayOrdinal(day time.Time) int {
+	return (day.Day()-1)/7 + 1
+}
+
+func weekdayOrdinalFromEnd(day time.Time) int {
+	lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	return (lastDay-day.Day())/7 + 1
+}
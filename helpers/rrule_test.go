@@ -0,0 +1,162 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    *RRule
+		wantErr bool
+	}{
+		{raw: "FREQ=DAILY", want: &RRule{Freq: "DAILY", Interval: 1}},
+		{raw: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", want: &RRule{Freq: "WEEKLY", Interval: 2, ByDay: []RRuleDay{{Weekday: time.Monday}, {Weekday: time.Wednesday}}}},
+		{raw: "freq=monthly;byday=-1fr;count=3", want: &RRule{Freq: "MONTHLY", Interval: 1, ByDay: []RRuleDay{{Ordinal: -1, Weekday: time.Friday}}, Count: 3}},
+		{raw: "FREQ=DAILY;UNTIL=20261231T090000Z", want: &RRule{Freq: "DAILY", Interval: 1, Until: time.Date(2026, 12, 31, 9, 0, 0, 0, time.UTC)}},
+		{raw: "FREQ=DAILY;UNTIL=20261231", want: &RRule{Freq: "DAILY", Interval: 1, Until: time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC)}},
+		{raw: "", wantErr: true},
+		{raw: "INTERVAL=2", wantErr: true},
+		{raw: "FREQ=HOURLY", wantErr: true},
+		{raw: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{raw: "FREQ=DAILY;COUNT=-1", wantErr: true},
+		{raw: "FREQ=DAILY;COUNT=2;UNTIL=20261231", wantErr: true},
+		{raw: "FREQ=WEEKLY;BYDAY=1MO", wantErr: true},
+		{raw: "FREQ=MONTHLY;BYDAY=6MO", wantErr: true},
+		{raw: "FREQ=WEEKLY;BYDAY=XX", wantErr: true},
+		{raw: "FREQ=DAILY;BYSETPOS=1", wantErr: true},
+		{raw: "FREQ=DAILY;UNTIL=tomorrow", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseRRule(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRRule(%q) = %+v, want an error", tt.raw, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRRule(%q): %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseRRule(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRRuleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		after   time.Time
+		want    time.Time
+		wantOK  bool
+	}{
+		{
+			name:    "first occurrence is dtstart",
+			rule:    "FREQ=DAILY",
+			dtstart: at(newYork, 2026, 3, 1, 9, 0),
+			after:   at(newYork, 2026, 2, 1, 0, 0),
+			want:    at(newYork, 2026, 3, 1, 9, 0),
+			wantOK:  true,
+		},
+		{
+			name:    "daily keeps 09:00 across spring forward",
+			rule:    "FREQ=DAILY",
+			dtstart: at(newYork, 2026, 3, 1, 9, 0),
+			after:   at(newYork, 2026, 3, 7, 9, 0),
+			want:    at(newYork, 2026, 3, 8, 9, 0),
+			wantOK:  true,
+		},
+		{
+			name:    "daily keeps 09:00 across fall back",
+			rule:    "FREQ=DAILY",
+			dtstart: at(newYork, 2026, 10, 1, 9, 0),
+			after:   at(newYork, 2026, 10, 31, 9, 0),
+			want:    at(newYork, 2026, 11, 1, 9, 0),
+			wantOK:  true,
+		},
+		{
+			name:    "after given in UTC on the DST day",
+			rule:    "FREQ=DAILY",
+			dtstart: at(berlin, 2026, 3, 1, 8, 30),
+			after:   time.Date(2026, 3, 29, 6, 0, 0, 0, time.UTC),
+			want:    at(berlin, 2026, 3, 29, 8, 30),
+			wantOK:  true,
+		},
+		{
+			name:    "weekly by day across spring forward",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,FR",
+			dtstart: at(newYork, 2026, 3, 2, 18, 0),
+			after:   at(newYork, 2026, 3, 6, 18, 0),
+			want:    at(newYork, 2026, 3, 9, 18, 0),
+			wantOK:  true,
+		},
+		{
+			name:    "every other week",
+			rule:    "FREQ=WEEKLY;INTERVAL=2",
+			dtstart: at(berlin, 2026, 10, 19, 12, 0),
+			after:   at(berlin, 2026, 10, 19, 12, 0),
+			want:    at(berlin, 2026, 11, 2, 12, 0),
+			wantOK:  true,
+		},
+		{
+			name:    "last friday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR",
+			dtstart: at(berlin, 2026, 1, 30, 10, 0),
+			after:   at(berlin, 2026, 1, 30, 10, 0),
+			want:    at(berlin, 2026, 2, 27, 10, 0),
+			wantOK:  true,
+		},
+		{
+			name:    "monthly on dtstart's day skips short months",
+			rule:    "FREQ=MONTHLY",
+			dtstart: at(newYork, 2026, 1, 31, 9, 0),
+			after:   at(newYork, 2026, 1, 31, 9, 0),
+			want:    at(newYork, 2026, 3, 31, 9, 0),
+			wantOK:  true,
+		},
+		{
+			name:    "until passed",
+			rule:    "FREQ=DAILY;UNTIL=20260305T235959Z",
+			dtstart: at(newYork, 2026, 3, 1, 9, 0),
+			after:   at(newYork, 2026, 3, 5, 9, 0),
+			wantOK:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRRule(%q): %v", tt.rule, err)
+			}
+			got, ok := rule.Next(tt.dtstart, tt.after)
+			if ok != tt.wantOK {
+				t.Fatalf("Next ok = %v, want %v (got %v)", ok, tt.wantOK, got)
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Fatalf("Next = %v, want %v", got, tt.want)
+			}
+			if ok && (got.Hour() != tt.dtstart.Hour() || got.Minute() != tt.dtstart.Minute()) {
+				t.Fatalf("Next = %v, wall clock moved from %s", got, tt.dtstart.Format("15:04"))
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// embedded zoneinfo so timezones resolve in minimal container images
+	_ "time/tzdata"
+)
+
+// LocalTimeLayout is how wall-clock times are returned to clients.
+const LocalTimeLayout = "2006-01-02 15:04"
+
+var localTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// LoadLocation resolves an IANA timezone name such as "Europe/Berlin",
+// falling back to UTC when it is empty or unknown.
+func LoadLocation(name string) *time.Location {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ValidTimezone reports whether name is empty or a known IANA timezone.
+func ValidTimezone(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return true
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// ParseLocalTime parses a wall-clock time such as "2025-03-30 09:00" in loc.
+// Times that fall into a DST gap are moved forward by the gap's length, and
+// ambiguous times during the fall-back hour resolve to the first occurrence.
+func ParseLocalTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range localTimeLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, loc); err == nil {
+			if earlier := parsed.Add(-time.Hour); earlier.Format(layout) == parsed.Format(layout) {
+				return earlier, nil
+			}
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid local time %q (use YYYY-MM-DD HH:MM)", value)
+}
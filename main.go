@@ -4,6 +4,7 @@ import (
 	"content-clock/controllers"
 	"content-clock/helpers"
 	"content-clock/models"
+	"content-clock/tasks"
 	"log"
 
 	"github.com/joho/godotenv"
@@ -20,12 +21,24 @@ func main() {
 
 	godotenv.Load()
 	controllers.SetupPostHooks(app)
+	controllers.SetupSlotHooks(app)
+	controllers.SetupSchedulerHooks(app)
+	controllers.SetupValidationHooks(app)
+	controllers.SetupApprovalHooks(app)
+	controllers.SetupPauseHooks(app)
+	controllers.SetupCampaignHooks(app)
+	controllers.SetupConnectionHooks(app)
 
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		if err := models.MigrateCollectionsIfEnabled(app); err != nil {
 			app.Logger().Error("Failed to run DB migration", "error", err.Error())
 			return err
 		}
+		if err := tasks.RotateTokenEncryption(app); err != nil {
+			app.Logger().Error("Invalid TOKEN_ENCRYPTION_KEYS", "error", err.Error())
+			return err
+		}
+		controllers.StartScheduler(app)
 
 		// serves static files from the provided public dir (if exists)
 		// se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), false))
@@ -33,6 +46,7 @@ func main() {
 		// 	e.Redirect(http.StatusPermanentRedirect, "https://content-clock.vercel.app")
 		// 	return nil
 		// })
+		se.Router.Bind(controllers.RequireAPIAuth())
 		controllers.SetupInstagramRoutes(se, app)
 		controllers.SetupFacebookRoutes(se, app)
 		controllers.SetupLinkedinRoutes(se, app)
@@ -42,11 +56,27 @@ func main() {
 		controllers.SetupAiRoutes(se, app)
 		controllers.SetupRedditRoutes(se, app)
 		controllers.SetupThreadsRoutes(se, app)
+		controllers.SetupSlotRoutes(se, app)
+		controllers.SetupPlatformRoutes(se, app)
+		controllers.SetupValidationRoutes(se, app)
+		controllers.SetupApprovalRoutes(se, app)
+		controllers.SetupPauseRoutes(se, app)
+		controllers.SetupRetryRoutes(se, app)
+		controllers.SetupCampaignRoutes(se, app)
+		controllers.SetupUnpublishRoutes(se, app)
 		return se.Next()
 	})
 
+	// safety net for the in-process scheduler: picks up posts written by other
+	// instances and queued retries whose next_run_at has passed
 	app.Cron().MustAdd("Publish Scheduled Posts", "* * * * *", func() {
-		controllers.GetScheduledPosts(app)
+		controllers.RunPublisher(app)
+	})
+	app.Cron().MustAdd("Recover Stuck Posts", "*/5 * * * *", func() {
+		tasks.RecoverStuckPosts(app)
+	})
+	app.Cron().MustAdd("Refresh Connection Tokens", "*/5 * * * *", func() {
+		tasks.RefreshDueTokens(app)
 	})
 	app.Cron().MustAdd("Fetch Analytics (3 Hrs)", "0 */3 * * *", func() {
 		controllers.FetchPostsAnalytics(app)
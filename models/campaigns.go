@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gorm.io/gorm"
+)
+
+// Campaigns is one piece of content sent to several connections. Each target
+// is a posts record with campaign set, carrying its own variant, status and
+// published_post_id; status, summary and the counts are computed from them.
+type Campaigns struct {
+	gorm.Model
+	ID             uint       `gorm:"primaryKey;autoIncrement"`
+	User           string     `gorm:"column:user;size:255"`
+	Name           string     `gorm:"column:name;size:255"`
+	Title          string     `gorm:"column:title;size:255"`
+	Content        string     `gorm:"column:content;type:text"`
+	Link           string     `gorm:"column:link;size:255"`
+	PublishAt      *time.Time `gorm:"column:publish_at"`
+	Timezone       string     `gorm:"column:timezone;size:64"`
+	Status         string     `gorm:"column:status;size:32"`
+	Summary        string     `gorm:"column:summary;size:255"`
+	TargetCount    int        `gorm:"column:target_count"`
+	PublishedCount int        `gorm:"column:published_count"`
+	FailedCount    int        `gorm:"column:failed_count"`
+	Deleted        *time.Time `gorm:"column:deleted"`
+}
+
+func ApplyCampaignsCollectionSchema(c *core.Collection) {
+	c.Fields.Add(
+		&core.TextField{Name: "user"},
+		&core.TextField{Name: "name"},
+		&core.TextField{Name: "title"},
+		&core.TextField{Name: "content"},
+		&core.TextField{Name: "link"},
+		&core.FileField{Name: "images", MaxSelect: 10, MaxSize: 50 * 1024 * 1024},
+		&core.DateField{Name: "publish_at"},
+		&core.TextField{Name: "timezone"},
+		&core.TextField{Name: "status"},
+		&core.TextField{Name: "summary"},
+		&core.NumberField{Name: "target_count"},
+		&core.NumberField{Name: "published_count"},
+		&core.NumberField{Name: "failed_count"},
+		&core.DateField{Name: "deleted"},
+	)
+
+	ownRule := `@request.auth.id != "" && user = @request.auth.id`
+	c.ListRule = types.Pointer(ownRule)
+	c.ViewRule = types.Pointer(ownRule)
+	c.CreateRule = types.Pointer(ownRule)
+	c.UpdateRule = types.Pointer(ownRule)
+	c.DeleteRule = types.Pointer(ownRule)
+}
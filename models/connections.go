@@ -10,20 +10,32 @@ import (
 
 type Connections struct {
 	gorm.Model
-	ID             uint      `gorm:"primaryKey;autoIncrement"`
-	UserId         string    `gorm:"column:user_id;not null;size:255"`
-	Name           string    `gorm:"column:name;not null;size:255"`
-	Username       string    `gorm:"column:username;size:255"`
-	ConnectionName string    `gorm:"column:connection_name;not null;size:255"`
-	ConnectionId   string    `gorm:"column:connection_id;not null;size:255"`
-	AccessToken    string    `gorm:"column:access_token;not null;size:1024"`
-	RefreshToken   string    `gorm:"column:refresh_token;size:1024"`
-	MetaData       string    `gorm:"column:meta_data;size:2048"`
-	ProfileImage   string    `gorm:"column:profile_image;size:1024"`
-	Timezone       string    `gorm:"column:timezone;size:255"`
-	CreatedAt      time.Time `gorm:"autoCreateTime"`
-	UpdatedAt      time.Time `gorm:"autoCreateTime;autoUpdateTime"`
-	DeletedAt      *time.Time
+	ID                   uint       `gorm:"primaryKey;autoIncrement"`
+	UserId               string     `gorm:"column:user_id;not null;size:255"`
+	Name                 string     `gorm:"column:name;not null;size:255"`
+	Username             string     `gorm:"column:username;size:255"`
+	ConnectionName       string     `gorm:"column:connection_name;not null;size:255"`
+	ConnectionId         string     `gorm:"column:connection_id;not null;size:255"`
+	AccessToken          string     `gorm:"column:access_token;not null;size:2048"`
+	RefreshToken         string     `gorm:"column:refresh_token;size:2048"`
+	MetaData             string     `gorm:"column:meta_data;size:2048"`
+	ProfileImage         string     `gorm:"column:profile_image;size:1024"`
+	Timezone             string     `gorm:"column:timezone;size:255"`
+	PostingSlots         string     `gorm:"column:posting_slots;type:text"`
+	RequiresApproval     bool       `gorm:"column:requires_approval"`
+	Approvers            string     `gorm:"column:approvers;type:text"`
+	Health               string     `gorm:"column:health;size:32"`
+	HealthError          string     `gorm:"column:health_error;type:text"`
+	HealthCheckedAt      *time.Time `gorm:"column:health_checked_at"`
+	ExpiresAt            *time.Time `gorm:"column:expires_at"`
+	TokenRefreshedAt     *time.Time `gorm:"column:token_refreshed_at"`
+	TokenRefreshError    string     `gorm:"column:token_refresh_error;type:text"`
+	TokenRefreshFailedAt *time.Time `gorm:"column:token_refresh_failed_at"`
+	RefreshLeaseOwner    string     `gorm:"column:refresh_lease_owner;size:255"`
+	RefreshLeaseExpires  *time.Time `gorm:"column:refresh_lease_expires_at"`
+	CreatedAt            time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt            time.Time  `gorm:"autoCreateTime;autoUpdateTime"`
+	DeletedAt            *time.Time
 }
 
 func ApplyConnectionsCollectionSchema(c *core.Collection) {
@@ -36,6 +48,18 @@ func ApplyConnectionsCollectionSchema(c *core.Collection) {
 		&core.TextField{Name: "refresh_token"},
 		&core.JSONField{Name: "meta_data"},
 		&core.TextField{Name: "timezone"},
+		&core.JSONField{Name: "posting_slots"},
+		&core.BoolField{Name: "requires_approval"},
+		&core.JSONField{Name: "approvers"},
+		&core.TextField{Name: "health"},
+		&core.TextField{Name: "health_error"},
+		&core.DateField{Name: "health_checked_at"},
+		&core.DateField{Name: "expires_at"},
+		&core.DateField{Name: "token_refreshed_at"},
+		&core.TextField{Name: "token_refresh_error"},
+		&core.DateField{Name: "token_refresh_failed_at"},
+		&core.TextField{Name: "refresh_lease_owner"},
+		&core.DateField{Name: "refresh_lease_expires_at"},
 		&core.TextField{Name: "user"},
 		&core.TextField{Name: "profile_image_url"},
 		&core.FileField{Name: "profile_image", MaxSelect: 1},
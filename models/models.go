@@ -55,6 +55,11 @@ func ConnectDatabase(dsn_url, env string) {
 			&SocialPosts{},
 			&Notifications{},
 			&Analytics{},
+			&PublishJobs{},
+			&PublishPauses{},
+			&PublishAttempts{},
+			&Campaigns{},
+			&OAuthHandoffs{},
 		)
 		if err != nil {
 			helpers.Logging("error", err.Error())
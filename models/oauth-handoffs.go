@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"gorm.io/gorm"
+)
+
+// OAuthHandoffs holds the token bundle of a finished OAuth callback until the
+// user who started the flow redeems it once through an add-*-pages endpoint. Only the SHA-256
+// of the handoff code is stored, and the bundle is encrypted like connection
+// tokens.
+type OAuthHandoffs struct {
+	gorm.Model
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	CodeHash  string    `gorm:"column:code_hash;size:64"`
+	Platform  string    `gorm:"column:platform;size:64"`
+	User      string    `gorm:"column:user;size:255"`
+	Bundle    string    `gorm:"column:bundle;type:text"`
+	ExpiresAt time.Time `gorm:"column:expires_at"`
+}
+
+func ApplyOAuthHandoffsCollectionSchema(c *core.Collection) {
+	c.Fields.Add(
+		&core.TextField{Name: "code_hash"},
+		&core.TextField{Name: "platform"},
+		&core.TextField{Name: "user"},
+		&core.TextField{Name: "bundle"},
+		&core.DateField{Name: "expires_at"},
+	)
+	c.AddIndex("idx_oauth_handoffs_code_hash", true, "code_hash", "")
+
+	// Written and redeemed by the server only.
+	c.ListRule = nil
+	c.ViewRule = nil
+	c.CreateRule = nil
+	c.UpdateRule = nil
+	c.DeleteRule = nil
+}
@@ -26,6 +26,21 @@ func MigrateCollectionsIfEnabled(app *pocketbase.PocketBase) error {
 	if err := ensureCollection(app, "analytics", ApplyAnalyticsCollectionSchema); err != nil {
 		return err
 	}
+	if err := ensureCollection(app, "publish_jobs", ApplyPublishJobsCollectionSchema); err != nil {
+		return err
+	}
+	if err := ensureCollection(app, "publish_pauses", ApplyPublishPausesCollectionSchema); err != nil {
+		return err
+	}
+	if err := ensureCollection(app, "publish_attempts", ApplyPublishAttemptsCollectionSchema); err != nil {
+		return err
+	}
+	if err := ensureCollection(app, "campaigns", ApplyCampaignsCollectionSchema); err != nil {
+		return err
+	}
+	if err := ensureCollection(app, "oauth_handoffs", ApplyOAuthHandoffsCollectionSchema); err != nil {
+		return err
+	}
 	return nil
 }
 
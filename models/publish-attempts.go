@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gorm.io/gorm"
+)
+
+// PublishAttempts keeps one row per call to a platform publisher, so a post's
+// full retry history survives later attempts.
+type PublishAttempts struct {
+	gorm.Model
+	ID              uint       `gorm:"primaryKey;autoIncrement"`
+	Post            string     `gorm:"column:post;not null;size:255"`
+	Job             string     `gorm:"column:job;size:255"`
+	Connection      string     `gorm:"column:connection;size:255"`
+	User            string     `gorm:"column:user;size:255"`
+	Platform        string     `gorm:"column:platform;size:255"`
+	IdempotencyKey  string     `gorm:"column:idempotency_key;size:64;index"`
+	Attempt         int        `gorm:"column:attempt"`
+	Status          string     `gorm:"column:status;size:32"`
+	Error           string     `gorm:"column:error;type:text"`
+	ErrorClass      string     `gorm:"column:error_class;size:32"`
+	HTTPStatus      int        `gorm:"column:http_status"`
+	PublishedPostId string     `gorm:"column:published_post_id;size:255"`
+	StartedAt       time.Time  `gorm:"column:started_at"`
+	FinishedAt      *time.Time `gorm:"column:finished_at"`
+}
+
+func ApplyPublishAttemptsCollectionSchema(c *core.Collection) {
+	c.Fields.Add(
+		&core.TextField{Name: "post"},
+		&core.TextField{Name: "job"},
+		&core.TextField{Name: "connection"},
+		&core.TextField{Name: "user"},
+		&core.TextField{Name: "platform"},
+		&core.TextField{Name: "idempotency_key"},
+		&core.NumberField{Name: "attempt"},
+		&core.TextField{Name: "status"},
+		&core.TextField{Name: "error"},
+		&core.TextField{Name: "error_class"},
+		&core.NumberField{Name: "http_status"},
+		&core.TextField{Name: "published_post_id"},
+		&core.DateField{Name: "started_at"},
+		&core.DateField{Name: "finished_at"},
+	)
+
+	// Attempts are written by the queue only; owners may inspect them.
+	ownReadRule := `@request.auth.id != "" && user = @request.auth.id`
+	c.ListRule = types.Pointer(ownReadRule)
+	c.ViewRule = types.Pointer(ownReadRule)
+	c.CreateRule = nil
+	c.UpdateRule = nil
+	c.DeleteRule = nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gorm.io/gorm"
+)
+
+type PublishJobs struct {
+	gorm.Model
+	ID             uint       `gorm:"primaryKey;autoIncrement"`
+	Post           string     `gorm:"column:post;not null;size:255"`
+	Connection     string     `gorm:"column:connection;size:255"`
+	Platform       string     `gorm:"column:platform;size:255"`
+	Payload        string     `gorm:"column:payload;type:text"`
+	Status         string     `gorm:"column:status;size:255"`
+	Attempts       int        `gorm:"column:attempts"`
+	MaxAttempts    int        `gorm:"column:max_attempts"`
+	BackoffSeconds int        `gorm:"column:backoff_seconds"`
+	NextRunAt      time.Time  `gorm:"column:next_run_at"`
+	LastError      string     `gorm:"column:last_error;type:text"`
+	CompletedAt    *time.Time `gorm:"column:completed_at"`
+	User           string     `gorm:"column:user;size:255"`
+	LeaseOwner     string     `gorm:"column:lease_owner;size:255"`
+	LeaseExpiresAt *time.Time `gorm:"column:lease_expires_at"`
+}
+
+func ApplyPublishJobsCollectionSchema(c *core.Collection) {
+	c.Fields.Add(
+		&core.TextField{Name: "post"},
+		&core.TextField{Name: "connection"},
+		&core.TextField{Name: "platform"},
+		&core.JSONField{Name: "payload"},
+		&core.TextField{Name: "status"},
+		&core.NumberField{Name: "attempts"},
+		&core.NumberField{Name: "max_attempts"},
+		&core.NumberField{Name: "backoff_seconds"},
+		&core.DateField{Name: "next_run_at"},
+		&core.TextField{Name: "last_error"},
+		&core.DateField{Name: "completed_at"},
+		&core.TextField{Name: "user"},
+		&core.TextField{Name: "lease_owner"},
+		&core.DateField{Name: "lease_expires_at"},
+	)
+
+	// Jobs are written by the scheduler only; owners may inspect them.
+	ownReadRule := `@request.auth.id != "" && user = @request.auth.id`
+	c.ListRule = types.Pointer(ownReadRule)
+	c.ViewRule = types.Pointer(ownReadRule)
+	c.CreateRule = nil
+	c.UpdateRule = nil
+	c.DeleteRule = nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gorm.io/gorm"
+)
+
+// PublishPauses stops publishing for a connection, for all of a user's
+// connections (empty connection) or for everyone (empty user and connection,
+// superusers only). Kind "pause" holds posts until it is lifted; kind
+// "blackout" is a recurring window and defers posts to the end of the window.
+type PublishPauses struct {
+	gorm.Model
+	ID              uint       `gorm:"primaryKey;autoIncrement"`
+	User            string     `gorm:"column:user;size:255"`
+	Connection      string     `gorm:"column:connection;size:255"`
+	Kind            string     `gorm:"column:kind;size:32"`
+	Reason          string     `gorm:"column:reason;type:text"`
+	StartsAt        time.Time  `gorm:"column:starts_at"`
+	EndsAt          *time.Time `gorm:"column:ends_at"`
+	Recurrence      string     `gorm:"column:recurrence;size:255"`
+	DurationMinutes int        `gorm:"column:duration_minutes"`
+	Timezone        string     `gorm:"column:timezone;size:64"`
+	ResumeMode      string     `gorm:"column:resume_mode;size:32"`
+	LiftedAt        *time.Time `gorm:"column:lifted_at"`
+	LiftedBy        string     `gorm:"column:lifted_by;size:255"`
+}
+
+func ApplyPublishPausesCollectionSchema(c *core.Collection) {
+	c.Fields.Add(
+		&core.TextField{Name: "user"},
+		&core.TextField{Name: "connection"},
+		&core.TextField{Name: "kind"},
+		&core.TextField{Name: "reason"},
+		&core.DateField{Name: "starts_at"},
+		&core.DateField{Name: "ends_at"},
+		&core.TextField{Name: "recurrence"},
+		&core.NumberField{Name: "duration_minutes"},
+		&core.TextField{Name: "timezone"},
+		&core.TextField{Name: "resume_mode"},
+		&core.DateField{Name: "lifted_at"},
+		&core.TextField{Name: "lifted_by"},
+	)
+
+	// global pauses have no user and can only be managed by superusers
+	ownRule := `@request.auth.id != "" && user = @request.auth.id`
+	c.ListRule = types.Pointer(ownRule)
+	c.ViewRule = types.Pointer(ownRule)
+	c.CreateRule = types.Pointer(ownRule)
+	c.UpdateRule = types.Pointer(ownRule)
+	c.DeleteRule = types.Pointer(ownRule)
+}
@@ -10,21 +10,43 @@ import (
 
 type SocialPosts struct {
 	gorm.Model
-	ID              uint      `gorm:"primaryKey;autoIncrement"`
-	ConnectionId    string    `gorm:"not null;type:varchar(255)"`
-	UserId          string    `gorm:"not null;type:varchar(255)"`
-	Title           string    `gorm:"type:varchar(255)"`
-	Description     string    `gorm:"type:text"`
-	Link            string    `gorm:"type:varchar(255)"`
-	Medias          string    `gorm:"type:varchar(255)"`
-	Type            string    `gorm:"not null;type:varchar(255)"`
-	PublishAt       string    `gorm:"column:publish_at;not null"`
-	Status          string    `gorm:"not null;type:varchar(255)"`
-	Logs            string    `gorm:"type:text"`
-	PublishedPostId string    `gorm:"type:varchar(255)"`
-	CreatedAt       time.Time `gorm:"autoCreateTime"`
-	UpdatedAt       time.Time `gorm:"autoCreateTime;autoUpdateTime"`
-	DeletedAt       *time.Time
+	ID               uint       `gorm:"primaryKey;autoIncrement"`
+	ConnectionId     string     `gorm:"not null;type:varchar(255)"`
+	UserId           string     `gorm:"not null;type:varchar(255)"`
+	Title            string     `gorm:"type:varchar(255)"`
+	Description      string     `gorm:"type:text"`
+	Link             string     `gorm:"type:varchar(255)"`
+	Medias           string     `gorm:"type:varchar(255)"`
+	Type             string     `gorm:"not null;type:varchar(255)"`
+	PublishAt        string     `gorm:"column:publish_at;not null"`
+	PublishAtLocal   string     `gorm:"column:publish_at_local;type:varchar(32)"`
+	Timezone         string     `gorm:"column:timezone;type:varchar(64)"`
+	Status           string     `gorm:"not null;type:varchar(255)"`
+	Logs             string     `gorm:"type:text"`
+	PublishedPostId  string     `gorm:"type:varchar(255)"`
+	LeaseOwner       string     `gorm:"type:varchar(255)"`
+	LeaseExpiresAt   *time.Time `gorm:"column:lease_expires_at"`
+	Recurrence       string     `gorm:"type:varchar(255)"`
+	RecurrenceStart  *time.Time `gorm:"column:recurrence_start"`
+	OccurrenceCount  int        `gorm:"column:occurrence_count"`
+	RecurrenceParent string     `gorm:"type:varchar(255)"`
+	OccurrenceAt     *time.Time `gorm:"column:occurrence_at"`
+	Queued           bool       `gorm:"column:queued"`
+	ReviewDecision   string     `gorm:"type:varchar(32)"`
+	ReviewedBy       string     `gorm:"type:varchar(255)"`
+	ReviewedAt       *time.Time `gorm:"column:reviewed_at"`
+	ReviewComment    string     `gorm:"type:text"`
+	PausedBy         string     `gorm:"type:varchar(255)"`
+	ErrorClass       string     `gorm:"type:varchar(32)"`
+	Campaign         string     `gorm:"type:varchar(255)"`
+	Variants         string     `gorm:"type:text"`
+	VariantImages    string     `gorm:"type:varchar(255)"`
+	ThreadParts      string     `gorm:"type:text"`
+	ThreadImages     string     `gorm:"type:varchar(255)"`
+	ThreadProgress   string     `gorm:"type:text"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time  `gorm:"autoCreateTime;autoUpdateTime"`
+	DeletedAt        *time.Time
 }
 
 func ApplyPostsCollectionSchema(c *core.Collection) {
@@ -41,7 +63,29 @@ func ApplyPostsCollectionSchema(c *core.Collection) {
 		&core.TextField{Name: "connection"},
 		&core.TextField{Name: "user"},
 		&core.DateField{Name: "publish_at"},
+		&core.TextField{Name: "publish_at_local"},
+		&core.TextField{Name: "timezone"},
 		&core.DateField{Name: "deleted"},
+		&core.TextField{Name: "lease_owner"},
+		&core.DateField{Name: "lease_expires_at"},
+		&core.TextField{Name: "recurrence"},
+		&core.DateField{Name: "recurrence_start"},
+		&core.NumberField{Name: "occurrence_count"},
+		&core.TextField{Name: "recurrence_parent"},
+		&core.DateField{Name: "occurrence_at"},
+		&core.BoolField{Name: "queued"},
+		&core.TextField{Name: "review_decision"},
+		&core.TextField{Name: "reviewed_by"},
+		&core.DateField{Name: "reviewed_at"},
+		&core.TextField{Name: "review_comment"},
+		&core.TextField{Name: "paused_by"},
+		&core.TextField{Name: "error_class"},
+		&core.TextField{Name: "campaign"},
+		&core.JSONField{Name: "variants"},
+		&core.FileField{Name: "variant_images", MaxSelect: 10, MaxSize: 50 * 1024 * 1024},
+		&core.JSONField{Name: "thread_parts"},
+		&core.FileField{Name: "thread_images", MaxSelect: 99, MaxSize: 50 * 1024 * 1024},
+		&core.JSONField{Name: "thread_progress"},
 	)
 
 	ownRule := `@request.auth.id != "" && user = @request.auth.id`
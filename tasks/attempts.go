@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const publishAttemptsCollection = "publish_attempts"
+
+const (
+	// AttemptPending is saved before the platform is called; an attempt
+	// still pending later was interrupted and may have been published.
+	AttemptPending   = "pending"
+	AttemptSucceeded = "succeeded"
+	AttemptFailed    = "failed"
+	// AttemptRecovered means the post was found on the platform from an
+	// earlier attempt, so it was not sent again.
+	AttemptRecovered = "recovered"
+)
+
+// beginAttempt appends a pending attempt to the post's history before the
+// publisher is called. job is nil when the post is published without the
+// queue. It returns nil when the attempts collection does not exist.
+func beginAttempt(app core.App, postId string, job *core.Record, platform string, idempotencyKey string) *core.Record {
+	collection, err := app.FindCollectionByNameOrId(publishAttemptsCollection)
+	if err != nil {
+		return nil
+	}
+
+	attempt := core.NewRecord(collection)
+	attempt.Set("post", postId)
+	attempt.Set("platform", platform)
+	attempt.Set("idempotency_key", idempotencyKey)
+	attempt.Set("status", AttemptPending)
+	attempt.Set("started_at", types.NowDateTime())
+	if job != nil {
+		attempt.Set("job", job.Id)
+		attempt.Set("connection", job.GetString("connection"))
+		attempt.Set("user", job.GetString("user"))
+		attempt.Set("attempt", job.GetInt("attempts"))
+	} else if post, postErr := app.FindRecordById("posts", postId); postErr == nil {
+		attempt.Set("connection", post.GetString("connection"))
+		attempt.Set("user", post.GetString("user"))
+		attempt.Set("attempt", 1)
+	}
+
+	if err := app.Save(attempt); err != nil {
+		app.Logger().Error("Failed to save publish attempt", "postId", postId, "error", err.Error())
+		return nil
+	}
+	return attempt
+}
+
+// finishAttempt records the outcome of a started attempt.
+func finishAttempt(app core.App, attempt *core.Record, status string, publishedPostId string, err error) error {
+	if attempt == nil {
+		return nil
+	}
+	attempt.Set("status", status)
+	attempt.Set("finished_at", types.NowDateTime())
+	attempt.Set("published_post_id", publishedPostId)
+	if err != nil {
+		publishErr := ClassifyError(attempt.GetString("platform"), err)
+		attempt.Set("error", err.Error())
+		attempt.Set("error_class", string(publishErr.Class))
+		attempt.Set("http_status", publishErr.Status)
+	}
+	return app.Save(attempt)
+}
+
+// ambiguousAttemptSince reports whether an earlier attempt with the same
+// idempotency key may have reached the platform without us learning the
+// result (interrupted, timed out or failed for an unknown reason), and when
+// the first attempt started.
+func ambiguousAttemptSince(app core.App, idempotencyKey string) (time.Time, bool) {
+	if _, err := app.FindCollectionByNameOrId(publishAttemptsCollection); err != nil || idempotencyKey == "" {
+		return time.Time{}, false
+	}
+	attempts, err := app.FindRecordsByFilter(
+		publishAttemptsCollection,
+		"idempotency_key = {:key}",
+		"started_at",
+		0,
+		0,
+		dbx.Params{"key": idempotencyKey},
+	)
+	if err != nil || len(attempts) == 0 {
+		return time.Time{}, false
+	}
+	for _, attempt := range attempts {
+		class := ErrorClass(attempt.GetString("error_class"))
+		if attempt.GetString("status") == AttemptPending ||
+			(attempt.GetString("status") == AttemptFailed && (class == ErrorTransient || class == ErrorUnknown)) {
+			return attempts[0].GetDateTime("started_at").Time(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// findPublished asks the publisher whether an earlier attempt already created
+// the post. Lookup errors are logged and treated as "not found".
+func findPublished(app *pocketbase.PocketBase, publisher Publisher, payload PostToSocialPayload, since time.Time) string {
+	publishedPostId, err := publisher.FindPublished(payload, since)
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			app.Logger().Warn("Duplicate lookup failed; publishing again", "postId", payload.SocialPostId, "platform", publisher.Name(), "error", err.Error())
+		}
+		return ""
+	}
+	if publishedPostId != "" {
+		app.Logger().Info("Post already on platform from an earlier attempt; not sending again", "postId", payload.SocialPostId, "platform", publisher.Name(), "publishedPostId", publishedPostId)
+	}
+	return publishedPostId
+}
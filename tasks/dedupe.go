@@ -0,0 +1,214 @@
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// how many recent objects are compared against the post
+const recentObjectsLimit = 25
+
+// a timed-out request may have been accepted a little before the attempt
+// record says it started
+const findPublishedSlack = 2 * time.Minute
+
+var (
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+	urlPattern = regexp.MustCompile(`https?://\S+`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// publishFinder looks for an object the account published since `since`
+// whose content matches the payload, and returns its id or "".
+type publishFinder func(p PostToSocialPayload, since time.Time) (string, error)
+
+// recentObject is a post, tweet, status or message read back from an account.
+type recentObject struct {
+	ID        string
+	Text      string
+	CreatedAt time.Time
+}
+
+// IdempotencyKey identifies one logical publish of a post: the same post,
+// connection and content always get the same key, so every retry of it can
+// be matched against earlier attempts and, where the platform supports it,
+// sent as an Idempotency-Key header.
+func IdempotencyKey(p PostToSocialPayload) string {
+	hash := sha256.New()
+	parts := append([]string{p.SocialPostId, p.ConnectionId, p.Title, p.Content, p.Link}, p.Images...)
+	for _, threadPart := range p.ThreadParts {
+		parts = append(append(parts, threadPart.Content), threadPart.Images...)
+	}
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// findMatching returns the id of the newest object created after since whose
+// text equals content once markup, URLs and whitespace are normalized. Posts
+// without text cannot be matched.
+func findMatching(objects []recentObject, content string, since time.Time) string {
+	want := normalizeContent(content)
+	if want == "" {
+		return ""
+	}
+	since = since.Add(-findPublishedSlack)
+	for _, object := range objects {
+		if !object.CreatedAt.IsZero() && object.CreatedAt.Before(since) {
+			continue
+		}
+		// URLs are left out of the comparison, since platforms append links
+		// or rewrite them; the rest of the text has to match in full
+		if normalizeContent(object.Text) == want {
+			return object.ID
+		}
+	}
+	return ""
+}
+
+func normalizeContent(text string) string {
+	text = html.UnescapeString(htmlTags.ReplaceAllString(text, " "))
+	text = urlPattern.ReplaceAllString(text, "")
+	return strings.ToLower(strings.TrimSpace(whitespace.ReplaceAllString(text, " ")))
+}
+
+func parsePlatformTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05-0700"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// getJSON GETs a platform URL through the payload's client and decodes the
+// response into out.
+func getJSON(client *http.Client, requestURL string, headers map[string]string, out interface{}) error {
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("lookup request failed: %s: %s", res.Status, string(body))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// graphFinder reads recent objects from a Graph API edge (facebook page
+// posts, instagram media, threads) whose items carry id, a text field and a
+// timestamp field.
+func graphFinder(edgeURL func(p PostToSocialPayload, since time.Time) string, textField string, timeField string) publishFinder {
+	return func(p PostToSocialPayload, since time.Time) (string, error) {
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		if err := getJSON(p.client(), edgeURL(p, since), nil, &response); err != nil {
+			return "", err
+		}
+		objects := make([]recentObject, 0, len(response.Data))
+		for _, item := range response.Data {
+			id, _ := item["id"].(string)
+			text, _ := item[textField].(string)
+			created, _ := item[timeField].(string)
+			objects = append(objects, recentObject{ID: id, Text: text, CreatedAt: parsePlatformTime(created)})
+		}
+		return findMatching(objects, p.Content, since), nil
+	}
+}
+
+var findFacebookPost = graphFinder(func(p PostToSocialPayload, since time.Time) string {
+	return fmt.Sprintf("https://graph.facebook.com/%s/posts?fields=id,message,created_time&since=%d&limit=%d&access_token=%s",
+		p.ConnectionId, since.Add(-findPublishedSlack).Unix(), recentObjectsLimit, url.QueryEscape(p.AccessToken))
+}, "message", "created_time")
+
+var findInstagramMedia = graphFinder(func(p PostToSocialPayload, since time.Time) string {
+	return fmt.Sprintf("https://graph.facebook.com/v19.0/%s/media?fields=id,caption,timestamp&limit=%d&access_token=%s",
+		p.ConnectionId, recentObjectsLimit, url.QueryEscape(p.AccessToken))
+}, "caption", "timestamp")
+
+var findThreadsPost = graphFinder(func(p PostToSocialPayload, since time.Time) string {
+	return fmt.Sprintf("%s/%s/threads?fields=id,text,timestamp&since=%d&limit=%d&access_token=%s",
+		threadsUrl, p.ConnectionId, since.Add(-findPublishedSlack).Unix(), recentObjectsLimit, url.QueryEscape(p.AccessToken))
+}, "text", "timestamp")
+
+func findTweet(p PostToSocialPayload, since time.Time) (string, error) {
+	client := twitterHTTPClient(p.client(), p.AccessToken)
+
+	var response struct {
+		Data []struct {
+			ID        string `json:"id"`
+			Text      string `json:"text"`
+			CreatedAt string `json:"created_at"`
+		} `json:"data"`
+	}
+	requestURL := fmt.Sprintf("https://api.twitter.com/2/users/%s/tweets?max_results=%d&tweet.fields=created_at&start_time=%s",
+		p.ConnectionId, recentObjectsLimit, url.QueryEscape(since.Add(-findPublishedSlack).UTC().Format(time.RFC3339)))
+	if err := getJSON(client, requestURL, nil, &response); err != nil {
+		return "", err
+	}
+	objects := make([]recentObject, 0, len(response.Data))
+	for _, tweet := range response.Data {
+		objects = append(objects, recentObject{ID: tweet.ID, Text: tweet.Text, CreatedAt: parsePlatformTime(tweet.CreatedAt)})
+	}
+	return findMatching(objects, p.Content, since), nil
+}
+
+func findMastodonStatus(p PostToSocialPayload, since time.Time) (string, error) {
+	var statuses []struct {
+		ID        string `json:"id"`
+		Content   string `json:"content"`
+		CreatedAt string `json:"created_at"`
+	}
+	requestURL := fmt.Sprintf("%s/api/v1/accounts/%s/statuses?limit=%d&exclude_replies=true&exclude_reblogs=true",
+		os.Getenv("MASTODON_BASE_URL"), p.ConnectionId, recentObjectsLimit)
+	if err := getJSON(p.client(), requestURL, map[string]string{"Authorization": "Bearer " + p.AccessToken}, &statuses); err != nil {
+		return "", err
+	}
+	objects := make([]recentObject, 0, len(statuses))
+	for _, status := range statuses {
+		objects = append(objects, recentObject{ID: status.ID, Text: status.Content, CreatedAt: parsePlatformTime(status.CreatedAt)})
+	}
+	return findMatching(objects, p.Content, since), nil
+}
+
+func findDiscordMessage(p PostToSocialPayload, since time.Time) (string, error) {
+	var messages []struct {
+		ID        string `json:"id"`
+		Content   string `json:"content"`
+		Timestamp string `json:"timestamp"`
+	}
+	requestURL := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages?limit=%d", p.ConnectionId, recentObjectsLimit)
+	if err := getJSON(p.client(), requestURL, map[string]string{"Authorization": "Bot " + p.AccessToken}, &messages); err != nil {
+		return "", err
+	}
+	objects := make([]recentObject, 0, len(messages))
+	for _, message := range messages {
+		objects = append(objects, recentObject{ID: message.ID, Text: message.Content, CreatedAt: parsePlatformTime(message.Timestamp)})
+	}
+	return findMatching(objects, p.Content, since), nil
+}
@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindMatching(t *testing.T) {
+	since := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) time.Time { return since.Add(offset) }
+
+	tests := []struct {
+		name    string
+		objects []recentObject
+		content string
+		want    string
+	}{
+		{
+			name:    "same text",
+			objects: []recentObject{{ID: "1", Text: "Launch day!", CreatedAt: at(time.Second)}},
+			content: "Launch day!",
+			want:    "1",
+		},
+		{
+			name:    "link appended by the platform",
+			objects: []recentObject{{ID: "1", Text: "Launch day! https://t.co/abc123", CreatedAt: at(time.Second)}},
+			content: "Launch day!",
+			want:    "1",
+		},
+		{
+			name:    "link rewritten inside the text",
+			objects: []recentObject{{ID: "1", Text: "Read https://t.co/xyz now", CreatedAt: at(time.Second)}},
+			content: "Read https://example.com/post now",
+			want:    "1",
+		},
+		{
+			name:    "markup, entities, case and spacing",
+			objects: []recentObject{{ID: "1", Text: "<p>Tom &amp; Jerry\n\nare   BACK</p>", CreatedAt: at(time.Second)}},
+			content: "Tom & Jerry are back",
+			want:    "1",
+		},
+		{
+			name:    "longer post starting with the same text",
+			objects: []recentObject{{ID: "1", Text: "New blog post: ten tips for spring", CreatedAt: at(time.Second)}},
+			content: "New blog post:",
+		},
+		{
+			name:    "shorter post",
+			objects: []recentObject{{ID: "1", Text: "New blog post:", CreatedAt: at(time.Second)}},
+			content: "New blog post: ten tips for spring",
+		},
+		{
+			name:    "published before the attempt",
+			objects: []recentObject{{ID: "1", Text: "Launch day!", CreatedAt: at(-time.Hour)}},
+			content: "Launch day!",
+		},
+		{
+			name:    "within the slack before the attempt",
+			objects: []recentObject{{ID: "1", Text: "Launch day!", CreatedAt: at(-time.Minute)}},
+			content: "Launch day!",
+			want:    "1",
+		},
+		{
+			name:    "no creation time",
+			objects: []recentObject{{ID: "1", Text: "Launch day!"}},
+			content: "Launch day!",
+			want:    "1",
+		},
+		{
+			name: "newest match wins",
+			objects: []recentObject{
+				{ID: "3", Text: "Something else", CreatedAt: at(3 * time.Second)},
+				{ID: "2", Text: "Launch day!", CreatedAt: at(2 * time.Second)},
+				{ID: "1", Text: "Launch day!", CreatedAt: at(time.Second)},
+			},
+			content: "Launch day!",
+			want:    "2",
+		},
+		{
+			name:    "post with only a link",
+			objects: []recentObject{{ID: "1", Text: "https://example.com", CreatedAt: at(time.Second)}},
+			content: "https://example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findMatching(tt.objects, tt.content, since); got != tt.want {
+				t.Fatalf("findMatching = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
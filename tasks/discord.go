@@ -12,7 +12,7 @@ import (
 )
 
 // HandleDiscordPostTask handles the actual posting to Discord using OAuth
-func HandleDiscordPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) error {
+func HandleDiscordPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 
 	content := p.Content
 	images := p.Images
@@ -25,15 +25,15 @@ func HandleDiscordPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) er
 	verifyReq, err := http.NewRequest("GET", verifyURL, nil)
 	if err != nil {
 		helpers.Logging("error", fmt.Sprintf("Failed to create verification request: %v", err))
-		return err
+		return "", err
 	}
 	verifyReq.Header.Set("Authorization", fmt.Sprintf("Bot %s", oauthToken))
 
-	client := &http.Client{}
+	client := p.client()
 	verifyResp, err := client.Do(verifyReq)
 	if err != nil {
 		helpers.Logging("error", fmt.Sprintf("Failed to verify bot token: %v", err))
-		return err
+		return "", err
 	}
 	defer verifyResp.Body.Close()
 
@@ -42,8 +42,7 @@ func HandleDiscordPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) er
 
 	if verifyResp.StatusCode != http.StatusOK {
 		helpers.Logging("error", fmt.Sprintf("Bot token verification failed: %s", string(verifyBody)))
-		FailedPost(app, "discord", socialPostId, fmt.Errorf("bot token verification failed: %s", string(verifyBody)))
-		return fmt.Errorf("bot token verification failed")
+		return "", fmt.Errorf("bot token verification failed: %s", string(verifyBody))
 	}
 
 	helpers.Logging("info", fmt.Sprintf("Posting to Discord (OAuth): content='%s', images=%v, channelID=%s, socialPostId=%v", content, images, channelID, socialPostId))
@@ -63,16 +62,14 @@ func HandleDiscordPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) er
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		helpers.Logging("error", fmt.Sprintf("Failed to marshal Discord payload: %v", err))
-		FailedPost(app, "discord", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	apiURL := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", channelID)
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		helpers.Logging("error", fmt.Sprintf("Failed to create Discord API request: %v", err))
-		FailedPost(app, "discord", socialPostId, err)
-		return err
+		return "", err
 	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", oauthToken))
 	req.Header.Set("Content-Type", "application/json")
@@ -81,37 +78,32 @@ func HandleDiscordPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) er
 	helpers.Logging("info", fmt.Sprintf("Discord API request headers: %v", req.Header))
 	helpers.Logging("info", fmt.Sprintf("Discord API request body: %s", string(jsonData)))
 
-	client = &http.Client{}
 	response, err := client.Do(req)
 	if err != nil {
 		helpers.Logging("error", fmt.Sprintf("HTTP POST to Discord API failed: %v", err))
-		FailedPost(app, "discord", socialPostId, err)
-		return err
+		return "", err
 	}
 	defer response.Body.Close()
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
 		helpers.Logging("error", fmt.Sprintf("Failed to read Discord API response body: %v", err))
-		FailedPost(app, "discord", socialPostId, err)
-		return err
+		return "", err
 	}
 	helpers.Logging("info", fmt.Sprintf("Discord API response: %s", string(body)))
 
-	if response.StatusCode >= 200 && response.StatusCode < 300 {
-		helpers.Logging("info", "Discord post published successfully (OAuth)")
-		// Discord returns a message object with an ID
-		var respData map[string]interface{}
-		_ = json.Unmarshal(body, &respData)
-		msgID := ""
-		if id, ok := respData["id"].(string); ok {
-			msgID = id
-		}
-		SuccessPost(app, "discord", socialPostId, msgID)
-	} else {
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
 		helpers.Logging("error", fmt.Sprintf("Discord API error: %s", string(body)))
-		FailedPost(app, "discord", socialPostId, fmt.Errorf("discord api error: %s", string(body)))
+		return "", fmt.Errorf("discord api error: %s", string(body))
 	}
 
-	return nil
+	helpers.Logging("info", "Discord post published successfully (OAuth)")
+	// Discord returns a message object with an ID
+	var respData map[string]interface{}
+	_ = json.Unmarshal(body, &respData)
+	msgID := ""
+	if id, ok := respData["id"].(string); ok {
+		msgID = id
+	}
+	return msgID, nil
 }
@@ -0,0 +1,162 @@
+package tasks
+
+import (
+	"bytes"
+	"content-clock/helpers"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// recorded bodies longer than this are truncated (media uploads)
+const maxRecordedBody = 8 * 1024
+
+// dryRunResponse is returned for every intercepted call. It carries the id
+// fields the platform tasks read, so multi-step flows (upload, then post)
+// continue with placeholder ids instead of stopping at the first request.
+const dryRunResponse = `{"id":"dry-run","media_id":0,"data":{"id":"dry-run","text":""},` +
+	`"value":{"asset":"urn:li:digitalmediaAsset:dry-run","uploadMechanism":{` +
+	`"com.linkedin.digitalmedia.uploading.MediaUploadHttpRequest":{"uploadUrl":"https://dry-run.invalid/upload"}}}}`
+
+// secrets in query strings and form bodies are masked in recorded requests
+var redactedParams = regexp.MustCompile(`(^|&)(access_token|client_secret|refresh_token)=[^&]*`)
+
+// RecordedRequest is a platform API call captured during a dry run.
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// DryRunResult is what a platform would have received for a post.
+type DryRunResult struct {
+	Platform        string            `json:"platform"`
+	Valid           bool              `json:"valid"`
+	Issues          []ValidationIssue `json:"issues"`
+	Requests        []RecordedRequest `json:"requests"`
+	PublishedPostId string            `json:"published_post_id"`
+	Error           string            `json:"error"`
+	ErrorClass      ErrorClass        `json:"error_class"`
+}
+
+type dryRunTransport struct {
+	mu       sync.Mutex
+	requests []RecordedRequest
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := RecordedRequest{
+		Method:  req.Method,
+		URL:     redactURL(req.URL),
+		Headers: map[string]string{},
+	}
+	for key := range req.Header {
+		value := req.Header.Get(key)
+		if strings.EqualFold(key, "Authorization") {
+			value = "REDACTED"
+		}
+		recorded.Headers[key] = value
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = describeBody(body)
+	}
+
+	t.mu.Lock()
+	t.requests = append(t.requests, recorded)
+	t.mu.Unlock()
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}, "X-Restli-Id": []string{"urn:li:share:dry-run"}},
+		Body:       io.NopCloser(strings.NewReader(dryRunResponse)),
+		Request:    req,
+	}, nil
+}
+
+// client returns the HTTP client platform calls must go through.
+func (p PostToSocialPayload) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return helpers.NewHTTPClient()
+}
+
+// IsDryRun reports whether platform calls are being recorded instead of sent.
+func (p PostToSocialPayload) IsDryRun() bool {
+	if p.HTTPClient == nil {
+		return false
+	}
+	_, ok := p.HTTPClient.Transport.(*dryRunTransport)
+	return ok
+}
+
+// DryRun validates the payload and runs it through the publisher's normal
+// code path with every platform call recorded and answered locally, so
+// nothing is uploaded or published.
+func DryRun(app *pocketbase.PocketBase, publisher Publisher, payload PostToSocialPayload) (result DryRunResult) {
+	transport := &dryRunTransport{}
+	payload.HTTPClient = &http.Client{Transport: transport}
+
+	result = DryRunResult{Platform: publisher.Name(), Valid: true, Issues: []ValidationIssue{}}
+	if err := publisher.Validate(payload); err != nil {
+		result.Valid = false
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			result.Issues = validationErr.Issues
+		} else {
+			result.Issues = append(result.Issues, ValidationIssue{Field: "content", Code: "invalid", Message: err.Error()})
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Error = fmt.Sprintf("publisher panicked: %v", r)
+		}
+		transport.mu.Lock()
+		result.Requests = append([]RecordedRequest{}, transport.requests...)
+		transport.mu.Unlock()
+	}()
+
+	publishedPostId, err := publisher.Publish(app, payload)
+	result.PublishedPostId = publishedPostId
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorClass = ClassifyError(publisher.Name(), err).Class
+	}
+	return result
+}
+
+func redactURL(u *url.URL) string {
+	copied := *u
+	copied.RawQuery = redactedParams.ReplaceAllString(copied.RawQuery, "${1}${2}=REDACTED")
+	return copied.String()
+}
+
+func describeBody(body []byte) string {
+	if !utf8.Valid(body) || bytes.Contains(body, []byte{0}) {
+		return fmt.Sprintf("[%d bytes of binary data]", len(body))
+	}
+	text := redactedParams.ReplaceAllString(string(body), "${1}${2}=REDACTED")
+	if len(text) > maxRecordedBody {
+		return text[:maxRecordedBody] + fmt.Sprintf("... [%d bytes total]", len(body))
+	}
+	return text
+}
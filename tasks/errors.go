@@ -0,0 +1,265 @@
+package tasks
+
+import (
+	"content-clock/helpers"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// ErrorClass says why a publish failed and drives what happens next: whether
+// the job is retried, what the user is told and whether the connection is
+// flagged as unhealthy.
+type ErrorClass string
+
+const (
+	ErrorTransient       ErrorClass = "transient"        // network blips, timeouts, 5xx
+	ErrorRateLimited     ErrorClass = "rate_limited"     // 429 or an exhausted budget
+	ErrorAuth            ErrorClass = "auth"             // token expired or revoked
+	ErrorPermission      ErrorClass = "permission"       // missing scope or role
+	ErrorTargetMissing   ErrorClass = "target_missing"   // page, board or channel is gone
+	ErrorContentRejected ErrorClass = "content_rejected" // policy, duplicate, invalid text
+	ErrorMediaInvalid    ErrorClass = "media_invalid"    // unsupported or unreachable media
+	ErrorConfiguration   ErrorClass = "configuration"    // missing app credentials, unsupported operation
+	ErrorUnknown         ErrorClass = "unknown"
+)
+
+// Retryable reports whether trying the same request again can succeed.
+// Unknown errors are retried so unclassified failures keep the old behavior.
+func (c ErrorClass) Retryable() bool {
+	return c == ErrorTransient || c == ErrorRateLimited || c == ErrorUnknown
+}
+
+// ConnectionHealth is the health flag a failure of this class puts on the
+// connection, or "" when the connection itself is fine.
+func (c ErrorClass) ConnectionHealth() string {
+	switch c {
+	case ErrorAuth:
+		return ConnectionHealthReauth
+	case ErrorPermission:
+		return ConnectionHealthPermission
+	case ErrorTargetMissing:
+		return ConnectionHealthTargetMissing
+	}
+	return ""
+}
+
+// PublishError is the error every Publisher returns from Publish.
+type PublishError struct {
+	Class    ErrorClass
+	Platform string
+	// Status is the HTTP status of the failed platform call, 0 if none.
+	Status int
+	// Code is the platform's own error code when it sends one.
+	Code string
+	Err  error
+}
+
+func (e *PublishError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage explains the failure for notifications.
+func (e *PublishError) UserMessage() string {
+	platform := platformLabel(e.Platform)
+	detail := trimNotificationText(e.Err.Error(), 140)
+	switch e.Class {
+	case ErrorTransient:
+		return fmt.Sprintf("%s could not be reached after several attempts (%s).", platform, detail)
+	case ErrorRateLimited:
+		return fmt.Sprintf("%s kept rejecting requests because of its rate limits.", platform)
+	case ErrorAuth:
+		return fmt.Sprintf("The %s connection has expired or was revoked. Reconnect the account to keep publishing.", platform)
+	case ErrorPermission:
+		return fmt.Sprintf("Content Clock is missing permission to post to this %s account. Reconnect it and grant the requested permissions.", platform)
+	case ErrorTargetMissing:
+		return fmt.Sprintf("The %s page, board or channel this post targets no longer exists.", platform)
+	case ErrorContentRejected:
+		return fmt.Sprintf("%s rejected the post: %s", platform, detail)
+	case ErrorMediaInvalid:
+		return fmt.Sprintf("%s could not use the attached media: %s", platform, detail)
+	case ErrorConfiguration:
+		return fmt.Sprintf("Publishing to %s is not configured on the server: %s", platform, detail)
+	}
+	return detail
+}
+
+// ClassifyError turns any publish error into a *PublishError. Errors that
+// already carry a class are returned as they are.
+func ClassifyError(platform string, err error) *PublishError {
+	return classifyFailure(platform, err, 0, "")
+}
+
+// classifyFailure classifies err using, in order: an existing class, the
+// platform's error body, the HTTP status, network error types and finally
+// well-known phrases in the message. status and body come from the last
+// failed response when the caller has it.
+func classifyFailure(platform string, err error, status int, body string) *PublishError {
+	if err == nil {
+		return nil
+	}
+	var publishErr *PublishError
+	if errors.As(err, &publishErr) {
+		return publishErr
+	}
+	result := &PublishError{Class: ErrorUnknown, Platform: platform, Status: status, Err: err}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		result.Class = ErrorContentRejected
+		for _, issue := range validationErr.Issues {
+			if issue.Field == "images" {
+				result.Class = ErrorMediaInvalid
+			}
+		}
+		return result
+	}
+	if errors.Is(err, ErrUnsupported) {
+		result.Class = ErrorConfiguration
+		return result
+	}
+
+	if status == 0 {
+		if code, errBody, ok := helpers.HTTPErrorResponse(err); ok {
+			status, body = code, errBody
+			result.Status = code
+		}
+	}
+	if body == "" {
+		body = err.Error()
+	}
+	if class, code, ok := classifyGraphError(body); ok {
+		result.Class, result.Code = class, code
+		return result
+	}
+
+	message := strings.ToLower(err.Error() + " " + body)
+	switch {
+	case status == http.StatusTooManyRequests:
+		result.Class = ErrorRateLimited
+	case status == http.StatusUnauthorized:
+		result.Class = ErrorAuth
+	case status == http.StatusForbidden && strings.Contains(message, "duplicate"):
+		result.Class = ErrorContentRejected
+	case status == http.StatusForbidden:
+		result.Class = ErrorPermission
+	case status == http.StatusNotFound || status == http.StatusGone:
+		result.Class = ErrorTargetMissing
+	case status == http.StatusRequestEntityTooLarge || status == http.StatusUnsupportedMediaType:
+		result.Class = ErrorMediaInvalid
+	case status == http.StatusRequestTimeout || status >= 500:
+		result.Class = ErrorTransient
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		result.Class = classifyMessage(message, ErrorContentRejected)
+	case isNetworkError(err):
+		result.Class = ErrorTransient
+	default:
+		result.Class = classifyMessage(message, ErrorUnknown)
+	}
+	return result
+}
+
+// Graph API (facebook, instagram, threads) error codes; see
+// https://developers.facebook.com/docs/graph-api/guides/error-handling
+var (
+	graphAuthCodes       = []int{102, 190}
+	graphAuthSubcodes    = []int{458, 459, 460, 463, 464, 467}
+	graphRateLimitCodes  = []int{4, 17, 32, 341, 613}
+	graphPermissionCodes = []int{3, 10}
+	graphTransientCodes  = []int{1, 2}
+	graphContentCodes    = []int{368, 506, 1609005}
+	graphMediaCodes      = []int{324, 352, 1363040, 2207026, 2207052, 36003, 9004}
+)
+
+type graphErrorBody struct {
+	Error *struct {
+		Message      string `json:"message"`
+		Type         string `json:"type"`
+		Code         int    `json:"code"`
+		ErrorSubcode int    `json:"error_subcode"`
+		IsTransient  bool   `json:"is_transient"`
+	} `json:"error"`
+}
+
+func classifyGraphError(body string) (ErrorClass, string, bool) {
+	start := strings.Index(body, "{")
+	if start < 0 {
+		return "", "", false
+	}
+	var parsed graphErrorBody
+	if err := json.Unmarshal([]byte(body[start:]), &parsed); err != nil || parsed.Error == nil || parsed.Error.Code == 0 {
+		return "", "", false
+	}
+	graphErr := parsed.Error
+	code := fmt.Sprintf("%d", graphErr.Code)
+	if graphErr.ErrorSubcode != 0 {
+		code += fmt.Sprintf("/%d", graphErr.ErrorSubcode)
+	}
+
+	switch {
+	case slices.Contains(graphAuthCodes, graphErr.Code) || slices.Contains(graphAuthSubcodes, graphErr.ErrorSubcode):
+		return ErrorAuth, code, true
+	case slices.Contains(graphRateLimitCodes, graphErr.Code) || (graphErr.Code >= 80000 && graphErr.Code <= 80014):
+		return ErrorRateLimited, code, true
+	case graphErr.Code == 100 && strings.Contains(graphErr.Message, "does not exist"):
+		return ErrorTargetMissing, code, true
+	case slices.Contains(graphPermissionCodes, graphErr.Code) || (graphErr.Code >= 200 && graphErr.Code <= 299):
+		return ErrorPermission, code, true
+	case graphErr.IsTransient || slices.Contains(graphTransientCodes, graphErr.Code):
+		return ErrorTransient, code, true
+	case slices.Contains(graphMediaCodes, graphErr.Code) || slices.Contains(graphMediaCodes, graphErr.ErrorSubcode):
+		return ErrorMediaInvalid, code, true
+	case slices.Contains(graphContentCodes, graphErr.Code) || slices.Contains(graphContentCodes, graphErr.ErrorSubcode):
+		return ErrorContentRejected, code, true
+	}
+	return classifyMessage(strings.ToLower(graphErr.Message), ErrorContentRejected), code, true
+}
+
+// phrases used when a platform error carries no usable status or code
+var messageClasses = []struct {
+	class   ErrorClass
+	phrases []string
+}{
+	{ErrorRateLimited, []string{"rate limit", "too many requests", "ratelimit"}},
+	{ErrorAuth, []string{"token has expired", "expired token", "invalid token", "invalid_token", "token was revoked", "unauthorized", "session has been invalidated", "invalid oauth", "bad authentication", "invalid_grant"}},
+	{ErrorPermission, []string{"permission", "not authorized", "forbidden", "insufficient scope", "scope"}},
+	{ErrorMediaInvalid, []string{"image", "media", "video", "aspect ratio", "file type", "upload"}},
+	{ErrorContentRejected, []string{"duplicate", "too long", "policy", "spam", "not allowed"}},
+	{ErrorTransient, []string{"timeout", "timed out", "temporarily", "try again", "connection reset", "service unavailable", "bad gateway"}},
+}
+
+func classifyMessage(message string, fallback ErrorClass) ErrorClass {
+	for _, entry := range messageClasses {
+		for _, phrase := range entry.phrases {
+			if strings.Contains(message, phrase) {
+				return entry.class
+			}
+		}
+	}
+	return fallback
+}
+
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &netErr) ||
+		errors.As(err, &dnsErr) ||
+		errors.As(err, &opErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
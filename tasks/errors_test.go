@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		err      error
+		status   int
+		body     string
+		want     ErrorClass
+		wantCode string
+	}{
+		{name: "already classified", err: &PublishError{Class: ErrorAuth, Err: errors.New("reconnect")}, status: 500, want: ErrorAuth},
+		{name: "validation", err: &ValidationError{Issues: []ValidationIssue{{Field: "content", Code: "too_long"}}}, want: ErrorContentRejected},
+		{name: "validation of the images", err: &ValidationError{Issues: []ValidationIssue{{Field: "content"}, {Field: "images"}}}, want: ErrorMediaInvalid},
+		{name: "unsupported operation", err: fmt.Errorf("delete: %w", ErrUnsupported), want: ErrorConfiguration},
+
+		{name: "429", err: errors.New("request failed"), status: 429, want: ErrorRateLimited},
+		{name: "401", err: errors.New("request failed"), status: 401, want: ErrorAuth},
+		{name: "403", err: errors.New("request failed"), status: 403, want: ErrorPermission},
+		{name: "403 duplicate", err: errors.New("request failed"), status: 403, body: `{"detail":"You are not allowed to create a Tweet with duplicate content."}`, want: ErrorContentRejected},
+		{name: "404", err: errors.New("request failed"), status: 404, want: ErrorTargetMissing},
+		{name: "413", err: errors.New("request failed"), status: 413, want: ErrorMediaInvalid},
+		{name: "503", err: errors.New("request failed"), status: 503, want: ErrorTransient},
+		{name: "400 without a known phrase", err: errors.New("request failed"), status: 400, body: "bad request", want: ErrorContentRejected},
+		{name: "422 about media", err: errors.New("request failed"), status: 422, body: `{"error":"Validation failed: File type of image/bmp is not supported"}`, want: ErrorMediaInvalid},
+
+		{name: "graph token expired", platform: "facebook", err: errors.New("graph"), status: 400, body: `{"error":{"message":"Error validating access token","code":190,"error_subcode":463}}`, want: ErrorAuth, wantCode: "190/463"},
+		{name: "graph throttled", platform: "instagram", err: errors.New("graph"), status: 400, body: `{"error":{"message":"Application request limit reached","code":4}}`, want: ErrorRateLimited, wantCode: "4"},
+		{name: "graph business throttling", platform: "facebook", err: errors.New("graph"), status: 400, body: `{"error":{"message":"too many calls","code":80001}}`, want: ErrorRateLimited, wantCode: "80001"},
+		{name: "graph page gone", platform: "facebook", err: errors.New("graph"), status: 400, body: `{"error":{"message":"Object with ID '123' does not exist","code":100}}`, want: ErrorTargetMissing, wantCode: "100"},
+		{name: "graph missing permission", platform: "facebook", err: errors.New("graph"), status: 403, body: `{"error":{"message":"Requires pages_manage_posts","code":200}}`, want: ErrorPermission, wantCode: "200"},
+		{name: "graph transient", platform: "threads", err: errors.New("graph"), status: 500, body: `{"error":{"message":"Please retry","code":2,"is_transient":true}}`, want: ErrorTransient, wantCode: "2"},
+		{name: "graph media", platform: "instagram", err: errors.New("graph"), status: 400, body: `{"error":{"message":"Invalid image","code":9004,"error_subcode":2207052}}`, want: ErrorMediaInvalid, wantCode: "9004/2207052"},
+		{name: "graph body in the message", platform: "facebook", err: errors.New(`post failed: {"error":{"message":"Spam","code":368}}`), want: ErrorContentRejected, wantCode: "368"},
+
+		{name: "timeout", err: fmt.Errorf("post: %w", context.DeadlineExceeded), want: ErrorTransient},
+		{name: "dns failure", err: &net.DNSError{Err: "no such host", Name: "mastodon.example"}, want: ErrorTransient},
+		{name: "expired token phrase", err: errors.New("oauth: invalid_grant"), want: ErrorAuth},
+		{name: "rate limit phrase", err: errors.New("You are doing that too much: rate limit"), want: ErrorRateLimited},
+		{name: "nothing recognisable", err: errors.New("something broke"), want: ErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyFailure(tt.platform, tt.err, tt.status, tt.body)
+			if got.Class != tt.want || got.Code != tt.wantCode {
+				t.Fatalf("classifyFailure = class %q code %q, want %q %q", got.Class, got.Code, tt.want, tt.wantCode)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Fatalf("classified error does not wrap %v", tt.err)
+			}
+		})
+	}
+
+	if ClassifyError("twitter", nil) != nil {
+		t.Fatal("ClassifyError(nil) is not nil")
+	}
+}
+
+func TestErrorClassOutcomes(t *testing.T) {
+	tests := []struct {
+		class         ErrorClass
+		wantRetryable bool
+		wantHealth    string
+	}{
+		{class: ErrorTransient, wantRetryable: true},
+		{class: ErrorRateLimited, wantRetryable: true},
+		{class: ErrorUnknown, wantRetryable: true},
+		{class: ErrorAuth, wantHealth: ConnectionHealthReauth},
+		{class: ErrorPermission, wantHealth: ConnectionHealthPermission},
+		{class: ErrorTargetMissing, wantHealth: ConnectionHealthTargetMissing},
+		{class: ErrorContentRejected},
+		{class: ErrorMediaInvalid},
+		{class: ErrorConfiguration},
+	}
+	for _, tt := range tests {
+		if got := tt.class.Retryable(); got != tt.wantRetryable {
+			t.Fatalf("%s.Retryable() = %v, want %v", tt.class, got, tt.wantRetryable)
+		}
+		if got := tt.class.ConnectionHealth(); got != tt.wantHealth {
+			t.Fatalf("%s.ConnectionHealth() = %q, want %q", tt.class, got, tt.wantHealth)
+		}
+	}
+}
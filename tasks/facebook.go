@@ -13,7 +13,7 @@ import (
 	"github.com/pocketbase/pocketbase"
 )
 
-func HandleFacebookPagePostTask(app *pocketbase.PocketBase, p PostToSocialPayload) error {
+func HandleFacebookPagePostTask(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 	content := p.Content
 	images := p.Images
 	connectionId := p.ConnectionId
@@ -36,28 +36,24 @@ func HandleFacebookPagePostTask(app *pocketbase.PocketBase, p PostToSocialPayloa
 	if containsVideoFile(images) {
 		if len(images) != 1 {
 			err := errors.New("facebook supports only one video per post")
-			FailedPost(app, "facebook", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		videoURL := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, images[0])
-		videoID, err := UploadVideo(accessToken, connectionId, videoURL, content)
+		videoID, err := UploadVideo(p.client(), accessToken, connectionId, videoURL, content)
 		if err != nil {
-			FailedPost(app, "facebook", socialPostId, err)
-			return err
+			return "", err
 		}
-		SuccessPost(app, "facebook", socialPostId, videoID)
-		return nil
+		return videoID, nil
 	}
 
 	var mediaIds []string
 	if len(images) > 0 {
 		for _, image := range images {
 			imageUrl := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, image)
-			id, err := UploadImge(accessToken, connectionId, imageUrl)
+			id, err := UploadImge(p.client(), accessToken, connectionId, imageUrl)
 			if err != nil {
-				FailedPost(app, "facebook", socialPostId, err)
-				return err
+				return "", err
 			}
 			mediaIds = append(mediaIds, id)
 		}
@@ -75,34 +71,30 @@ func HandleFacebookPagePostTask(app *pocketbase.PocketBase, p PostToSocialPayloa
 
 	payload := EncodePostBody(postBody)
 
-	client := &http.Client{}
+	client := p.client()
 	req, err := http.NewRequest(method, url, payload)
 
 	if err != nil {
-		FailedPost(app, "facebook", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 	res, err := client.Do(req)
 	if err != nil {
-		FailedPost(app, "facebook", socialPostId, err)
-		return err
+		return "", err
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		FailedPost(app, "facebook", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	post := make(map[string]interface{})
 	err = json.Unmarshal(body, &post)
 	if err != nil {
-		FailedPost(app, "facebook", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	app.Logger().Info("Facebook post body", "body", string(body))
@@ -114,14 +106,11 @@ func HandleFacebookPagePostTask(app *pocketbase.PocketBase, p PostToSocialPayloa
 				errMsg = msg
 			}
 		}
-		FailedPost(app, "facebook", socialPostId, errors.New(errMsg))
-		return errors.New(errMsg)
-	} else {
-		postId, _ := post["id"].(string)
-		SuccessPost(app, "facebook", socialPostId, postId)
+		return "", errors.New(errMsg)
 	}
 
-	return nil
+	postId, _ := post["id"].(string)
+	return postId, nil
 }
 
 func EncodePostBody(postBody map[string]string) *strings.Reader {
@@ -132,7 +121,7 @@ func EncodePostBody(postBody map[string]string) *strings.Reader {
 	return strings.NewReader(form.Encode())
 }
 
-func UploadImge(accessToken, connectionId, imagePath string) (string, error) {
+func UploadImge(client *http.Client, accessToken, connectionId, imagePath string) (string, error) {
 	url := fmt.Sprintf("https://graph.facebook.com/%s/photos", connectionId)
 	payload := strings.NewReader(fmt.Sprintf("url=%s&published=false&access_token=%s", imagePath, accessToken))
 
@@ -142,7 +131,6 @@ func UploadImge(accessToken, connectionId, imagePath string) (string, error) {
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -187,7 +175,7 @@ func UploadImge(accessToken, connectionId, imagePath string) (string, error) {
 	return respData.ID, nil
 }
 
-func UploadVideo(accessToken, connectionId, videoPath, description string) (string, error) {
+func UploadVideo(client *http.Client, accessToken, connectionId, videoPath, description string) (string, error) {
 	requestURL := fmt.Sprintf("https://graph.facebook.com/%s/videos", connectionId)
 	payload := strings.NewReader(fmt.Sprintf("file_url=%s&description=%s&published=true&access_token=%s", url.QueryEscape(videoPath), url.QueryEscape(description), accessToken))
 
@@ -197,7 +185,6 @@ func UploadVideo(accessToken, connectionId, videoPath, description string) (stri
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -0,0 +1,116 @@
+package tasks
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// handoffTTL is how long the frontend has to redeem a handoff code.
+const handoffTTL = 5 * time.Minute
+
+// ErrHandoffInvalid is returned for handoff codes that are unknown, expired,
+// already redeemed or issued for another platform or user.
+var ErrHandoffInvalid = errors.New("connect code is invalid or expired, please connect the account again")
+
+// OAuthHandoff is what an OAuth callback learned about the account. It stays
+// on the server; the frontend only gets a one-time code for it.
+type OAuthHandoff struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	// AccountId is the platform's id of the account that logged in
+	AccountId string `json:"account_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Avatar    string `json:"avatar,omitempty"`
+	MetaData  string `json:"meta_data,omitempty"`
+}
+
+func handoffCodeHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateHandoff stores the bundle encrypted under a new one-time code that
+// only user can redeem, and returns the code. Expired handoffs are pruned on
+// the way.
+func CreateHandoff(app *pocketbase.PocketBase, platform string, user string, handoff OAuthHandoff) (string, error) {
+	if _, err := app.NonconcurrentDB().Delete("oauth_handoffs", dbx.NewExp("expires_at < {:now}", dbx.Params{"now": types.NowDateTime().String()})).Execute(); err != nil {
+		app.Logger().Warn("Failed to prune expired OAuth handoffs", "error", err.Error())
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(raw)
+
+	encoded, err := json.Marshal(handoff)
+	if err != nil {
+		return "", err
+	}
+	bundle, err := EncryptToken(string(encoded))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt OAuth handoff: %w", err)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("oauth_handoffs")
+	if err != nil {
+		return "", fmt.Errorf("oauth_handoffs collection is not initialized: %w", err)
+	}
+	record := core.NewRecord(collection)
+	record.Set("code_hash", handoffCodeHash(code))
+	record.Set("platform", platform)
+	record.Set("user", user)
+	record.Set("bundle", bundle)
+	record.Set("expires_at", time.Now().Add(handoffTTL).UTC())
+	if err := app.Save(record); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemHandoff returns the bundle stored under code and deletes it, so a
+// code works once even when two requests race for it.
+func RedeemHandoff(app *pocketbase.PocketBase, platform string, user string, code string) (OAuthHandoff, error) {
+	if code == "" {
+		return OAuthHandoff{}, ErrHandoffInvalid
+	}
+	record, err := app.FindFirstRecordByData("oauth_handoffs", "code_hash", handoffCodeHash(code))
+	if err != nil {
+		return OAuthHandoff{}, ErrHandoffInvalid
+	}
+
+	// whoever deletes the row owns the code
+	result, err := app.NonconcurrentDB().Delete("oauth_handoffs", dbx.HashExp{"id": record.Id}).Execute()
+	if err != nil {
+		return OAuthHandoff{}, err
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		return OAuthHandoff{}, ErrHandoffInvalid
+	}
+	if record.GetString("platform") != platform || record.GetString("user") != user || record.GetDateTime("expires_at").Time().Before(time.Now()) {
+		return OAuthHandoff{}, ErrHandoffInvalid
+	}
+
+	decoded, err := decryptToken(record.GetString("bundle"))
+	if err != nil {
+		return OAuthHandoff{}, fmt.Errorf("failed to decrypt OAuth handoff: %w", err)
+	}
+	var handoff OAuthHandoff
+	if err := json.Unmarshal([]byte(decoded), &handoff); err != nil {
+		return OAuthHandoff{}, fmt.Errorf("failed to read OAuth handoff: %w", err)
+	}
+	return handoff, nil
+}
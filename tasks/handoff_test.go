@@ -0,0 +1,120 @@
+package tasks
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedeemHandoff(t *testing.T) {
+	useTokenKeys(t, testTokenKey("k1", 1))
+	app := newTestApp(t)
+	bundle := OAuthHandoff{AccessToken: "access-token", RefreshToken: "refresh-token", ExpiresIn: 3600, AccountId: "acct1", Username: "someone"}
+
+	tests := []struct {
+		name     string
+		platform string
+		user     string
+		code     func(code string) string
+		expire   bool
+		wantErr  bool
+	}{
+		{name: "issuing user on the same platform", platform: "linkedin", user: "user1"},
+		{name: "another platform", platform: "twitter", user: "user1", wantErr: true},
+		{name: "another user", platform: "linkedin", user: "user2", wantErr: true},
+		{name: "expired code", platform: "linkedin", user: "user1", expire: true, wantErr: true},
+		{name: "unknown code", platform: "linkedin", user: "user1", code: func(code string) string { return code + "x" }, wantErr: true},
+		{name: "empty code", platform: "linkedin", user: "user1", code: func(string) string { return "" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := CreateHandoff(app, "linkedin", "user1", bundle)
+			if err != nil {
+				t.Fatalf("CreateHandoff: %v", err)
+			}
+			stored, err := app.FindFirstRecordByData("oauth_handoffs", "code_hash", handoffCodeHash(code))
+			if err != nil {
+				t.Fatalf("find handoff: %v", err)
+			}
+			if strings.Contains(stored.GetString("bundle"), bundle.AccessToken) || strings.Contains(stored.GetString("bundle"), code) {
+				t.Fatalf("stored bundle is readable: %q", stored.GetString("bundle"))
+			}
+			if tt.expire {
+				stored.Set("expires_at", time.Now().Add(-time.Second).UTC())
+				if err := app.Save(stored); err != nil {
+					t.Fatalf("expire handoff: %v", err)
+				}
+			}
+			if tt.code != nil {
+				code = tt.code(code)
+			}
+
+			got, err := RedeemHandoff(app, tt.platform, tt.user, code)
+			if tt.wantErr {
+				if !errors.Is(err, ErrHandoffInvalid) {
+					t.Fatalf("RedeemHandoff error = %v, want ErrHandoffInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RedeemHandoff: %v", err)
+			}
+			if got != bundle {
+				t.Fatalf("RedeemHandoff = %+v, want %+v", got, bundle)
+			}
+			if _, err := RedeemHandoff(app, tt.platform, tt.user, code); !errors.Is(err, ErrHandoffInvalid) {
+				t.Fatalf("second redemption error = %v, want ErrHandoffInvalid", err)
+			}
+		})
+	}
+}
+
+func TestRedeemHandoffHasOneWinner(t *testing.T) {
+	app := newTestApp(t)
+	code, err := CreateHandoff(app, "mastodon", "user1", OAuthHandoff{AccessToken: "access-token"})
+	if err != nil {
+		t.Fatalf("CreateHandoff: %v", err)
+	}
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if handoff, err := RedeemHandoff(app, "mastodon", "user1", code); err == nil && handoff.AccessToken == "access-token" {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Fatalf("the code was redeemed %d times, want 1", wins.Load())
+	}
+}
+
+func TestCreateHandoffPrunesExpired(t *testing.T) {
+	app := newTestApp(t)
+	old, err := CreateHandoff(app, "mastodon", "user1", OAuthHandoff{AccessToken: "old"})
+	if err != nil {
+		t.Fatalf("CreateHandoff: %v", err)
+	}
+	stored, err := app.FindFirstRecordByData("oauth_handoffs", "code_hash", handoffCodeHash(old))
+	if err != nil {
+		t.Fatalf("find handoff: %v", err)
+	}
+	stored.Set("expires_at", time.Now().Add(-time.Minute).UTC())
+	if err := app.Save(stored); err != nil {
+		t.Fatalf("expire handoff: %v", err)
+	}
+
+	if _, err := CreateHandoff(app, "mastodon", "user1", OAuthHandoff{AccessToken: "new"}); err != nil {
+		t.Fatalf("CreateHandoff: %v", err)
+	}
+	if _, err := app.FindRecordById("oauth_handoffs", stored.Id); err == nil {
+		t.Fatal("expired handoff was not pruned")
+	}
+}
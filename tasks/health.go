@@ -0,0 +1,69 @@
+package tasks
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Values of the connections.health flag.
+const (
+	ConnectionHealthOK            = "ok"
+	ConnectionHealthReauth        = "reauth_required"
+	ConnectionHealthPermission    = "permission_denied"
+	ConnectionHealthTargetMissing = "target_missing"
+)
+
+// UpdateConnectionHealth records the outcome of a publish on the post's
+// connection. Failures that are not the connection's fault leave it alone;
+// a nil error marks it healthy again. The owner is notified when the
+// connection becomes unhealthy.
+func UpdateConnectionHealth(app *pocketbase.PocketBase, connectionId string, publishErr *PublishError) {
+	health := ConnectionHealthOK
+	healthError := ""
+	if publishErr != nil {
+		health = publishErr.Class.ConnectionHealth()
+		if health == "" {
+			return
+		}
+		healthError = publishErr.Error()
+	}
+
+	connection, err := app.FindRecordById("connections", connectionId)
+	if err != nil {
+		return
+	}
+	previous := connection.GetString("health")
+	if previous == health || (previous == "" && health == ConnectionHealthOK) {
+		return
+	}
+
+	connection.Set("health", health)
+	connection.Set("health_error", healthError)
+	connection.Set("health_checked_at", types.NowDateTime())
+	if err := app.Save(connection); err != nil {
+		app.Logger().Error("Failed to update connection health", "connection", connectionId, "health", health, "error", err.Error())
+		return
+	}
+	app.Logger().Info("Connection health changed", "connection", connectionId, "from", previous, "to", health)
+
+	if health == ConnectionHealthOK {
+		return
+	}
+	collection, err := app.FindCollectionByNameOrId("notifications")
+	if err != nil {
+		return
+	}
+	notification := core.NewRecord(collection)
+	notification.Set("user", connection.GetString("user"))
+	notification.Set("connection", connection.Id)
+	notification.Set("type", "connection_unhealthy")
+	notification.Set("title", platformLabel(connection.GetString("connection_name"))+" connection needs attention")
+	notification.Set("message", publishErr.UserMessage())
+	notification.Set("created_at", time.Now())
+	if err := app.Save(notification); err != nil {
+		app.Logger().Error("Failed to save notification", "connection", connectionId, "type", "connection_unhealthy", "error", err.Error())
+	}
+}
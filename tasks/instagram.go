@@ -12,12 +12,13 @@ import (
 	"github.com/pocketbase/pocketbase"
 )
 
-func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) error {
+func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 	content := p.Content
 	images := p.Images
 	connectionId := p.ConnectionId
 	accessToken := p.AccessToken
 	socialPostId := p.SocialPostId
+	client := p.client()
 
 	app.Logger().Info("Posting to Instagram", "connectionId", connectionId, "content", content, "images", images)
 
@@ -27,15 +28,13 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 
 	if imageCount == 0 {
 		err := errors.New("No images for Instagram")
-		FailedPost(app, "instagram", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	if hasVideo {
 		if imageCount != 1 {
 			err := errors.New("Instagram supports only one video per post")
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		videoURL := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, images[0])
@@ -48,22 +47,19 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 		url := fmt.Sprintf("https://graph.facebook.com/v19.0/%s/media?access_token=%s", connectionId, accessToken)
 		jsonData, err := json.Marshal(postBody)
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
-		res, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+		res, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 		defer res.Body.Close()
 
 		body, _ := ioutil.ReadAll(res.Body)
 		var result map[string]interface{}
 		if err := json.Unmarshal(body, &result); err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		if result["id"] == nil {
@@ -71,19 +67,16 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 			if e, ok := result["error"]; ok {
 				errMsg = e.(map[string]interface{})["message"].(string)
 			}
-			FailedPost(app, "instagram", socialPostId, errors.New(errMsg))
-			return errors.New(errMsg)
+			return "", errors.New(errMsg)
 		}
 
 		postID := result["id"].(string)
-		err = PublishMedia(connectionId, postID, accessToken)
+		err = PublishMedia(client, connectionId, postID, accessToken)
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
-		SuccessPost(app, "instagram", socialPostId, postID)
-		return nil
+		return postID, nil
 	}
 
 	if imageCount == 1 {
@@ -97,22 +90,19 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 		url := fmt.Sprintf("https://graph.facebook.com/v19.0/%s/media?access_token=%s", connectionId, accessToken)
 		jsonData, err := json.Marshal(postBody)
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
-		res, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+		res, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 		defer res.Body.Close()
 
 		body, _ := ioutil.ReadAll(res.Body)
 		var result map[string]interface{}
 		if err := json.Unmarshal(body, &result); err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		if result["id"] == nil {
@@ -120,25 +110,21 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 			if e, ok := result["error"]; ok {
 				errMsg = e.(map[string]interface{})["message"].(string)
 			}
-			FailedPost(app, "instagram", socialPostId, errors.New(errMsg))
-			return errors.New(errMsg)
+			return "", errors.New(errMsg)
 		}
 
 		postID := result["id"].(string)
-		err = PublishMedia(connectionId, postID, accessToken)
+		err = PublishMedia(client, connectionId, postID, accessToken)
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
-		SuccessPost(app, "instagram", socialPostId, postID)
-		return nil
+		return postID, nil
 	}
 
 	if imageCount < 2 || imageCount > 10 {
 		err := fmt.Errorf("carousel posts require 2 to 10 images. Got: %d", imageCount)
-		FailedPost(app, "instagram", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	// === CAROUSEL POST ===
@@ -156,22 +142,19 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 		url := fmt.Sprintf("https://graph.facebook.com/v19.0/%s/media?access_token=%s", connectionId, accessToken)
 		jsonData, err := json.Marshal(postBody)
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
-		res, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+		res, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
 		if err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 		defer res.Body.Close()
 
 		body, _ := ioutil.ReadAll(res.Body)
 		var result map[string]interface{}
 		if err := json.Unmarshal(body, &result); err != nil {
-			FailedPost(app, "instagram", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		if result["id"] == nil {
@@ -179,8 +162,7 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 			if e, ok := result["error"]; ok {
 				errMsg = e.(map[string]interface{})["message"].(string)
 			}
-			FailedPost(app, "instagram", socialPostId, errors.New(errMsg))
-			return errors.New(errMsg)
+			return "", errors.New(errMsg)
 		}
 
 		creationIDs = append(creationIDs, result["id"].(string))
@@ -194,23 +176,20 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 
 	carouselJson, err := json.Marshal(carouselPostBody)
 	if err != nil {
-		FailedPost(app, "instagram", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	carouselURL := fmt.Sprintf("https://graph.facebook.com/v19.0/%s/media?access_token=%s", connectionId, accessToken)
-	res, err := http.Post(carouselURL, "application/json", bytes.NewBuffer(carouselJson))
+	res, err := client.Post(carouselURL, "application/json", bytes.NewBuffer(carouselJson))
 	if err != nil {
-		FailedPost(app, "instagram", socialPostId, err)
-		return err
+		return "", err
 	}
 	defer res.Body.Close()
 
 	body, _ := ioutil.ReadAll(res.Body)
 	var carouselResp map[string]interface{}
 	if err := json.Unmarshal(body, &carouselResp); err != nil {
-		FailedPost(app, "instagram", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	if carouselResp["id"] == nil {
@@ -218,26 +197,23 @@ func HandleInstagramPostTask(app *pocketbase.PocketBase, p PostToSocialPayload)
 		if e, ok := carouselResp["error"]; ok {
 			errMsg = e.(map[string]interface{})["message"].(string)
 		}
-		FailedPost(app, "instagram", socialPostId, errors.New(errMsg))
-		return errors.New(errMsg)
+		return "", errors.New(errMsg)
 	}
 
 	postID := carouselResp["id"].(string)
-	err = PublishMedia(connectionId, postID, accessToken)
+	err = PublishMedia(client, connectionId, postID, accessToken)
 	if err != nil {
-		FailedPost(app, "instagram", socialPostId, err)
-		return err
+		return "", err
 	}
 
-	SuccessPost(app, "instagram", socialPostId, postID)
-	return nil
+	return postID, nil
 }
 
-func PublishMedia(connectionId, postId, accessToken string) error {
+func PublishMedia(client *http.Client, connectionId, postId, accessToken string) error {
 
 	url := "https://graph.facebook.com/v19.0/" + connectionId + "/media_publish?creation_id=" + postId + "&access_token=" + accessToken
 
-	response, err := http.Post(url, "application/json", nil)
+	response, err := client.Post(url, "application/json", nil)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"content-clock/helpers"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const defaultLeaseSeconds = 300
+
+var (
+	instanceId     string
+	instanceIdOnce sync.Once
+)
+
+// InstanceId identifies this process as a lease owner. It prefers an explicit
+// INSTANCE_ID, then the Fly machine id, then hostname plus a random suffix.
+func InstanceId() string {
+	instanceIdOnce.Do(func() {
+		for _, key := range []string{"INSTANCE_ID", "FLY_MACHINE_ID"} {
+			if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+				instanceId = value
+				return
+			}
+		}
+		host, _ := os.Hostname()
+		suffix := make([]byte, 4)
+		_, _ = rand.Read(suffix)
+		instanceId = host + "-" + hex.EncodeToString(suffix)
+	})
+	return instanceId
+}
+
+func leaseDuration() time.Duration {
+	return time.Duration(helpers.GetEnvInt("PUBLISH_LEASE_SECONDS", defaultLeaseSeconds)) * time.Second
+}
+
+// ClaimPost atomically moves a scheduled post to "sending" and leases it to
+// this instance. It returns false when another instance or tick got there first.
+func ClaimPost(app *pocketbase.PocketBase, postId string) (bool, error) {
+	result, err := app.DB().NewQuery(`UPDATE posts
+			SET status = 'sending', lease_owner = {:owner}, lease_expires_at = {:expires}
+			WHERE id = {:id}
+			AND status = 'scheduled'
+			AND (coalesce(lease_expires_at, '') = '' OR datetime(lease_expires_at) <= datetime('now'));`).Bind(dbx.Params{
+		"id":      postId,
+		"owner":   InstanceId(),
+		"expires": types.NowDateTime().Add(leaseDuration()).String(),
+	}).Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// claimJob atomically moves a queued job to "running", counting the attempt.
+// On success the in-memory record is refreshed to match the stored row.
+func claimJob(app *pocketbase.PocketBase, job *core.Record) (bool, error) {
+	expires := types.NowDateTime().Add(leaseDuration())
+	result, err := app.DB().NewQuery(`UPDATE publish_jobs
+			SET status = {:running}, attempts = attempts + 1, lease_owner = {:owner}, lease_expires_at = {:expires}
+			WHERE id = {:id} AND status = {:queued};`).Bind(dbx.Params{
+		"id":      job.Id,
+		"running": JobStatusRunning,
+		"queued":  JobStatusQueued,
+		"owner":   InstanceId(),
+		"expires": expires.String(),
+	}).Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows != 1 {
+		return false, nil
+	}
+
+	job.Set("status", JobStatusRunning)
+	job.Set("attempts", job.GetInt("attempts")+1)
+	job.Set("lease_owner", InstanceId())
+	job.Set("lease_expires_at", expires)
+	return true, nil
+}
+
+// leasePost marks the post as sending and (re)leases it to this instance for
+// the duration of a publish attempt.
+func leasePost(app *pocketbase.PocketBase, postId string) {
+	record, err := app.FindRecordById("posts", postId)
+	if err != nil {
+		app.Logger().Error("Failed to load post for lease", "postId", postId, "error", err.Error())
+		return
+	}
+	record.Set("status", "sending")
+	record.Set("lease_owner", InstanceId())
+	record.Set("lease_expires_at", types.NowDateTime().Add(leaseDuration()))
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Failed to lease post", "postId", postId, "error", err.Error())
+	}
+}
+
+func clearLease(record *core.Record) {
+	record.Set("lease_owner", "")
+	record.Set("lease_expires_at", "")
+}
@@ -0,0 +1,180 @@
+package tasks
+
+import (
+	"content-clock/models"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestApp bootstraps an app in a temporary data dir with the collections
+// created by DB_MIGRATE.
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+	t.Setenv("DB_MIGRATE", "1")
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	t.Cleanup(func() { _ = app.ResetBootstrapState() })
+	if err := models.MigrateCollectionsIfEnabled(app); err != nil {
+		t.Fatalf("MigrateCollectionsIfEnabled: %v", err)
+	}
+	return app
+}
+
+func saveTestRecord(t *testing.T, app core.App, collection string, fields map[string]any) *core.Record {
+	t.Helper()
+	c, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatalf("FindCollectionByNameOrId(%s): %v", collection, err)
+	}
+	record := core.NewRecord(c)
+	record.Load(fields)
+	if err := app.Save(record); err != nil {
+		t.Fatalf("save %s: %v", collection, err)
+	}
+	return record
+}
+
+func reload(t *testing.T, app core.App, record *core.Record) *core.Record {
+	t.Helper()
+	fresh, err := app.FindRecordById(record.Collection().Name, record.Id)
+	if err != nil {
+		t.Fatalf("reload %s: %v", record.Id, err)
+	}
+	return fresh
+}
+
+func TestClaimPost(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name   string
+		fields map[string]any
+		want   bool
+	}{
+		{name: "scheduled post", fields: map[string]any{"status": "scheduled"}, want: true},
+		{name: "expired lease", fields: map[string]any{"status": "scheduled", "lease_owner": "other", "lease_expires_at": now.Add(-time.Minute)}, want: true},
+		{name: "live lease of another instance", fields: map[string]any{"status": "scheduled", "lease_owner": "other", "lease_expires_at": now.Add(time.Minute)}},
+		{name: "already sending", fields: map[string]any{"status": "sending"}},
+		{name: "draft", fields: map[string]any{"status": "draft"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := saveTestRecord(t, app, "posts", tt.fields)
+			claimed, err := ClaimPost(app, post.Id)
+			if err != nil {
+				t.Fatalf("ClaimPost: %v", err)
+			}
+			if claimed != tt.want {
+				t.Fatalf("ClaimPost = %v, want %v", claimed, tt.want)
+			}
+			stored := reload(t, app, post)
+			if !tt.want {
+				if stored.GetString("status") != post.GetString("status") || stored.GetString("lease_owner") != post.GetString("lease_owner") {
+					t.Fatalf("unclaimed post changed: %v", stored)
+				}
+				return
+			}
+			if stored.GetString("status") != "sending" || stored.GetString("lease_owner") != InstanceId() || !stored.GetDateTime("lease_expires_at").Time().After(now) {
+				t.Fatalf("claimed post = status %q owner %q expires %v", stored.GetString("status"), stored.GetString("lease_owner"), stored.GetDateTime("lease_expires_at"))
+			}
+			if again, _ := ClaimPost(app, post.Id); again {
+				t.Fatal("a claimed post was claimed again")
+			}
+		})
+	}
+}
+
+func TestClaimPostHasOneWinner(t *testing.T) {
+	app := newTestApp(t)
+	post := saveTestRecord(t, app, "posts", map[string]any{"status": "scheduled"})
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if claimed, err := ClaimPost(app, post.Id); err == nil && claimed {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Fatalf("%d ticks claimed the same post, want 1", wins.Load())
+	}
+}
+
+func TestClaimJob(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		status string
+		want   bool
+	}{
+		{name: "queued job", status: JobStatusQueued, want: true},
+		{name: "running job", status: JobStatusRunning},
+		{name: "completed job", status: JobStatusCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := saveTestRecord(t, app, publishJobsCollection, map[string]any{"status": tt.status, "attempts": 1})
+			claimed, err := claimJob(app, job)
+			if err != nil {
+				t.Fatalf("claimJob: %v", err)
+			}
+			if claimed != tt.want {
+				t.Fatalf("claimJob = %v, want %v", claimed, tt.want)
+			}
+			stored := reload(t, app, job)
+			wantAttempts, wantStatus := 1, tt.status
+			if tt.want {
+				wantAttempts, wantStatus = 2, JobStatusRunning
+			}
+			if stored.GetInt("attempts") != wantAttempts || stored.GetString("status") != wantStatus {
+				t.Fatalf("stored job = status %q attempts %d, want %q %d", stored.GetString("status"), stored.GetInt("attempts"), wantStatus, wantAttempts)
+			}
+			if tt.want && (job.GetInt("attempts") != wantAttempts || job.GetString("lease_owner") != InstanceId() || stored.GetString("lease_owner") != InstanceId()) {
+				t.Fatalf("claimed job lease = %q (record %q, attempts %d)", stored.GetString("lease_owner"), job.GetString("lease_owner"), job.GetInt("attempts"))
+			}
+		})
+	}
+}
+
+func TestClaimJobHasOneWinner(t *testing.T) {
+	app := newTestApp(t)
+	job := saveTestRecord(t, app, publishJobsCollection, map[string]any{"status": JobStatusQueued})
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every worker holds its own copy, as after a separate fetch
+			fetched, err := app.FindRecordById(publishJobsCollection, job.Id)
+			if err != nil {
+				return
+			}
+			if claimed, err := claimJob(app, fetched); err == nil && claimed {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Fatalf("%d workers claimed the same job, want 1", wins.Load())
+	}
+	if attempts := reload(t, app, job).GetInt("attempts"); attempts != 1 {
+		t.Fatalf("attempts = %d, want 1", attempts)
+	}
+}
@@ -18,7 +18,7 @@ type LinkedinResponse struct {
 	ID string `json:"id"`
 }
 
-func HandleLinkedinProfilePostTask(app *pocketbase.PocketBase, p PostToSocialPayload) error {
+func HandleLinkedinProfilePostTask(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 
 	content := p.Content
 	images := p.Images
@@ -34,27 +34,26 @@ func HandleLinkedinProfilePostTask(app *pocketbase.PocketBase, p PostToSocialPay
 
 	if len(images) > 0 {
 
-		uploadRegisResp, err := LinkedinRegisterUpload(connectionId, accessToken)
+		uploadRegisResp, err := LinkedinRegisterUpload(p.client(), connectionId, accessToken)
 		if err != nil {
-			FailedPost(app, "linkedin", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		uploadUrl := uploadRegisResp.Value.UploadMechanism.MediaUploadHttpRequest.UploadUrl
 
 		if uploadUrl == "" {
 
-			FailedPost(app, "linkedin", socialPostId, errors.New("upload url is empty"))
-			return err
+			return "", errors.New("upload url is empty")
 		}
 		backendHost := os.Getenv("API_HOST")
 		imageUrl := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, images[0])
-		err = linkedinUploadMedia(imageUrl, uploadUrl, accessToken)
+		err = linkedinUploadMedia(p.client(), imageUrl, uploadUrl, accessToken)
 		if err != nil {
-			FailedPost(app, "linkedin", socialPostId, err)
-			return err
+			return "", err
+		}
+		if !p.IsDryRun() {
+			time.Sleep(time.Second * 5)
 		}
-		time.Sleep(time.Second * 5)
 
 		assetId := uploadRegisResp.Value.Asset
 
@@ -110,22 +109,19 @@ func HandleLinkedinProfilePostTask(app *pocketbase.PocketBase, p PostToSocialPay
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
-		FailedPost(app, "linkedin", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("X-Restli-Protocol-Version", "2.0.0")
 
-	// Create an HTTP client
-	client := &http.Client{}
+	client := p.client()
 
 	// Send the request
 	resp, err := client.Do(req)
 	if err != nil {
-		FailedPost(app, "linkedin", socialPostId, err)
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -133,29 +129,24 @@ func HandleLinkedinProfilePostTask(app *pocketbase.PocketBase, p PostToSocialPay
 	responseBody := new(bytes.Buffer)
 	_, err = responseBody.ReadFrom(resp.Body)
 	if err != nil {
-		FailedPost(app, "linkedin", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	var lresp LinkedinResponse
 	err = json.Unmarshal([]byte(responseBody.String()), &lresp)
 	if err != nil {
-		FailedPost(app, "linkedin", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	if lresp.ID == "" {
-		FailedPost(app, "linkedin", socialPostId, errors.New(responseBody.String()))
-		return err
+		return "", errors.New(responseBody.String())
 	}
 
-	SuccessPost(app, "linkedin", socialPostId, lresp.ID)
-
 	app.Logger().Info("Linkedin post created successfully", "postId", lresp.ID)
-	return nil
+	return lresp.ID, nil
 }
 
-func linkedinUploadMedia(image, uploadUrl, accessToken string) error {
+func linkedinUploadMedia(client *http.Client, image, uploadUrl, accessToken string) error {
 
 	fileLocation, err := helpers.DownloadImage(image, true)
 	if err != nil {
@@ -169,9 +160,6 @@ func linkedinUploadMedia(image, uploadUrl, accessToken string) error {
 	}
 	defer file.Close()
 
-	// Create a new HTTP client
-	client := &http.Client{}
-
 	// Create a new HTTP request with the file as the request body
 	req, err := http.NewRequest("POST", uploadUrl, file)
 	if err != nil {
@@ -209,7 +197,7 @@ type UploadRegisterResponse struct {
 	} `json:"value"`
 }
 
-func LinkedinRegisterUpload(connectionId string, accessToken string) (UploadRegisterResponse, error) {
+func LinkedinRegisterUpload(client *http.Client, connectionId string, accessToken string) (UploadRegisterResponse, error) {
 	url := "https://api.linkedin.com/v2/assets?action=registerUpload"
 
 	body := `{
@@ -237,9 +225,6 @@ func LinkedinRegisterUpload(connectionId string, accessToken string) (UploadRegi
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	// req.Header.Set("X-Restli-Protocol-Version", "2.0.0")
 
-	// Create an HTTP client
-	client := &http.Client{}
-
 	// Send the request
 	resp, err := client.Do(req)
 	if err != nil {
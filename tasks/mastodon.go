@@ -14,7 +14,7 @@ import (
 	"github.com/pocketbase/pocketbase"
 )
 
-func HandlePostToMastodon(app *pocketbase.PocketBase, p PostToSocialPayload) error {
+func HandlePostToMastodon(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 
 	content := p.Content
 	images := p.Images
@@ -27,31 +27,30 @@ func HandlePostToMastodon(app *pocketbase.PocketBase, p PostToSocialPayload) err
 
 	for _, image := range images {
 		imageUrl := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, image)
-		mediaID, err := UploadMedia(accessToken, imageUrl)
+		mediaID, err := UploadMedia(p.client(), accessToken, imageUrl)
 		if err != nil {
-			FailedPost(app, "mastodon", socialPostId, err)
-			return err
+			return "", err
 		}
 		mediaIDs = append(mediaIDs, mediaID)
 	}
 
-	body, err := PostStatus(accessToken, content, mediaIDs)
+	body, err := PostStatus(p.client(), accessToken, content, mediaIDs, mastodonStatusId(p.ReplyTo), p.IdempotencyKey)
 	if err != nil {
-		FailedPost(app, "mastodon", socialPostId, err)
-		return err
+		return "", err
 	}
 
-	SuccessPost(app, "mastodon", socialPostId, body)
-
-	return nil
+	return body, nil
 }
 
-func PostStatus(accessToken string, content string, mediaIDs []string) (string, error) {
+func PostStatus(client *http.Client, accessToken string, content string, mediaIDs []string, inReplyToId string, idempotencyKey string) (string, error) {
 	data := map[string]interface{}{
 		"status":     content,
 		"media_ids":  mediaIDs,
 		"visibility": "public", // Optional: public, unlisted, private, direct
 	}
+	if inReplyToId != "" {
+		data["in_reply_to_id"] = inReplyToId
+	}
 
 	body, err := json.Marshal(data)
 	if err != nil {
@@ -64,8 +63,12 @@ func PostStatus(accessToken string, content string, mediaIDs []string) (string,
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		// mastodon returns the original status for a repeated key
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -79,7 +82,7 @@ func PostStatus(accessToken string, content string, mediaIDs []string) (string,
 	return bodyString, nil
 }
 
-func UploadMedia(accessToken string, imageUrl string) (string, error) {
+func UploadMedia(client *http.Client, accessToken string, imageUrl string) (string, error) {
 	imagePath, err := helpers.DownloadImage(imageUrl, true)
 
 	if err != nil {
@@ -118,7 +121,7 @@ func UploadMedia(accessToken string, imageUrl string) (string, error) {
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
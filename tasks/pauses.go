@@ -0,0 +1,99 @@
+package tasks
+
+import (
+	"content-clock/helpers"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const publishPausesCollection = "publish_pauses"
+
+const (
+	PauseKindPause    = "pause"
+	PauseKindBlackout = "blackout"
+
+	// ResumePublish publishes held posts as soon as a pause is lifted;
+	// ResumeShift moves them later by the length of the pause.
+	ResumePublish = "publish"
+	ResumeShift   = "shift"
+)
+
+// ActivePause returns the pause or blackout window that stops the user's
+// connection from publishing at the given time, or nil. A pause wins over a
+// blackout. resumeAt is when publishing may continue: the end of the
+// blackout window, or ends_at of a pause (zero when it lasts until lifted).
+func ActivePause(app core.App, userId string, connectionId string, at time.Time) (pause *core.Record, resumeAt time.Time) {
+	if _, err := app.FindCollectionByNameOrId(publishPausesCollection); err != nil {
+		return nil, time.Time{}
+	}
+	records, err := app.FindRecordsByFilter(
+		publishPausesCollection,
+		"lifted_at = '' && (connection = {:connection} || (connection = '' && (user = {:user} || user = '')))",
+		"starts_at",
+		0,
+		0,
+		dbx.Params{"connection": connectionId, "user": userId},
+	)
+	if err != nil {
+		app.Logger().Error("Failed to load publish pauses", "connection", connectionId, "error", err.Error())
+		return nil, time.Time{}
+	}
+
+	var blackout *core.Record
+	var blackoutEnd time.Time
+	for _, record := range records {
+		if record.GetString("kind") == PauseKindBlackout {
+			if end, ok := BlackoutWindowEnd(app, record, at); ok && end.After(blackoutEnd) {
+				blackout, blackoutEnd = record, end
+			}
+			continue
+		}
+		startsAt := record.GetDateTime("starts_at")
+		endsAt := record.GetDateTime("ends_at")
+		if !startsAt.IsZero() && startsAt.Time().After(at) {
+			continue
+		}
+		if !endsAt.IsZero() && !endsAt.Time().After(at) {
+			continue
+		}
+		return record, endsAt.Time()
+	}
+	return blackout, blackoutEnd
+}
+
+// BlackoutWindowEnd reports whether `at` falls inside one of the blackout's
+// windows and, if so, when that window ends. Windows start at each
+// occurrence of the recurrence rule (anchored at starts_at, in the
+// blackout's timezone) and last duration_minutes.
+func BlackoutWindowEnd(app core.App, blackout *core.Record, at time.Time) (time.Time, bool) {
+	rule, err := helpers.ParseRRule(blackout.GetString("recurrence"))
+	duration := time.Duration(blackout.GetInt("duration_minutes")) * time.Minute
+	if err != nil || duration <= 0 || blackout.GetDateTime("starts_at").IsZero() {
+		return time.Time{}, false
+	}
+
+	dtstart := blackout.GetDateTime("starts_at").Time().In(helpers.LoadLocation(PauseTimezone(app, blackout)))
+	// the latest window that can still cover `at` starts after at-duration
+	start, ok := rule.Next(dtstart, at.Add(-duration))
+	if !ok || start.After(at) {
+		return time.Time{}, false
+	}
+	return start.Add(duration), true
+}
+
+// PauseTimezone returns the timezone blackout windows are evaluated in: the
+// pause's own timezone, else its connection's, else UTC.
+func PauseTimezone(app core.App, pause *core.Record) string {
+	if timezone := strings.TrimSpace(pause.GetString("timezone")); timezone != "" {
+		return timezone
+	}
+	if connection, err := app.FindRecordById("connections", pause.GetString("connection")); err == nil {
+		if timezone := strings.TrimSpace(connection.GetString("timezone")); timezone != "" && helpers.ValidTimezone(timezone) {
+			return timezone
+		}
+	}
+	return "UTC"
+}
@@ -0,0 +1,202 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestActivePause(t *testing.T) {
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	// a daily blackout from 11:00 to 13:00 UTC
+	blackout := map[string]any{"kind": PauseKindBlackout, "starts_at": at.Add(-30*24*time.Hour - time.Hour), "recurrence": "FREQ=DAILY", "duration_minutes": 120, "timezone": "UTC"}
+
+	tests := []struct {
+		name         string
+		pauses       []map[string]any
+		wantPause    int // index into pauses, -1 for none
+		wantResumeAt time.Time
+	}{
+		{name: "no pauses", wantPause: -1},
+		{
+			name:         "pause of the connection",
+			pauses:       []map[string]any{{"kind": PauseKindPause, "user": "user1", "connection": "conn1", "starts_at": at.Add(-time.Hour), "ends_at": at.Add(time.Hour)}},
+			wantResumeAt: at.Add(time.Hour),
+		},
+		{
+			name:   "open-ended pause",
+			pauses: []map[string]any{{"kind": PauseKindPause, "user": "user1", "connection": "conn1"}},
+		},
+		{
+			name:      "lifted pause",
+			pauses:    []map[string]any{{"kind": PauseKindPause, "user": "user1", "connection": "conn1", "lifted_at": at.Add(-time.Minute)}},
+			wantPause: -1,
+		},
+		{
+			name:      "pause of another connection",
+			pauses:    []map[string]any{{"kind": PauseKindPause, "user": "user1", "connection": "conn2"}},
+			wantPause: -1,
+		},
+		{
+			name:   "pause of all the user's connections",
+			pauses: []map[string]any{{"kind": PauseKindPause, "user": "user1"}},
+		},
+		{
+			name:      "pause of another user",
+			pauses:    []map[string]any{{"kind": PauseKindPause, "user": "user2"}},
+			wantPause: -1,
+		},
+		{
+			name:   "global pause",
+			pauses: []map[string]any{{"kind": PauseKindPause}},
+		},
+		{
+			name:      "pause that has not started",
+			pauses:    []map[string]any{{"kind": PauseKindPause, "user": "user1", "starts_at": at.Add(time.Minute)}},
+			wantPause: -1,
+		},
+		{
+			name:      "pause that has ended",
+			pauses:    []map[string]any{{"kind": PauseKindPause, "user": "user1", "starts_at": at.Add(-2 * time.Hour), "ends_at": at}},
+			wantPause: -1,
+		},
+		{
+			name:         "inside a blackout window",
+			pauses:       []map[string]any{withFields(blackout, map[string]any{"user": "user1"})},
+			wantResumeAt: at.Add(time.Hour),
+		},
+		{
+			name:      "outside a blackout window",
+			pauses:    []map[string]any{withFields(blackout, map[string]any{"user": "user1", "duration_minutes": 30})},
+			wantPause: -1,
+		},
+		{
+			name: "a pause wins over a blackout",
+			pauses: []map[string]any{
+				withFields(blackout, map[string]any{"user": "user1"}),
+				{"kind": PauseKindPause, "user": "user1", "connection": "conn1", "starts_at": at.Add(-time.Hour)},
+			},
+			wantPause: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			var saved []*core.Record
+			for _, fields := range tt.pauses {
+				saved = append(saved, saveTestRecord(t, app, publishPausesCollection, fields))
+			}
+
+			pause, resumeAt := ActivePause(app, "user1", "conn1", at)
+			if tt.wantPause < 0 {
+				if pause != nil {
+					t.Fatalf("ActivePause = %v, want none", pause)
+				}
+				return
+			}
+			if pause == nil || pause.Id != saved[tt.wantPause].Id {
+				t.Fatalf("ActivePause = %v, want pause %d", pause, tt.wantPause)
+			}
+			if !resumeAt.Equal(tt.wantResumeAt) {
+				t.Fatalf("resumeAt = %v, want %v", resumeAt, tt.wantResumeAt)
+			}
+		})
+	}
+}
+
+func withFields(base map[string]any, fields map[string]any) map[string]any {
+	merged := map[string]any{}
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
+func TestBlackoutWindowEnd(t *testing.T) {
+	app := newTestApp(t)
+	collection, err := app.FindCollectionByNameOrId(publishPausesCollection)
+	if err != nil {
+		t.Fatalf("FindCollectionByNameOrId: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	// overnight from 22:00 to 06:00 New York time, anchored in winter
+	overnight := map[string]any{"starts_at": time.Date(2026, 1, 5, 22, 0, 0, 0, newYork), "recurrence": "FREQ=DAILY", "duration_minutes": 480, "timezone": "America/New_York"}
+	weekend := map[string]any{"starts_at": time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), "recurrence": "FREQ=WEEKLY;BYDAY=SA,SU", "duration_minutes": 1440, "timezone": "UTC"}
+
+	tests := []struct {
+		name    string
+		fields  map[string]any
+		at      time.Time
+		want    time.Time
+		wantHit bool
+	}{
+		{name: "late evening in summer time", fields: overnight, at: time.Date(2026, 10, 18, 23, 0, 0, 0, newYork), want: time.Date(2026, 10, 19, 6, 0, 0, 0, newYork), wantHit: true},
+		{name: "after midnight the window of the previous day", fields: overnight, at: time.Date(2026, 10, 19, 5, 59, 0, 0, newYork), want: time.Date(2026, 10, 19, 6, 0, 0, 0, newYork), wantHit: true},
+		{name: "window end is outside", fields: overnight, at: time.Date(2026, 10, 19, 6, 0, 0, 0, newYork)},
+		{name: "daytime", fields: overnight, at: time.Date(2026, 10, 19, 21, 0, 0, 0, newYork)},
+		{name: "before the first window", fields: overnight, at: time.Date(2026, 1, 5, 23, 0, 0, 0, time.UTC)},
+		{name: "sunday", fields: weekend, at: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), want: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), wantHit: true},
+		{name: "monday", fields: weekend, at: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		{name: "invalid rule", fields: withFields(weekend, map[string]any{"recurrence": "FREQ=HOURLY"}), at: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)},
+		{name: "no duration", fields: withFields(weekend, map[string]any{"duration_minutes": 0}), at: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blackout := core.NewRecord(collection)
+			blackout.Load(tt.fields)
+			blackout.Set("kind", PauseKindBlackout)
+
+			end, hit := BlackoutWindowEnd(app, blackout, tt.at)
+			if hit != tt.wantHit || !end.Equal(tt.want) {
+				t.Fatalf("BlackoutWindowEnd(%v) = %v, %v; want %v, %v", tt.at, end, hit, tt.want, tt.wantHit)
+			}
+		})
+	}
+}
+
+func TestHoldAndResumeJob(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Now().UTC()
+	pause := saveTestRecord(t, app, publishPausesCollection, map[string]any{"kind": PauseKindPause, "user": "user1", "reason": "incident"})
+	post := saveTestRecord(t, app, "posts", map[string]any{"status": "sending", "lease_owner": InstanceId(), "lease_expires_at": now.Add(time.Minute)})
+	job := saveTestRecord(t, app, publishJobsCollection, map[string]any{"post": post.Id, "status": JobStatusQueued, "next_run_at": now})
+
+	holdJob(app, job, pause, time.Time{})
+	held := reload(t, app, post)
+	if held.GetString("status") != "paused" || held.GetString("paused_by") != pause.Id || held.GetString("lease_owner") != "" {
+		t.Fatalf("held post = status %q paused_by %q lease %q", held.GetString("status"), held.GetString("paused_by"), held.GetString("lease_owner"))
+	}
+	if nextRun := reload(t, app, job).GetDateTime("next_run_at").Time(); nextRun.Before(now.Add(pausedJobRecheck - time.Second)) {
+		t.Fatalf("held job runs at %v, want the pause rechecked after %v", nextRun, pausedJobRecheck)
+	}
+
+	resumeAt := now.Add(10 * time.Second).Truncate(time.Millisecond)
+	if !ResumeHeldJob(app, post.Id, resumeAt) {
+		t.Fatal("ResumeHeldJob found no queued job")
+	}
+	if nextRun := reload(t, app, job).GetDateTime("next_run_at").Time(); !nextRun.Equal(resumeAt) {
+		t.Fatalf("resumed job runs at %v, want %v", nextRun, resumeAt)
+	}
+	if ResumeHeldJob(app, "missing", resumeAt) {
+		t.Fatal("ResumeHeldJob resumed a post without a job")
+	}
+
+	// a blackout delays the job to the end of the window instead
+	blackout := saveTestRecord(t, app, publishPausesCollection, map[string]any{"kind": PauseKindBlackout, "user": "user1"})
+	windowEnd := now.Add(2 * time.Hour).Truncate(time.Millisecond)
+	holdJob(app, job, blackout, windowEnd)
+	delayed := reload(t, app, post)
+	if delayed.GetString("status") != "retrying" {
+		t.Fatalf("post in a blackout = status %q, want retrying", delayed.GetString("status"))
+	}
+	if nextRun := reload(t, app, job).GetDateTime("next_run_at").Time(); !nextRun.Equal(windowEnd) {
+		t.Fatalf("job in a blackout runs at %v, want %v", nextRun, windowEnd)
+	}
+}
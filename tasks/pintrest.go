@@ -12,7 +12,7 @@ import (
 	"github.com/pocketbase/pocketbase"
 )
 
-func HandlePinterestBoardPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) error {
+func HandlePinterestBoardPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 	content := p.Content
 	images := p.Images
 	connectionId := p.ConnectionId
@@ -23,6 +23,10 @@ func HandlePinterestBoardPostTask(app *pocketbase.PocketBase, p PostToSocialPayl
 	url := "https://api.pinterest.com/v5/pins"
 	method := "POST"
 
+	if len(images) == 0 {
+		return "", errors.New("pinterest requires an image")
+	}
+
 	backendHost := os.Getenv("API_HOST")
 	imageUrl := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, images[0])
 
@@ -36,44 +40,38 @@ func HandlePinterestBoardPostTask(app *pocketbase.PocketBase, p PostToSocialPayl
       }
   }`)
 
-	client := &http.Client{}
+	client := p.client()
 	req, err := http.NewRequest(method, url, payload)
 
 	if err != nil {
-		FailedPost(app, "pinterest", socialPostId, err)
-		return err
+		return "", err
 	}
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 	req.Header.Add("Content-Type", "application/json")
 
 	res, err := client.Do(req)
 	if err != nil {
-		FailedPost(app, "pinterest", socialPostId, err)
-		return err
+		return "", err
 	}
 	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		FailedPost(app, "pinterest", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	post := make(map[string]interface{})
 
 	err = json.Unmarshal(body, &post)
 	if err != nil {
-		FailedPost(app, "pinterest", socialPostId, err)
-		return err
+		return "", err
 
 	}
 
 	if post["id"] != nil {
-		SuccessPost(app, "pinterest", socialPostId, post["id"].(string))
-		return nil
+		return post["id"].(string), nil
 	} else {
-		FailedPost(app, "pinterest", socialPostId, errors.New(string(body)))
-		return err
+		return "", errors.New(string(body))
 	}
 
 }
@@ -0,0 +1,240 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// ErrUnsupported is returned by Publisher methods a platform does not offer.
+var ErrUnsupported = errors.New("operation not supported by this platform")
+
+// Capabilities describes what a platform accepts and which optional
+// operations its publisher implements.
+type Capabilities struct {
+	Text           bool     `json:"text"`
+	Title          bool     `json:"title"`
+	Link           bool     `json:"link"`
+	Images         bool     `json:"images"`
+	Video          bool     `json:"video"`
+	ImageTypes     []string `json:"image_types"`
+	MaxMedia       int      `json:"max_media"`
+	MaxTextLength  int      `json:"max_text_length"`
+	MaxTitleLength int      `json:"max_title_length"`
+	MaxImageSize   int64    `json:"max_image_size"`
+	MaxVideoSize   int64    `json:"max_video_size"`
+	RequiresMedia  bool     `json:"requires_media"`
+	RequiresTitle  bool     `json:"requires_title"`
+	Delete         bool     `json:"delete"`
+	Metrics        bool     `json:"metrics"`
+	Verify         bool     `json:"verify"`
+	FindPublished  bool     `json:"find_published"`
+	FirstComment   bool     `json:"first_comment"`
+	Threads        bool     `json:"threads"`
+}
+
+// Publisher is implemented once per network. The scheduler, queue, recovery
+// sweeper and analytics worker only talk to publishers through the registry.
+// Access tokens are passed as stored in connections; PlatformPublisher
+// decrypts them right before the platform call.
+type Publisher interface {
+	Name() string
+	Capabilities() Capabilities
+	// Validate reports every reason the payload cannot be published.
+	Validate(p PostToSocialPayload) error
+	// Publish sends the post and returns the platform's id for it. Errors are
+	// *PublishError so callers can act on their class.
+	Publish(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error)
+	Delete(connectionId string, accessToken string, publishedPostId string) error
+	// FetchMetrics returns the platform's raw metrics JSON for a post.
+	FetchMetrics(connectionId string, accessToken string, publishedPostId string) (string, error)
+	// Verify reports whether a published post still exists on the platform.
+	Verify(connectionId string, accessToken string, publishedPostId string) (bool, error)
+	// FindPublished looks through the account's recent objects for one
+	// created since `since` with the payload's content, so a retry after an
+	// ambiguous failure does not post twice. It returns "" when none exists.
+	FindPublished(p PostToSocialPayload, since time.Time) (string, error)
+}
+
+type platformCall func(connectionId string, accessToken string, publishedPostId string) (string, error)
+
+// PlatformPublisher builds a Publisher from plain functions. Nil operations
+// report ErrUnsupported and Validate falls back to the capability checks.
+type PlatformPublisher struct {
+	Platform     string
+	Caps         Capabilities
+	PublishFunc  publishHandler
+	ValidateFunc func(p PostToSocialPayload) error
+	DeleteFunc   func(connectionId string, accessToken string, publishedPostId string) error
+	MetricsFunc  platformCall
+	VerifyFunc   publishVerifier
+	FindFunc     publishFinder
+	CommentFunc  commentPoster
+}
+
+func (p *PlatformPublisher) Name() string { return p.Platform }
+
+func (p *PlatformPublisher) Capabilities() Capabilities {
+	caps := p.Caps
+	if caps.Images && len(caps.ImageTypes) == 0 {
+		caps.ImageTypes = defaultImageTypes
+	}
+	caps.Delete = p.DeleteFunc != nil
+	caps.Metrics = p.MetricsFunc != nil
+	caps.Verify = p.VerifyFunc != nil
+	caps.FindPublished = p.FindFunc != nil
+	caps.FirstComment = p.CommentFunc != nil
+	return caps
+}
+
+func (p *PlatformPublisher) Validate(payload PostToSocialPayload) error {
+	result := &ValidationError{Platform: p.Platform, Issues: CheckCapabilities(p.Capabilities(), payload)}
+	if payload.FirstComment != "" && p.CommentFunc == nil {
+		result.Issues = append(result.Issues, ValidationIssue{Field: "variants", Code: "first_comment_not_supported", Message: "first comments are not supported"})
+	}
+	if len(payload.ThreadParts) > 0 {
+		if !p.Caps.Threads {
+			result.Issues = append(result.Issues, ValidationIssue{Field: "thread_parts", Code: "threads_not_supported", Message: "threads are not supported"})
+		} else {
+			for i, part := range threadPayloads(payload)[1:] {
+				for _, issue := range CheckCapabilities(p.Capabilities(), part) {
+					issue.Field = "thread_parts"
+					issue.Message = fmt.Sprintf("part %d: %s", i+2, issue.Message)
+					result.Issues = append(result.Issues, issue)
+				}
+			}
+		}
+	}
+	if p.ValidateFunc != nil {
+		if err := p.ValidateFunc(payload); err != nil {
+			var extra *ValidationError
+			if errors.As(err, &extra) {
+				result.Issues = append(result.Issues, extra.Issues...)
+			} else {
+				result.Issues = append(result.Issues, ValidationIssue{Field: "content", Code: "invalid", Message: err.Error()})
+			}
+		}
+	}
+	if len(result.Issues) == 0 {
+		return nil
+	}
+	return result
+}
+
+func (p *PlatformPublisher) Publish(app *pocketbase.PocketBase, payload PostToSocialPayload) (string, error) {
+	if p.PublishFunc == nil {
+		return "", ClassifyError(p.Platform, ErrUnsupported)
+	}
+	accessToken, err := publisherToken(p.Platform, payload.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	payload.AccessToken = accessToken
+	var publishedPostId string
+	if len(payload.ThreadParts) > 0 {
+		publishedPostId, err = p.publishThread(app, payload)
+	} else {
+		publishedPostId, err = p.PublishFunc(app, payload)
+	}
+	if err != nil {
+		status, body := lastFailure(payload.HTTPClient)
+		return publishedPostId, classifyFailure(p.Platform, err, status, body)
+	}
+	// the post is live at this point, so a failed comment must not fail
+	// the publish and cause a duplicate on retry
+	if payload.FirstComment != "" && p.CommentFunc != nil {
+		if err := p.CommentFunc(payload, publishedPostId, payload.FirstComment); err != nil {
+			app.Logger().Warn("Failed to add first comment", "platform", p.Platform, "postId", payload.SocialPostId, "publishedPostId", publishedPostId, "error", err.Error())
+		}
+	}
+	return publishedPostId, nil
+}
+
+func (p *PlatformPublisher) Delete(connectionId string, accessToken string, publishedPostId string) error {
+	if p.DeleteFunc == nil {
+		return ErrUnsupported
+	}
+	accessToken, err := publisherToken(p.Platform, accessToken)
+	if err != nil {
+		return err
+	}
+	return p.DeleteFunc(connectionId, accessToken, publishedPostId)
+}
+
+func (p *PlatformPublisher) FetchMetrics(connectionId string, accessToken string, publishedPostId string) (string, error) {
+	if p.MetricsFunc == nil {
+		return "", ErrUnsupported
+	}
+	accessToken, err := publisherToken(p.Platform, accessToken)
+	if err != nil {
+		return "", err
+	}
+	return p.MetricsFunc(connectionId, accessToken, publishedPostId)
+}
+
+func (p *PlatformPublisher) Verify(connectionId string, accessToken string, publishedPostId string) (bool, error) {
+	if p.VerifyFunc == nil {
+		return false, ErrUnsupported
+	}
+	accessToken, err := publisherToken(p.Platform, accessToken)
+	if err != nil {
+		return false, err
+	}
+	return p.VerifyFunc(connectionId, accessToken, publishedPostId)
+}
+
+func (p *PlatformPublisher) FindPublished(payload PostToSocialPayload, since time.Time) (string, error) {
+	// a thread resumes from its thread_progress instead
+	if p.FindFunc == nil || len(payload.ThreadParts) > 0 {
+		return "", ErrUnsupported
+	}
+	accessToken, err := publisherToken(p.Platform, payload.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	payload.AccessToken = accessToken
+	return p.FindFunc(payload, since)
+}
+
+var (
+	publishersMu sync.RWMutex
+	publishers   = map[string]Publisher{}
+)
+
+// RegisterPublisher adds a network under its Name(). New platforms call this
+// from an init function in their own file.
+func RegisterPublisher(publisher Publisher) {
+	publishersMu.Lock()
+	defer publishersMu.Unlock()
+	if _, exists := publishers[publisher.Name()]; exists {
+		panic("tasks: publisher registered twice: " + publisher.Name())
+	}
+	publishers[publisher.Name()] = publisher
+}
+
+// GetPublisher looks up the publisher for a connection_name.
+func GetPublisher(platform string) (Publisher, error) {
+	publishersMu.RLock()
+	defer publishersMu.RUnlock()
+	publisher, ok := publishers[platform]
+	if !ok {
+		return nil, fmt.Errorf("unsupported connection type: %s", platform)
+	}
+	return publisher, nil
+}
+
+// Publishers lists every registered publisher sorted by name.
+func Publishers() []Publisher {
+	publishersMu.RLock()
+	defer publishersMu.RUnlock()
+	list := make([]Publisher, 0, len(publishers))
+	for _, publisher := range publishers {
+		list = append(list, publisher)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
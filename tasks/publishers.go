@@ -0,0 +1,157 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/michimani/gotwi/tweet/managetweet"
+	"github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+const mb = 1 << 20
+
+func init() {
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "facebook",
+		Caps:        Capabilities{Text: true, Link: true, Images: true, Video: true, MaxMedia: 10, MaxTextLength: 63206, MaxImageSize: 10 * mb, MaxVideoSize: 1024 * mb},
+		PublishFunc: HandleFacebookPagePostTask,
+		DeleteFunc: func(connectionId, accessToken, publishedPostId string) error {
+			return deleteObject(fmt.Sprintf("https://graph.facebook.com/%s?access_token=%s", publishedPostId, accessToken), nil)
+		},
+		MetricsFunc: func(connectionId, accessToken, publishedPostId string) (string, error) {
+			return fetchRaw(fmt.Sprintf("https://graph.facebook.com/%s/insights?metric=post_impressions,post_reactions_like_total,post_reactions_love_total,post_reactions_wow_total&access_token=%s", publishedPostId, accessToken), nil)
+		},
+		VerifyFunc: func(connectionId, accessToken, publishedPostId string) (bool, error) {
+			return objectExists(fmt.Sprintf("https://graph.facebook.com/%s?fields=id&access_token=%s", publishedPostId, accessToken), nil)
+		},
+		FindFunc:    findFacebookPost,
+		CommentFunc: graphComment("https://graph.facebook.com"),
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "instagram",
+		Caps:        Capabilities{Text: true, Images: true, Video: true, ImageTypes: []string{"jpg", "jpeg"}, MaxMedia: 10, MaxTextLength: 2200, MaxImageSize: 8 * mb, MaxVideoSize: 300 * mb, RequiresMedia: true},
+		PublishFunc: HandleInstagramPostTask,
+		MetricsFunc: func(connectionId, accessToken, publishedPostId string) (string, error) {
+			return fetchRaw(fmt.Sprintf("https://graph.facebook.com/v19.0/%s/insights?metric=impressions,reach,engagement,saved&access_token=%s", publishedPostId, accessToken), nil)
+		},
+		VerifyFunc: func(connectionId, accessToken, publishedPostId string) (bool, error) {
+			return objectExists(fmt.Sprintf("https://graph.facebook.com/v19.0/%s?fields=id&access_token=%s", publishedPostId, accessToken), nil)
+		},
+		FindFunc:    findInstagramMedia,
+		CommentFunc: graphComment("https://graph.facebook.com/v19.0"),
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "twitter",
+		Caps:        Capabilities{Text: true, Images: true, MaxMedia: 4, MaxTextLength: 280, MaxImageSize: 5 * mb, Threads: true},
+		PublishFunc: HandleTwitterPostTask,
+		DeleteFunc:  deleteTweet,
+		FindFunc:    findTweet,
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "linkedin",
+		Caps:        Capabilities{Text: true, Images: true, ImageTypes: []string{"jpg", "jpeg", "png", "gif"}, MaxMedia: 9, MaxTextLength: 3000, MaxImageSize: 10 * mb},
+		PublishFunc: HandleLinkedinProfilePostTask,
+		DeleteFunc: func(connectionId, accessToken, publishedPostId string) error {
+			return deleteObject("https://api.linkedin.com/v2/ugcPosts/"+url.PathEscape(publishedPostId), map[string]string{
+				"Authorization":             "Bearer " + accessToken,
+				"X-Restli-Protocol-Version": "2.0.0",
+			})
+		},
+		MetricsFunc: func(connectionId, accessToken, publishedPostId string) (string, error) {
+			return fetchRaw("https://api.linkedin.com/v2/socialActions/"+publishedPostId, map[string]string{"Authorization": "Bearer " + accessToken})
+		},
+		VerifyFunc: func(connectionId, accessToken, publishedPostId string) (bool, error) {
+			return objectExists("https://api.linkedin.com/v2/ugcPosts/"+url.PathEscape(publishedPostId), map[string]string{
+				"Authorization":             "Bearer " + accessToken,
+				"X-Restli-Protocol-Version": "2.0.0",
+			})
+		},
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "pinterest",
+		Caps:        Capabilities{Text: true, Title: true, Images: true, MaxMedia: 1, MaxTextLength: 500, MaxTitleLength: 100, MaxImageSize: 20 * mb, RequiresMedia: true},
+		PublishFunc: HandlePinterestBoardPostTask,
+		DeleteFunc: func(connectionId, accessToken, publishedPostId string) error {
+			return deleteObject("https://api.pinterest.com/v5/pins/"+publishedPostId, map[string]string{"Authorization": "Bearer " + accessToken})
+		},
+		MetricsFunc: func(connectionId, accessToken, publishedPostId string) (string, error) {
+			return fetchRaw(fmt.Sprintf("https://api.pinterest.com/v5/pins/%s/analytics", publishedPostId), map[string]string{"Authorization": "Bearer " + accessToken})
+		},
+		VerifyFunc: func(connectionId, accessToken, publishedPostId string) (bool, error) {
+			return objectExists("https://api.pinterest.com/v5/pins/"+publishedPostId, map[string]string{"Authorization": "Bearer " + accessToken})
+		},
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "discord",
+		Caps:        Capabilities{Text: true, Images: true, MaxMedia: 1, MaxTextLength: 2000, MaxImageSize: 10 * mb},
+		PublishFunc: HandleDiscordPostTask,
+		DeleteFunc: func(connectionId, accessToken, publishedPostId string) error {
+			return deleteObject(fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages/%s", connectionId, publishedPostId), map[string]string{"Authorization": "Bot " + accessToken})
+		},
+		VerifyFunc: func(connectionId, accessToken, publishedPostId string) (bool, error) {
+			return objectExists(fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages/%s", connectionId, publishedPostId), map[string]string{"Authorization": "Bot " + accessToken})
+		},
+		FindFunc: findDiscordMessage,
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "mastodon",
+		Caps:        Capabilities{Text: true, Images: true, MaxMedia: 4, MaxTextLength: 500, MaxImageSize: 16 * mb, Threads: true},
+		PublishFunc: HandlePostToMastodon,
+		DeleteFunc: func(connectionId, accessToken, publishedPostId string) error {
+			return deleteObject(os.Getenv("MASTODON_BASE_URL")+"/api/v1/statuses/"+mastodonStatusId(publishedPostId), map[string]string{"Authorization": "Bearer " + accessToken})
+		},
+		MetricsFunc: func(connectionId, accessToken, publishedPostId string) (string, error) {
+			return fetchRaw(os.Getenv("MASTODON_BASE_URL")+"/api/v1/statuses/"+mastodonStatusId(publishedPostId), map[string]string{"Authorization": "Bearer " + accessToken})
+		},
+		VerifyFunc: func(connectionId, accessToken, publishedPostId string) (bool, error) {
+			return objectExists(os.Getenv("MASTODON_BASE_URL")+"/api/v1/statuses/"+mastodonStatusId(publishedPostId), map[string]string{"Authorization": "Bearer " + accessToken})
+		},
+		FindFunc: findMastodonStatus,
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "threads",
+		Caps:        Capabilities{Text: true, Images: true, ImageTypes: []string{"jpg", "jpeg", "png"}, MaxMedia: 20, MaxTextLength: 500, MaxImageSize: 8 * mb, Threads: true},
+		PublishFunc: HandlePostToThreads,
+		VerifyFunc: func(connectionId, accessToken, publishedPostId string) (bool, error) {
+			return objectExists(fmt.Sprintf("%s/%s?fields=id&access_token=%s", threadsUrl, publishedPostId, accessToken), nil)
+		},
+		FindFunc: findThreadsPost,
+	})
+
+	RegisterPublisher(&PlatformPublisher{
+		Platform:    "reddit",
+		Caps:        Capabilities{Text: true, Title: true, MaxTextLength: 40000, MaxTitleLength: 300, RequiresTitle: true},
+		PublishFunc: HandlePostToReddit,
+	})
+}
+
+// mastodonStatusId extracts the status id; the mastodon task stores the whole
+// status JSON as published_post_id.
+func mastodonStatusId(publishedPostId string) string {
+	var status struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(publishedPostId), &status); err != nil || status.ID == "" {
+		return publishedPostId
+	}
+	return status.ID
+}
+
+func deleteTweet(connectionId, accessToken, publishedPostId string) error {
+	client, err := newTwitterClient(nil, accessToken)
+	if err != nil {
+		return err
+	}
+	_, err = managetweet.Delete(context.Background(), client, &types.DeleteInput{ID: publishedPostId})
+	return err
+}
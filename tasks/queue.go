@@ -0,0 +1,461 @@
+package tasks
+
+import (
+	"content-clock/helpers"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+
+	publishJobsCollection = "publish_jobs"
+	queueBatchSize        = 100
+	defaultMaxAttempts    = 5
+	defaultBackoffSeconds = 30
+	maxBackoff            = time.Hour
+	// a job whose token is being refreshed by another instance waits this
+	// long for the new token
+	refreshInProgressRecheck = 15 * time.Second
+	// a job held by a pause is checked again this often
+	pausedJobRecheck = time.Minute
+)
+
+type publishHandler func(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error)
+
+// StartQueue persists the payload as a publish job so it survives restarts and
+// can be retried with backoff. When the publish_jobs collection is missing the
+// post is published inline with a single attempt, as before.
+func StartQueue(app *pocketbase.PocketBase, platform string, data PostToSocialPayload) error {
+	publisher, err := GetPublisher(platform)
+	if err != nil {
+		return err
+	}
+	if err := publisher.Validate(data); err != nil {
+		return err
+	}
+	data.IdempotencyKey = IdempotencyKey(data)
+
+	collection, err := app.FindCollectionByNameOrId(publishJobsCollection)
+	if err != nil {
+		app.Logger().Warn("publish_jobs collection missing; publishing without retries", "postId", data.SocialPostId)
+		return publishNow(app, publisher, data)
+	}
+
+	postRecord, err := app.FindRecordById("posts", data.SocialPostId)
+	if err != nil {
+		return fmt.Errorf("queue: failed to load post: %w", err)
+	}
+
+	if existing := findActiveJob(app, data.SocialPostId); existing != nil {
+		app.Logger().Info("Publish job already queued", "postId", data.SocialPostId, "jobId", existing.Id)
+		return nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("queue: failed to encode payload: %w", err)
+	}
+
+	job := core.NewRecord(collection)
+	job.Set("post", data.SocialPostId)
+	job.Set("connection", postRecord.GetString("connection"))
+	job.Set("user", postRecord.GetString("user"))
+	job.Set("platform", platform)
+	job.Set("payload", string(payload))
+	job.Set("status", JobStatusQueued)
+	job.Set("attempts", 0)
+	job.Set("max_attempts", helpers.GetEnvInt("PUBLISH_MAX_ATTEMPTS", defaultMaxAttempts))
+	job.Set("backoff_seconds", helpers.GetEnvInt("PUBLISH_BACKOFF_SECONDS", defaultBackoffSeconds))
+	job.Set("next_run_at", types.NowDateTime())
+	if err := app.Save(job); err != nil {
+		return fmt.Errorf("queue: failed to save publish job: %w", err)
+	}
+
+	app.Logger().Info("Publish job queued", "postId", data.SocialPostId, "jobId", job.Id, "platform", platform)
+	return nil
+}
+
+// ProcessQueue hands every due job to the worker pool and returns without
+// waiting for them to finish. Jobs whose platform is at its concurrency limit
+// stay queued and are picked up as soon as a worker frees up.
+func ProcessQueue(app *pocketbase.PocketBase) {
+	if _, err := app.FindCollectionByNameOrId(publishJobsCollection); err != nil {
+		return
+	}
+
+	workers := publishPool()
+	if !workers.dispatching.CompareAndSwap(false, true) {
+		// another dispatch is in progress; ask it to look again once done
+		workers.pending.Store(true)
+		return
+	}
+
+	for {
+		workers.pending.Store(false)
+		dispatchDueJobs(app, workers)
+		workers.dispatching.Store(false)
+
+		if !workers.pending.Load() || !workers.dispatching.CompareAndSwap(false, true) {
+			return
+		}
+	}
+}
+
+func dispatchDueJobs(app *pocketbase.PocketBase, workers *workerPool) {
+	jobs, err := app.FindRecordsByFilter(
+		publishJobsCollection,
+		"status = {:status} && next_run_at <= @now",
+		"next_run_at",
+		queueBatchSize,
+		0,
+		dbx.Params{"status": JobStatusQueued},
+	)
+	if err != nil {
+		app.Logger().Error("Failed to fetch due publish jobs", "error", err.Error())
+		return
+	}
+
+	for _, job := range jobs {
+		platform := job.GetString("platform")
+		// queued jobs wait until the pause is lifted or the window ends. They
+		// are moved out of the due batch meanwhile, so a pause holding a full
+		// batch does not stall every other job.
+		if pause, resumeAt := ActivePause(app, job.GetString("user"), job.GetString("connection"), time.Now()); pause != nil {
+			holdJob(app, job, pause, resumeAt)
+			continue
+		}
+		if until, limited := RateLimitedUntil(platform, job.GetString("connection")); limited {
+			delayJob(app, job, until, "rate limited by "+platform+"; waiting until "+until.UTC().Format(time.RFC3339))
+			continue
+		}
+		if !workers.tryAcquire(platform) {
+			continue
+		}
+
+		claimed, err := claimJob(app, job)
+		if err != nil || !claimed {
+			if err != nil {
+				app.Logger().Error("Failed to claim publish job", "jobId", job.Id, "error", err.Error())
+			}
+			workers.release(platform)
+			continue
+		}
+
+		workers.inFlight.Store(job.Id, true)
+		go func(job *core.Record) {
+			defer func() {
+				workers.inFlight.Delete(job.Id)
+				if r := recover(); r != nil {
+					failJob(app, job, fmt.Errorf("publisher panic: %v", r))
+				}
+				workers.release(platform)
+				// a slot is free again, so pick up anything that was waiting for it
+				ProcessQueue(app)
+			}()
+			runJob(app, job)
+		}(job)
+	}
+}
+
+func runJob(app *pocketbase.PocketBase, job *core.Record) {
+	postId := job.GetString("post")
+	platform := job.GetString("platform")
+
+	var payload PostToSocialPayload
+	if err := job.UnmarshalJSONField("payload", &payload); err != nil {
+		failJob(app, job, fmt.Errorf("queue: failed to decode payload: %w", err))
+		return
+	}
+
+	connection, err := app.FindRecordById("connections", job.GetString("connection"))
+	if err != nil {
+		failJob(app, job, fmt.Errorf("queue: connection not found: %w", err))
+		return
+	}
+	payload.AccessToken = connection.GetString("access_token")
+	payload.HTTPClient = PlatformClient(platform, connection.Id)
+
+	leasePost(app, postId)
+
+	publisher, err := GetPublisher(platform)
+	if err != nil {
+		failJob(app, job, err)
+		return
+	}
+
+	if payload.IdempotencyKey == "" {
+		// jobs queued before idempotency keys existed
+		payload.IdempotencyKey = IdempotencyKey(payload)
+	}
+	if since, ambiguous := ambiguousAttemptSince(app, payload.IdempotencyKey); ambiguous {
+		if publishedPostId := findPublished(app, publisher, payload, since); publishedPostId != "" {
+			attempt := beginAttempt(app, postId, job, platform, payload.IdempotencyKey)
+			completeJob(app, job, attempt, AttemptRecovered, platform, postId, publishedPostId)
+			return
+		}
+	}
+
+	attempt := beginAttempt(app, postId, job, platform, payload.IdempotencyKey)
+	publishedPostId, err := publisher.Publish(app, payload)
+	if err != nil {
+		if saveErr := finishAttempt(app, attempt, AttemptFailed, "", err); saveErr != nil {
+			app.Logger().Error("Failed to save publish attempt", "postId", postId, "error", saveErr.Error())
+		}
+		publishErr := ClassifyError(platform, err)
+		if until, limited := RateLimitedUntil(platform, connection.Id); limited && publishErr.Class.Retryable() {
+			deferRateLimitedJob(app, job, until, publishErr)
+			return
+		}
+		if publishErr.Class == ErrorAuth {
+			// an expired token is refreshed and the publish tried again at once
+			refreshErr := RefreshConnectionToken(app, connection.Id, true)
+			if refreshErr == nil {
+				requeueWithoutAttempt(app, job, time.Now(), fmt.Sprintf("token refreshed after %s, retrying", publishErr.Error()), publishErr)
+				app.Logger().Info("Publish job retried with refreshed token", "postId", postId, "jobId", job.Id, "platform", platform)
+				return
+			}
+			if errors.Is(refreshErr, ErrTokenRefreshInProgress) {
+				// another instance is storing a new token; pick it up shortly
+				requeueWithoutAttempt(app, job, time.Now().Add(refreshInProgressRecheck), fmt.Sprintf("token refresh in progress after %s, retrying", publishErr.Error()), publishErr)
+				return
+			}
+		}
+		if !publishErr.Class.Retryable() {
+			// auth, permission, content and media errors fail the same way on every attempt
+			failJob(app, job, publishErr)
+			return
+		}
+		retryOrFailJob(app, job, publishErr)
+		return
+	}
+
+	completeJob(app, job, attempt, AttemptSucceeded, platform, postId, publishedPostId)
+}
+
+// completeJob stores published_post_id on the attempt, the job and the post in
+// one transaction, so a retry after a crash at any later point finds the id
+// instead of publishing again.
+func completeJob(app *pocketbase.PocketBase, job *core.Record, attempt *core.Record, attemptStatus string, platform string, postId string, publishedPostId string) {
+	err := app.RunInTransaction(func(txApp core.App) error {
+		if err := finishAttempt(txApp, attempt, attemptStatus, publishedPostId, nil); err != nil {
+			return err
+		}
+		job.Set("status", JobStatusCompleted)
+		job.Set("last_error", "")
+		job.Set("completed_at", types.NowDateTime())
+		if err := txApp.Save(job); err != nil {
+			return err
+		}
+		post, err := txApp.FindRecordById("posts", postId)
+		if err != nil {
+			return err
+		}
+		post.Set("published_post_id", publishedPostId)
+		return txApp.Save(post)
+	})
+	if err != nil {
+		app.Logger().Error("Failed to record published post id", "postId", postId, "jobId", job.Id, "publishedPostId", publishedPostId, "error", err.Error())
+	}
+	SuccessPost(app, platform, postId, publishedPostId)
+}
+
+func retryOrFailJob(app *pocketbase.PocketBase, job *core.Record, err error) {
+	attempts := job.GetInt("attempts")
+	if attempts >= job.GetInt("max_attempts") {
+		failJob(app, job, err)
+		return
+	}
+
+	delay := backoffDelay(job.GetInt("backoff_seconds"), attempts)
+	nextRun := types.NowDateTime().Add(delay)
+
+	job.Set("status", JobStatusQueued)
+	job.Set("last_error", err.Error())
+	job.Set("next_run_at", nextRun)
+	if saveErr := app.Save(job); saveErr != nil {
+		app.Logger().Error("Failed to reschedule publish job", "jobId", job.Id, "error", saveErr.Error())
+		failJob(app, job, err)
+		return
+	}
+
+	postId := job.GetString("post")
+	if record, findErr := app.FindRecordById("posts", postId); findErr == nil {
+		record.Set("status", "retrying")
+		clearLease(record)
+		record.Set("logs", fmt.Sprintf("attempt %d/%d failed, retrying at %s: %s", attempts, job.GetInt("max_attempts"), nextRun.String(), err.Error()))
+		if saveErr := app.Save(record); saveErr != nil {
+			app.Logger().Error("Failed to update post status to retrying", "postId", postId, "error", saveErr.Error())
+		}
+	}
+
+	app.Logger().Warn("Publish attempt failed; retry scheduled", "postId", postId, "jobId", job.Id, "platform", job.GetString("platform"), "attempt", attempts, "nextRunAt", nextRun.String(), "error", err.Error())
+}
+
+// deferRateLimitedJob puts a job that hit a platform rate limit back in the
+// queue until the window resets. The attempt is not counted.
+func deferRateLimitedJob(app *pocketbase.PocketBase, job *core.Record, until time.Time, err error) {
+	if !requeueWithoutAttempt(app, job, until, fmt.Sprintf("rate limited by %s, retrying at %s: %s", job.GetString("platform"), until.UTC().Format(time.RFC3339), err.Error()), err) {
+		return
+	}
+	app.Logger().Warn("Publish job rate limited; deferred until reset", "postId", job.GetString("post"), "jobId", job.Id, "platform", job.GetString("platform"), "until", until.UTC().Format(time.RFC3339))
+}
+
+// requeueWithoutAttempt puts a job back in the queue at until without
+// counting the failed run as an attempt, and shows postLog on the post.
+func requeueWithoutAttempt(app *pocketbase.PocketBase, job *core.Record, until time.Time, postLog string, err error) bool {
+	job.Set("status", JobStatusQueued)
+	job.Set("attempts", max(job.GetInt("attempts")-1, 0))
+	job.Set("last_error", err.Error())
+	job.Set("next_run_at", until.UTC())
+	if saveErr := app.Save(job); saveErr != nil {
+		app.Logger().Error("Failed to requeue publish job", "jobId", job.Id, "error", saveErr.Error())
+		failJob(app, job, err)
+		return false
+	}
+
+	releaseJobPost(app, job, postLog)
+	return true
+}
+
+// delayJob moves a queued job's next run to when it may run again: its
+// platform budget resets or its pause is checked again. A first run's post is
+// still in "sending" under the scheduler's lease, so it is released too.
+func delayJob(app *pocketbase.PocketBase, job *core.Record, until time.Time, postLog string) {
+	job.Set("next_run_at", until.UTC())
+	if err := app.Save(job); err != nil {
+		app.Logger().Error("Failed to delay publish job", "jobId", job.Id, "error", err.Error())
+		return
+	}
+	releaseJobPost(app, job, postLog)
+}
+
+// holdJob keeps a queued job back while its connection is paused. Its post
+// is held the way the scheduler holds one that comes due during a pause:
+// "paused" until the pause is lifted (which resumes the job through
+// ResumeHeldJob), or "retrying" until a blackout window ends.
+func holdJob(app *pocketbase.PocketBase, job *core.Record, pause *core.Record, resumeAt time.Time) {
+	if pause.GetString("kind") == PauseKindBlackout {
+		delayJob(app, job, resumeAt, "blackout window, delayed to "+resumeAt.UTC().Format(time.RFC3339))
+		return
+	}
+
+	recheckAt := time.Now().Add(pausedJobRecheck)
+	if resumeAt.IsZero() || resumeAt.After(recheckAt) {
+		// open-ended or long pauses can be lifted early
+		resumeAt = recheckAt
+	}
+	job.Set("next_run_at", resumeAt.UTC())
+	if err := app.Save(job); err != nil {
+		app.Logger().Error("Failed to delay publish job", "jobId", job.Id, "error", err.Error())
+		return
+	}
+
+	postId := job.GetString("post")
+	record, err := app.FindRecordById("posts", postId)
+	if err != nil || (record.GetString("status") == "paused" && record.GetString("paused_by") == pause.Id) {
+		return
+	}
+	record.Set("status", "paused")
+	record.Set("paused_by", pause.Id)
+	clearLease(record)
+	record.Set("logs", "queue: publishing is paused: "+pause.GetString("reason"))
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Failed to hold paused post", "postId", postId, "pauseId", pause.Id, "error", err.Error())
+		return
+	}
+	app.Logger().Info("Publish job held by publishing pause", "postId", postId, "jobId", job.Id, "pauseId", pause.Id)
+}
+
+// ResumeHeldJob moves the queued job of a post released from a pause to run
+// at `at`. It reports whether the post had such a job; posts without one are
+// handed back to the scheduler instead.
+func ResumeHeldJob(app core.App, postId string, at time.Time) bool {
+	if _, err := app.FindCollectionByNameOrId(publishJobsCollection); err != nil {
+		return false
+	}
+	job, err := app.FindFirstRecordByFilter(
+		publishJobsCollection,
+		"post = {:post} && status = {:queued}",
+		dbx.Params{"post": postId, "queued": JobStatusQueued},
+	)
+	if err != nil {
+		return false
+	}
+	job.Set("next_run_at", at.UTC())
+	if err := app.Save(job); err != nil {
+		app.Logger().Error("Failed to resume held publish job", "jobId", job.Id, "error", err.Error())
+		return false
+	}
+	return true
+}
+
+// releaseJobPost marks the post of a job waiting in the queue as "retrying"
+// and drops its lease, so the recovery sweep does not take it for an
+// interrupted publish and run the job early.
+func releaseJobPost(app *pocketbase.PocketBase, job *core.Record, postLog string) {
+	postId := job.GetString("post")
+	record, err := app.FindRecordById("posts", postId)
+	if err != nil {
+		return
+	}
+	if record.GetString("status") == "retrying" && record.GetString("lease_owner") == "" && record.GetString("logs") == postLog {
+		return
+	}
+	record.Set("status", "retrying")
+	clearLease(record)
+	record.Set("logs", postLog)
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Failed to update post status to retrying", "postId", postId, "error", err.Error())
+	}
+}
+
+func failJob(app *pocketbase.PocketBase, job *core.Record, err error) {
+	job.Set("status", JobStatusFailed)
+	job.Set("last_error", err.Error())
+	job.Set("completed_at", types.NowDateTime())
+	if saveErr := app.Save(job); saveErr != nil {
+		app.Logger().Error("Failed to mark publish job failed", "jobId", job.Id, "error", saveErr.Error())
+	}
+	FailedPost(app, job.GetString("platform"), job.GetString("post"), err)
+}
+
+// backoffDelay doubles the base delay for every attempt already made, capped at maxBackoff.
+func backoffDelay(baseSeconds int, attempts int) time.Duration {
+	if baseSeconds <= 0 {
+		baseSeconds = defaultBackoffSeconds
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := time.Duration(float64(baseSeconds)*math.Pow(2, float64(attempts-1))) * time.Second
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+func publishNow(app *pocketbase.PocketBase, publisher Publisher, data PostToSocialPayload) error {
+	platform := publisher.Name()
+	attempt := beginAttempt(app, data.SocialPostId, nil, platform, data.IdempotencyKey)
+	publishedPostId, err := publisher.Publish(app, data)
+	if err != nil {
+		finishAttempt(app, attempt, AttemptFailed, "", err)
+		FailedPost(app, platform, data.SocialPostId, err)
+		return err
+	}
+	finishAttempt(app, attempt, AttemptSucceeded, publishedPostId, nil)
+	SuccessPost(app, platform, data.SocialPostId, publishedPostId)
+	return nil
+}
@@ -0,0 +1,32 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		baseSeconds int
+		attempts    int
+		want        time.Duration
+	}{
+		{name: "first attempt waits the base delay", baseSeconds: 30, attempts: 1, want: 30 * time.Second},
+		{name: "doubles per attempt", baseSeconds: 30, attempts: 2, want: time.Minute},
+		{name: "fourth attempt", baseSeconds: 30, attempts: 4, want: 4 * time.Minute},
+		{name: "custom base", baseSeconds: 5, attempts: 3, want: 20 * time.Second},
+		{name: "zero attempts count as one", baseSeconds: 30, attempts: 0, want: 30 * time.Second},
+		{name: "default base when unset", baseSeconds: 0, attempts: 2, want: 2 * defaultBackoffSeconds * time.Second},
+		{name: "negative base uses the default", baseSeconds: -10, attempts: 1, want: defaultBackoffSeconds * time.Second},
+		{name: "capped at maxBackoff", baseSeconds: 30, attempts: 8, want: maxBackoff},
+		{name: "huge attempt counts do not overflow", baseSeconds: 30, attempts: 200, want: maxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoffDelay(tt.baseSeconds, tt.attempts); got != tt.want {
+				t.Fatalf("backoffDelay(%d, %d) = %v, want %v", tt.baseSeconds, tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package tasks
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// used when a platform answers 429 without saying when to come back
+	defaultRateLimitBackoff = time.Minute
+	// Graph API usage is a rolling one-hour window without a reset header
+	graphThrottleBackoff = 15 * time.Minute
+)
+
+// rate-limit header families: the prefix is followed by -limit, -remaining
+// and -reset (Reddit also sends -used). appWide budgets are shared by every
+// connection of the platform; perEndpoint budgets are tracked separately for
+// every endpoint, the others cover all of the account's calls.
+var rateLimitHeaders = []struct {
+	prefix      string
+	appWide     bool
+	perEndpoint bool
+}{
+	{prefix: "x-rate-limit", perEndpoint: true},   // twitter, per endpoint
+	{prefix: "x-ratelimit"},                       // reddit, mastodon
+	{prefix: "x-user-limit-24hour"},               // twitter daily posting limit
+	{prefix: "x-app-limit-24hour", appWide: true}, // twitter daily app limit
+}
+
+// budgets reported in other ways than a header family
+const (
+	graphAppBudget        = "x-app-usage"
+	graphAccountBudget    = "x-business-use-case-usage"
+	tooManyRequestsBudget = "429"
+)
+
+// RateLimitStatus is the last known request budget of a platform for one
+// connection, or for the whole app when Connection is empty. Budget names the
+// header family that reported it; Endpoint is set for budgets that only cover
+// one endpoint, e.g. "GET /2/users/:id/tweets".
+type RateLimitStatus struct {
+	Platform     string  `json:"platform"`
+	Connection   string  `json:"connection"`
+	Budget       string  `json:"budget"`
+	Endpoint     string  `json:"endpoint"`
+	Limit        int     `json:"limit"`
+	Remaining    int     `json:"remaining"`
+	UsedPercent  float64 `json:"used_percent"`
+	ResetAt      string  `json:"reset_at"`
+	BlockedUntil string  `json:"blocked_until"`
+	UpdatedAt    string  `json:"updated_at"`
+
+	resetAt      time.Time
+	blockedUntil time.Time
+}
+
+// blocksPublishing reports whether running out of this budget stops publish
+// jobs. Budgets of read endpoints (duplicate lookups, verification,
+// analytics) do not; budgets of write endpoints and account-wide ones do.
+func (s *RateLimitStatus) blocksPublishing() bool {
+	return s.Endpoint == "" || !strings.HasPrefix(s.Endpoint, http.MethodGet+" ")
+}
+
+// rateLimitRegistry keeps the budgets in memory, so each instance only knows
+// the limits its own requests have seen.
+type rateLimitRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*RateLimitStatus
+}
+
+var rateLimits = &rateLimitRegistry{entries: map[string]*RateLimitStatus{}}
+
+// RateLimitedUntil reports whether a budget that publishing depends on is
+// exhausted for the connection or app-wide for its platform, and until when.
+func RateLimitedUntil(platform string, connection string) (time.Time, bool) {
+	rateLimits.mu.Lock()
+	defer rateLimits.mu.Unlock()
+
+	var until time.Time
+	for _, entry := range rateLimits.entries {
+		if entry.Platform != platform || (entry.Connection != connection && entry.Connection != "") || !entry.blocksPublishing() {
+			continue
+		}
+		if entry.blockedUntil.After(until) {
+			until = entry.blockedUntil
+		}
+	}
+	return until, until.After(time.Now())
+}
+
+// RateLimits returns the known budgets sorted by platform, connection and
+// budget.
+func RateLimits() []RateLimitStatus {
+	rateLimits.mu.Lock()
+	defer rateLimits.mu.Unlock()
+
+	list := make([]RateLimitStatus, 0, len(rateLimits.entries))
+	for _, entry := range rateLimits.entries {
+		list = append(list, *entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Platform != list[j].Platform {
+			return list[i].Platform < list[j].Platform
+		}
+		if list[i].Connection != list[j].Connection {
+			return list[i].Connection < list[j].Connection
+		}
+		if list[i].Budget != list[j].Budget {
+			return list[i].Budget < list[j].Budget
+		}
+		return list[i].Endpoint < list[j].Endpoint
+	})
+	return list
+}
+
+// observe records the budgets a platform response reports. endpoint is the
+// request's method and path, see rateLimitEndpoint.
+func (r *rateLimitRegistry) observe(platform string, connection string, endpoint string, statusCode int, header http.Header, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var touched []*RateLimitStatus
+	for _, family := range rateLimitHeaders {
+		remaining := header.Get(family.prefix + "-remaining")
+		if remaining == "" {
+			continue
+		}
+		scope := connection
+		if family.appWide {
+			scope = ""
+		}
+		familyEndpoint := ""
+		if family.perEndpoint {
+			familyEndpoint = endpoint
+		}
+		entry := r.entry(platform, scope, family.prefix, familyEndpoint)
+		entry.Remaining = int(parseHeaderFloat(remaining))
+		if limit := header.Get(family.prefix + "-limit"); limit != "" {
+			entry.Limit = int(parseHeaderFloat(limit))
+		} else if used := header.Get(family.prefix + "-used"); used != "" {
+			entry.Limit = int(parseHeaderFloat(used)) + entry.Remaining
+		}
+		if entry.Limit > 0 {
+			entry.UsedPercent = 100 * float64(entry.Limit-entry.Remaining) / float64(entry.Limit)
+		}
+		if reset, ok := parseReset(header.Get(family.prefix+"-reset"), now); ok {
+			entry.resetAt = reset
+		}
+		if entry.Remaining <= 0 && entry.resetAt.After(now) {
+			entry.blockedUntil = entry.resetAt
+		}
+		touched = append(touched, entry)
+	}
+
+	// Graph API (facebook, instagram, threads): app-wide percentages in
+	// X-App-Usage, per page/account budgets in X-Business-Use-Case-Usage
+	if usage := header.Get("X-App-Usage"); usage != "" {
+		var app graphUsage
+		if json.Unmarshal([]byte(usage), &app) == nil {
+			entry := r.entry(platform, "", graphAppBudget, "")
+			entry.UsedPercent = app.max()
+			if entry.UsedPercent >= 100 {
+				entry.blockedUntil = now.Add(graphThrottleBackoff)
+			}
+			touched = append(touched, entry)
+		}
+	}
+	if usage := header.Get("X-Business-Use-Case-Usage"); usage != "" {
+		var accounts map[string][]graphUsage
+		if json.Unmarshal([]byte(usage), &accounts) == nil {
+			entry := r.entry(platform, connection, graphAccountBudget, "")
+			entry.UsedPercent = 0
+			for _, usages := range accounts {
+				for _, u := range usages {
+					entry.UsedPercent = max(entry.UsedPercent, u.max())
+					if u.EstimatedTimeToRegainAccess > 0 {
+						entry.blockedUntil = now.Add(time.Duration(u.EstimatedTimeToRegainAccess) * time.Minute)
+					}
+				}
+			}
+			touched = append(touched, entry)
+		}
+	}
+
+	if statusCode == http.StatusTooManyRequests {
+		// the endpoint that answered 429 waits; whether that holds back
+		// publishing depends on which endpoint it was
+		entry := r.entry(platform, connection, tooManyRequestsBudget, endpoint)
+		until := now.Add(defaultRateLimitBackoff)
+		if retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+			until = retryAfter
+		} else {
+			for _, other := range touched {
+				if other.resetAt.After(until) {
+					until = other.resetAt
+				}
+			}
+		}
+		if until.After(entry.blockedUntil) {
+			entry.blockedUntil = until
+		}
+		entry.resetAt = until
+		touched = append(touched, entry)
+	}
+
+	for _, entry := range touched {
+		entry.UpdatedAt = formatLimitTime(now)
+		entry.ResetAt = formatLimitTime(entry.resetAt)
+		entry.BlockedUntil = formatLimitTime(entry.blockedUntil)
+	}
+}
+
+func (r *rateLimitRegistry) entry(platform string, connection string, budget string, endpoint string) *RateLimitStatus {
+	key := rateLimitKey(platform, connection, budget, endpoint)
+	entry, ok := r.entries[key]
+	if !ok {
+		entry = &RateLimitStatus{Platform: platform, Connection: connection, Budget: budget, Endpoint: endpoint}
+		r.entries[key] = entry
+	}
+	return entry
+}
+
+type graphUsage struct {
+	CallCount                   float64 `json:"call_count"`
+	TotalCPUTime                float64 `json:"total_cputime"`
+	TotalTime                   float64 `json:"total_time"`
+	EstimatedTimeToRegainAccess int     `json:"estimated_time_to_regain_access"`
+}
+
+func (u graphUsage) max() float64 {
+	return max(u.CallCount, u.TotalCPUTime, u.TotalTime)
+}
+
+func rateLimitKey(platform string, connection string, budget string, endpoint string) string {
+	return platform + "/" + connection + "/" + budget + "/" + endpoint
+}
+
+// rateLimitEndpoint names the endpoint of a request for per-endpoint budgets:
+// the method and path, with numeric ids replaced so every call of the same
+// endpoint shares a budget. Short numbers are API versions ("/2/tweets").
+func rateLimitEndpoint(method string, path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if len(segment) > 3 && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = ":id"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
+
+func parseHeaderFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return f
+}
+
+// parseReset understands epoch seconds (twitter), seconds until reset
+// (reddit) and timestamps (mastodon).
+func parseReset(value string, now time.Time) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		if f > 1e9 {
+			return time.Unix(int64(f), 0), true
+		}
+		return now.Add(time.Duration(f * float64(time.Second))), true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func formatLimitTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
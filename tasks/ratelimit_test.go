@@ -0,0 +1,172 @@
+package tasks
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freshRateLimits gives the test an empty registry.
+func freshRateLimits(t *testing.T) *rateLimitRegistry {
+	t.Helper()
+	previous := rateLimits
+	rateLimits = &rateLimitRegistry{entries: map[string]*RateLimitStatus{}}
+	t.Cleanup(func() { rateLimits = previous })
+	return rateLimits
+}
+
+func limitHeader(values map[string]string) http.Header {
+	header := http.Header{}
+	for key, value := range values {
+		header.Set(key, value)
+	}
+	return header
+}
+
+func TestObserveBlocksPublishing(t *testing.T) {
+	now := time.Now()
+	reset := strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10)
+	exhausted := func(prefix string) http.Header {
+		return limitHeader(map[string]string{prefix + "-limit": "100", prefix + "-remaining": "0", prefix + "-reset": reset})
+	}
+
+	tests := []struct {
+		name        string
+		platform    string
+		endpoint    string
+		statusCode  int
+		header      http.Header
+		wantLimited bool
+	}{
+		{name: "tweet endpoint exhausted", platform: "twitter", endpoint: "POST /2/tweets", statusCode: 200, header: exhausted("x-rate-limit"), wantLimited: true},
+		{name: "lookup endpoint exhausted", platform: "twitter", endpoint: "GET /2/users/:id/tweets", statusCode: 200, header: exhausted("x-rate-limit")},
+		{name: "daily posting limit reached on a lookup", platform: "twitter", endpoint: "GET /2/users/:id/tweets", statusCode: 200, header: exhausted("x-user-limit-24hour"), wantLimited: true},
+		{name: "daily app limit reached", platform: "twitter", endpoint: "POST /2/tweets", statusCode: 200, header: exhausted("x-app-limit-24hour"), wantLimited: true},
+		{name: "budget left", platform: "twitter", endpoint: "POST /2/tweets", statusCode: 200, header: limitHeader(map[string]string{"x-rate-limit-limit": "100", "x-rate-limit-remaining": "1", "x-rate-limit-reset": reset})},
+		{name: "reddit account budget exhausted", platform: "reddit", endpoint: "GET /api/info", statusCode: 200, header: limitHeader(map[string]string{"x-ratelimit-used": "600", "x-ratelimit-remaining": "0", "x-ratelimit-reset": "120"}), wantLimited: true},
+		{name: "429 on the publish endpoint", platform: "mastodon", endpoint: "POST /api/v1/statuses", statusCode: 429, header: limitHeader(map[string]string{"Retry-After": "30"}), wantLimited: true},
+		{name: "429 on a lookup", platform: "twitter", endpoint: "GET /2/users/:id/tweets", statusCode: 429, header: limitHeader(map[string]string{"Retry-After": "30"})},
+		{name: "graph app usage at 100%", platform: "facebook", endpoint: "GET /:id/posts", statusCode: 200, header: limitHeader(map[string]string{"X-App-Usage": `{"call_count":100,"total_cputime":10,"total_time":10}`}), wantLimited: true},
+		{name: "graph page throttled", platform: "facebook", endpoint: "POST /:id/feed", statusCode: 200, header: limitHeader(map[string]string{"X-Business-Use-Case-Usage": `{"123":[{"call_count":100,"estimated_time_to_regain_access":5}]}`}), wantLimited: true},
+		{name: "graph usage below the limit", platform: "facebook", endpoint: "POST /:id/feed", statusCode: 200, header: limitHeader(map[string]string{"X-App-Usage": `{"call_count":80}`})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := freshRateLimits(t)
+			registry.observe(tt.platform, "conn1", tt.endpoint, tt.statusCode, tt.header, now)
+			until, limited := RateLimitedUntil(tt.platform, "conn1")
+			if limited != tt.wantLimited {
+				t.Fatalf("RateLimitedUntil = %v, %v; want limited %v (budgets %+v)", until, limited, tt.wantLimited, RateLimits())
+			}
+		})
+	}
+}
+
+func TestObserveKeepsBudgetsApart(t *testing.T) {
+	registry := freshRateLimits(t)
+	now := time.Now()
+	reset := strconv.FormatInt(now.Add(time.Hour).Unix(), 10)
+
+	// one tweet response carries both the endpoint and the daily budget
+	registry.observe("twitter", "conn1", "POST /2/tweets", 200, limitHeader(map[string]string{
+		"x-rate-limit-limit":            "200",
+		"x-rate-limit-remaining":        "150",
+		"x-rate-limit-reset":            reset,
+		"x-user-limit-24hour-limit":     "17",
+		"x-user-limit-24hour-remaining": "3",
+		"x-user-limit-24hour-reset":     reset,
+	}), now)
+	registry.observe("twitter", "conn1", "GET /2/users/:id/tweets", 200, limitHeader(map[string]string{
+		"x-rate-limit-limit":     "5",
+		"x-rate-limit-remaining": "0",
+		"x-rate-limit-reset":     reset,
+	}), now)
+
+	remaining := map[string]int{}
+	for _, status := range RateLimits() {
+		remaining[status.Budget+" "+status.Endpoint] = status.Remaining
+	}
+	want := map[string]int{
+		"x-rate-limit POST /2/tweets":          150,
+		"x-rate-limit GET /2/users/:id/tweets": 0,
+		"x-user-limit-24hour ":                 3,
+	}
+	if len(remaining) != len(want) {
+		t.Fatalf("budgets = %v, want %v", remaining, want)
+	}
+	for budget, value := range want {
+		if got, ok := remaining[budget]; !ok || got != value {
+			t.Fatalf("budget %q remaining = %d (known %v), want %d", budget, got, ok, value)
+		}
+	}
+	if _, limited := RateLimitedUntil("twitter", "conn1"); limited {
+		t.Fatal("an exhausted lookup endpoint blocks publishing")
+	}
+}
+
+func TestRateLimitedUntilScopes(t *testing.T) {
+	registry := freshRateLimits(t)
+	now := time.Now()
+	registry.observe("reddit", "conn1", "POST /api/submit", 200, limitHeader(map[string]string{"x-ratelimit-remaining": "0", "x-ratelimit-used": "100", "x-ratelimit-reset": "300"}), now)
+	registry.observe("facebook", "page1", "POST /:id/feed", 200, limitHeader(map[string]string{"X-App-Usage": `{"call_count":100}`}), now)
+
+	tests := []struct {
+		platform    string
+		connection  string
+		wantLimited bool
+	}{
+		{platform: "reddit", connection: "conn1", wantLimited: true},
+		{platform: "reddit", connection: "conn2"},
+		{platform: "twitter", connection: "conn1"},
+		// X-App-Usage is shared by every page of the app
+		{platform: "facebook", connection: "page2", wantLimited: true},
+	}
+	for _, tt := range tests {
+		until, limited := RateLimitedUntil(tt.platform, tt.connection)
+		if limited != tt.wantLimited {
+			t.Fatalf("RateLimitedUntil(%s, %s) = %v, %v; want limited %v", tt.platform, tt.connection, until, limited, tt.wantLimited)
+		}
+	}
+}
+
+func TestParseReset(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Time
+		wantOK bool
+	}{
+		{value: "1792324800", want: time.Unix(1792324800, 0), wantOK: true},
+		{value: "42", want: now.Add(42 * time.Second), wantOK: true},
+		{value: "0.5", want: now.Add(500 * time.Millisecond), wantOK: true},
+		{value: "2026-10-18T12:05:00.000Z", want: now.Add(5 * time.Minute), wantOK: true},
+		{value: ""},
+		{value: "soon"},
+	}
+	for _, tt := range tests {
+		got, ok := parseReset(tt.value, now)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Fatalf("parseReset(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRateLimitEndpoint(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: "POST", path: "/2/tweets", want: "POST /2/tweets"},
+		{method: "GET", path: "/2/users/1234567890/tweets", want: "GET /2/users/:id/tweets"},
+		{method: "DELETE", path: "/2/tweets/1846987139428634858", want: "DELETE /2/tweets/:id"},
+		{method: "GET", path: "/api/v1/statuses/113", want: "GET /api/v1/statuses/113"},
+		{method: "GET", path: "/v19.0/17841400000/media", want: "GET /v19.0/:id/media"},
+	}
+	for _, tt := range tests {
+		if got := rateLimitEndpoint(tt.method, tt.path); got != tt.want {
+			t.Fatalf("rateLimitEndpoint(%s, %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
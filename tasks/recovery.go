@@ -0,0 +1,136 @@
+package tasks
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const recoveryBatchSize = 100
+
+// RecoverStuckPosts finds posts left in "sending" after their lease expired,
+// which happens when the process crashes or is redeployed mid-publish. Each one
+// is checked against the platform where possible, then marked published,
+// re-queued, or failed.
+func RecoverStuckPosts(app *pocketbase.PocketBase) {
+	if _, err := app.FindCollectionByNameOrId("posts"); err != nil {
+		return
+	}
+
+	posts, err := app.FindRecordsByFilter(
+		"posts",
+		"status = 'sending' && (lease_expires_at = '' || lease_expires_at <= @now)",
+		"",
+		recoveryBatchSize,
+		0,
+	)
+	if err != nil {
+		app.Logger().Error("Failed to fetch stuck posts", "error", err.Error())
+		return
+	}
+
+	for _, post := range posts {
+		recoverStuckPost(app, post)
+	}
+}
+
+func recoverStuckPost(app *pocketbase.PocketBase, post *core.Record) {
+	postId := post.Id
+	job := findActiveJob(app, postId)
+	if job != nil && publishPool().isRunning(job.Id) {
+		// a slow upload on this instance outlived the lease; it is not stuck
+		leasePost(app, postId)
+		return
+	}
+	if job != nil && job.GetString("status") == JobStatusRunning && job.GetDateTime("lease_expires_at").After(types.NowDateTime()) {
+		// still within another instance's job lease
+		return
+	}
+
+	connection, err := app.FindRecordById("connections", post.GetString("connection"))
+	if err != nil {
+		recoveryFail(app, job, post, "", fmt.Errorf("recovery: connection not found for stuck post: %w", err))
+		return
+	}
+	platform := connection.GetString("connection_name")
+
+	app.Logger().Warn("Recovering post stuck in sending", "postId", postId, "platform", platform, "leaseOwner", post.GetString("lease_owner"), "leaseExpiresAt", post.GetString("lease_expires_at"))
+
+	if publishedPostId := post.GetString("published_post_id"); publishedPostId != "" {
+		exists, err := VerifyPublished(platform, connection.GetString("connection_id"), connection.GetString("access_token"), publishedPostId)
+		if err == nil && exists {
+			app.Logger().Info("Stuck post found on platform; marking published", "postId", postId, "publishedPostId", publishedPostId)
+			if job != nil {
+				job.Set("status", JobStatusCompleted)
+				job.Set("completed_at", types.NowDateTime())
+				if saveErr := app.Save(job); saveErr != nil {
+					app.Logger().Error("Failed to complete recovered publish job", "jobId", job.Id, "error", saveErr.Error())
+				}
+			}
+			SuccessPost(app, platform, postId, publishedPostId)
+			return
+		}
+		if err != nil {
+			app.Logger().Warn("Could not verify stuck post on platform", "postId", postId, "platform", platform, "error", err.Error())
+		}
+	}
+
+	if job == nil {
+		// published inline without a job; hand it back to the scheduler
+		post.Set("status", "scheduled")
+		post.Set("logs", "recovery: publish was interrupted; re-scheduled")
+		clearLease(post)
+		if err := app.Save(post); err != nil {
+			app.Logger().Error("Failed to re-schedule stuck post", "postId", postId, "error", err.Error())
+		}
+		return
+	}
+
+	if job.GetInt("attempts") >= job.GetInt("max_attempts") {
+		recoveryFail(app, job, post, platform, fmt.Errorf("recovery: publish outcome unknown after %d attempt(s); check the account before retrying", job.GetInt("attempts")))
+		return
+	}
+
+	job.Set("status", JobStatusQueued)
+	job.Set("next_run_at", types.NowDateTime())
+	job.Set("last_error", "recovery: previous attempt was interrupted")
+	if err := app.Save(job); err != nil {
+		app.Logger().Error("Failed to re-queue stuck publish job", "jobId", job.Id, "error", err.Error())
+		return
+	}
+
+	post.Set("status", "retrying")
+	post.Set("logs", "recovery: publish was interrupted; re-queued")
+	clearLease(post)
+	if err := app.Save(post); err != nil {
+		app.Logger().Error("Failed to update re-queued post", "postId", postId, "error", err.Error())
+	}
+	app.Logger().Info("Stuck post re-queued", "postId", postId, "jobId", job.Id)
+}
+
+func recoveryFail(app *pocketbase.PocketBase, job *core.Record, post *core.Record, platform string, err error) {
+	if job != nil {
+		failJob(app, job, err)
+		return
+	}
+	FailedPost(app, platform, post.Id, err)
+}
+
+// findActiveJob returns the queued or running job for a post, if any.
+func findActiveJob(app *pocketbase.PocketBase, postId string) *core.Record {
+	if _, err := app.FindCollectionByNameOrId(publishJobsCollection); err != nil {
+		return nil
+	}
+	job, err := app.FindFirstRecordByFilter(
+		publishJobsCollection,
+		"post = {:post} && (status = {:queued} || status = {:running})",
+		dbx.Params{"post": postId, "queued": JobStatusQueued, "running": JobStatusRunning},
+	)
+	if err != nil {
+		return nil
+	}
+	return job
+}
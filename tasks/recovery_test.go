@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestRecoverStuckPosts(t *testing.T) {
+	app := newTestApp(t)
+	connection := saveTestRecord(t, app, "connections", map[string]any{"user": "user1", "connection_name": "mastodon", "connection_id": "acct"})
+	now := time.Now().UTC()
+	expired, live := now.Add(-time.Minute), now.Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		post          map[string]any
+		job           map[string]any
+		wantStatus    string
+		wantJobStatus string
+		wantJobDueNow bool
+		wantLease     bool
+	}{
+		{
+			name:          "interrupted job is re-queued",
+			post:          map[string]any{"status": "sending", "lease_owner": "gone", "lease_expires_at": expired},
+			job:           map[string]any{"status": JobStatusRunning, "attempts": 1, "max_attempts": 3, "lease_owner": "gone", "lease_expires_at": expired},
+			wantStatus:    "retrying",
+			wantJobStatus: JobStatusQueued,
+			wantJobDueNow: true,
+		},
+		{
+			name:          "post without a lease expiry",
+			post:          map[string]any{"status": "sending"},
+			job:           map[string]any{"status": JobStatusQueued, "attempts": 0, "max_attempts": 3},
+			wantStatus:    "retrying",
+			wantJobStatus: JobStatusQueued,
+			wantJobDueNow: true,
+		},
+		{
+			name:          "last attempt fails the post",
+			post:          map[string]any{"status": "sending", "lease_owner": "gone", "lease_expires_at": expired},
+			job:           map[string]any{"status": JobStatusRunning, "attempts": 3, "max_attempts": 3, "lease_owner": "gone", "lease_expires_at": expired},
+			wantStatus:    "failed",
+			wantJobStatus: JobStatusFailed,
+		},
+		{
+			name:       "inline publish goes back to the scheduler",
+			post:       map[string]any{"status": "sending", "lease_owner": "gone", "lease_expires_at": expired},
+			wantStatus: "scheduled",
+		},
+		{
+			name:          "post lease still live",
+			post:          map[string]any{"status": "sending", "lease_owner": "other", "lease_expires_at": live},
+			job:           map[string]any{"status": JobStatusRunning, "attempts": 1, "max_attempts": 3, "lease_owner": "other", "lease_expires_at": live},
+			wantStatus:    "sending",
+			wantJobStatus: JobStatusRunning,
+			wantLease:     true,
+		},
+		{
+			name:          "job lease of another instance still live",
+			post:          map[string]any{"status": "sending", "lease_owner": "other", "lease_expires_at": expired},
+			job:           map[string]any{"status": JobStatusRunning, "attempts": 1, "max_attempts": 3, "lease_owner": "other", "lease_expires_at": live},
+			wantStatus:    "sending",
+			wantJobStatus: JobStatusRunning,
+			wantLease:     true,
+		},
+		{
+			name:          "job waiting out a rate limit is left alone",
+			post:          map[string]any{"status": "retrying"},
+			job:           map[string]any{"status": JobStatusQueued, "attempts": 0, "max_attempts": 3, "next_run_at": live},
+			wantStatus:    "retrying",
+			wantJobStatus: JobStatusQueued,
+		},
+		{
+			name:          "post held by a pause is left alone",
+			post:          map[string]any{"status": "paused", "paused_by": "pause1"},
+			job:           map[string]any{"status": JobStatusQueued, "attempts": 0, "max_attempts": 3, "next_run_at": live},
+			wantStatus:    "paused",
+			wantJobStatus: JobStatusQueued,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.post["connection"] = connection.Id
+			tt.post["user"] = "user1"
+			tt.post["content"] = "hello"
+			post := saveTestRecord(t, app, "posts", tt.post)
+			var job *core.Record
+			if tt.job != nil {
+				tt.job["post"] = post.Id
+				tt.job["connection"] = connection.Id
+				tt.job["platform"] = "mastodon"
+				if _, ok := tt.job["next_run_at"]; !ok {
+					tt.job["next_run_at"] = expired
+				}
+				job = saveTestRecord(t, app, publishJobsCollection, tt.job)
+			}
+
+			RecoverStuckPosts(app)
+
+			stored := reload(t, app, post)
+			if got := stored.GetString("status"); got != tt.wantStatus {
+				t.Fatalf("post status = %q, want %q (logs %q)", got, tt.wantStatus, stored.GetString("logs"))
+			}
+			if hasLease := stored.GetString("lease_owner") != ""; hasLease != tt.wantLease {
+				t.Fatalf("post lease owner = %q, want lease %v", stored.GetString("lease_owner"), tt.wantLease)
+			}
+			if job == nil {
+				return
+			}
+			storedJob := reload(t, app, job)
+			if got := storedJob.GetString("status"); got != tt.wantJobStatus {
+				t.Fatalf("job status = %q, want %q", got, tt.wantJobStatus)
+			}
+			// re-queued jobs run on the next tick, the others keep their slot
+			nextRun := storedJob.GetDateTime("next_run_at").Time()
+			dueNow := nextRun.After(now.Add(-time.Second)) && !nextRun.After(time.Now())
+			if dueNow != tt.wantJobDueNow {
+				t.Fatalf("job next_run_at = %v, want due now %v", nextRun, tt.wantJobDueNow)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package tasks
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/pocketbase/pocketbase"
 )
 
@@ -14,149 +17,27 @@ const (
 )
 
 type PostToSocialPayload struct {
-	Title        string
-	Content      string
-	Link         string
-	Images       []string
-	ConnectionId string
-	AccessToken  string
-	SocialPostId string
-}
-
-func FacebookPagePost(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string, link string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Link:         link,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	// StartQueue("facebook", data)
-	return HandleFacebookPagePostTask(app, data)
-}
-
-func LinkedinPost(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	// StartQueue("linkedin", data)
-	return HandleLinkedinProfilePostTask(app, data)
-}
-
-func PostToTwitterProfile(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	// StartQueue("twitter", data)
-	return HandleTwitterPostTask(app, data)
-}
-func InstagramPost(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	// StartQueue("instagram", data)
-	return HandleInstagramPostTask(app, data)
-}
-
-func PostToPinterestBoard(app *pocketbase.PocketBase, title, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Title:        title,
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	// StartQueue("pinterest", data)
-	return HandlePinterestBoardPostTask(app, data)
-}
-
-func PostToDiscordChannel(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	// StartQueue("discord", data)
-	return HandleDiscordPostTask(app, data)
-
-}
-
-func PostToMastodon(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	app.Logger().Info("Postinh to mastodon", "data", data)
-
-	// StartQueue("discord", data)
-	return HandlePostToMastodon(app, data)
-
-}
-
-func PostToThreads(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	app.Logger().Info("Postinh to threads", "data", data)
-
-	// StartQueue("discord", data)
-	return HandlePostToThreads(app, data)
-
-}
-func PostToReddit(app *pocketbase.PocketBase, postContent string, images []string, connectionId string, accessToken string, socialPostId string) error {
-
-	data := PostToSocialPayload{
-		Content:      postContent,
-		Images:       images,
-		ConnectionId: connectionId,
-		AccessToken:  accessToken,
-		SocialPostId: socialPostId,
-	}
-
-	app.Logger().Info("Postinh to reddit", "data", data)
-
-	// StartQueue("discord", data)
-	return HandlePostToReddit(app, data)
-
+	Title        string   `json:"title"`
+	Content      string   `json:"content"`
+	Link         string   `json:"link"`
+	Images       []string `json:"images"`
+	ConnectionId string   `json:"connection_id"`
+	AccessToken  string   `json:"-"` // resolved from the connection when the job runs
+	SocialPostId string   `json:"social_post_id"`
+	// FirstComment is posted as a comment once the post is live, on
+	// platforms that support it (see PostVariant).
+	FirstComment string `json:"first_comment"`
+	// ThreadParts are published as a chain of replies after this post.
+	ThreadParts []ThreadPart `json:"thread_parts"`
+	// ReplyTo is the platform id of the part this one replies to.
+	ReplyTo string `json:"reply_to"`
+	// IdempotencyKey is the same for every attempt to publish this content.
+	IdempotencyKey string `json:"idempotency_key"`
+	// MediaSizes holds byte sizes of newly uploaded files for validation.
+	MediaSizes map[string]int64 `json:"-"`
+	// HTTPClient overrides the client for platform calls; dry runs use it to
+	// record requests instead of sending them.
+	HTTPClient *http.Client `json:"-"`
 }
 
 func FailedPost(app *pocketbase.PocketBase, platform string, postId string, err error) {
@@ -165,17 +46,21 @@ func FailedPost(app *pocketbase.PocketBase, platform string, postId string, err
 		app.Logger().Error("Failed to load post for failed status update", "postId", postId, "error", findErr.Error())
 		return
 	}
+	publishErr := ClassifyError(platform, err)
 	previousStatus := record.GetString("status")
 	record.Set("status", "failed")
-	record.Set("logs", err.Error())
+	clearLease(record)
+	record.Set("logs", fmt.Sprintf("[%s] %s", publishErr.Class, err.Error()))
+	record.Set("error_class", string(publishErr.Class))
 	if saveErr := app.Save(record); saveErr != nil {
 		app.Logger().Error("Failed to update post status to failed", "postId", postId, "error", saveErr.Error())
 		return
 	}
 	if previousStatus != "failed" {
-		createPostNotification(app, record, "post_failed", platform, err.Error())
+		createPostNotification(app, record, "post_failed", platform, publishErr.UserMessage())
 	}
-	app.Logger().Error("Failed to post on "+platform, "type", "posting", "platform", platform, "postId", postId, "error", err.Error())
+	UpdateConnectionHealth(app, record.GetString("connection"), publishErr)
+	app.Logger().Error("Failed to post on "+platform, "type", "posting", "platform", platform, "postId", postId, "class", publishErr.Class, "error", err.Error())
 }
 
 func SuccessPost(app *pocketbase.PocketBase, platform string, postId string, publishedPostId string) {
@@ -186,12 +71,15 @@ func SuccessPost(app *pocketbase.PocketBase, platform string, postId string, pub
 	}
 	previousStatus := record.GetString("status")
 	record.Set("status", "published")
+	clearLease(record)
 	record.Set("published_post_id", publishedPostId)
 	record.Set("logs", "")
+	record.Set("error_class", "")
 	if saveErr := app.Save(record); saveErr != nil {
 		app.Logger().Error("Failed to update post status to published", "postId", postId, "error", saveErr.Error())
 		return
 	}
+	UpdateConnectionHealth(app, record.GetString("connection"), nil)
 	if previousStatus != "published" {
 		createPostNotification(app, record, "post_published", platform, "")
 	}
@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// ThreadPart is one reply of a thread. The post's own content and images are
+// the first part; thread_parts holds the ones after it, in order. Images
+// name files of the post's images or thread_images.
+type ThreadPart struct {
+	Content string   `json:"content"`
+	Images  []string `json:"images"`
+}
+
+// ParseThreadParts decodes the thread_parts field of a post.
+func ParseThreadParts(raw string) ([]ThreadPart, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	var parts []ThreadPart
+	if err := json.Unmarshal([]byte(raw), &parts); err != nil {
+		return nil, fmt.Errorf("thread_parts must be a list of {content, images}: %w", err)
+	}
+	return parts, nil
+}
+
+// threadPayloads splits a thread payload into one payload per part. Later
+// parts get their own idempotency key so a retried part is not mistaken for
+// the first one.
+func threadPayloads(p PostToSocialPayload) []PostToSocialPayload {
+	payloads := make([]PostToSocialPayload, 0, len(p.ThreadParts)+1)
+	first := p
+	first.ThreadParts = nil
+	payloads = append(payloads, first)
+	for i, part := range p.ThreadParts {
+		next := first
+		next.Title = ""
+		next.Content = part.Content
+		next.Images = part.Images
+		next.FirstComment = ""
+		if p.IdempotencyKey != "" {
+			next.IdempotencyKey = fmt.Sprintf("%s-%d", p.IdempotencyKey, i+1)
+		}
+		payloads = append(payloads, next)
+	}
+	return payloads
+}
+
+// publishThread publishes the parts that have not been published yet, each
+// as a reply to the previous one, and records every part's id in the post's
+// thread_progress as soon as it is live. A failed thread therefore resumes
+// after its last published part. It returns the id of the first part.
+func (p *PlatformPublisher) publishThread(app *pocketbase.PocketBase, payload PostToSocialPayload) (string, error) {
+	var progress []string
+	if !payload.IsDryRun() {
+		progress = threadProgress(app, payload.SocialPostId)
+	}
+
+	for i, part := range threadPayloads(payload) {
+		if i < len(progress) {
+			continue
+		}
+		if i > 0 {
+			part.ReplyTo = progress[i-1]
+		}
+		publishedPostId, err := p.PublishFunc(app, part)
+		if err != nil {
+			if i > 0 {
+				err = fmt.Errorf("thread part %d of %d: %w", i+1, len(payload.ThreadParts)+1, err)
+			}
+			return "", err
+		}
+		progress = append(progress, publishedPostId)
+		if !payload.IsDryRun() {
+			if err := saveThreadProgress(app, payload.SocialPostId, progress); err != nil {
+				app.Logger().Error("Failed to save thread progress", "postId", payload.SocialPostId, "part", i+1, "error", err.Error())
+			}
+		}
+	}
+	if len(progress) == 0 {
+		return "", nil
+	}
+	return progress[0], nil
+}
+
+func threadProgress(app *pocketbase.PocketBase, postId string) []string {
+	record, err := app.FindRecordById("posts", postId)
+	if err != nil {
+		return nil
+	}
+	var progress []string
+	_ = record.UnmarshalJSONField("thread_progress", &progress)
+	return progress
+}
+
+func saveThreadProgress(app *pocketbase.PocketBase, postId string, progress []string) error {
+	record, err := app.FindRecordById("posts", postId)
+	if err != nil {
+		return err
+	}
+	record.Set("thread_progress", progress)
+	return app.Save(record)
+}
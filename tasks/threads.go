@@ -15,12 +15,13 @@ type ThreadsResponse struct {
 	ID string `json:"id"`
 }
 
-func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) error {
+func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 	content := p.Content
 	images := p.Images
 	connectionId := p.ConnectionId
 	accessToken := p.AccessToken
 	socialPostId := p.SocialPostId
+	client := p.client()
 	backendHost := os.Getenv("API_HOST")
 	// backendHost = "https://content-clock.loca.lt"
 	hasVideo := containsVideoFile(images)
@@ -32,11 +33,13 @@ func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) erro
 		params.Add("media_type", "TEXT")
 		params.Add("text", content)
 		params.Add("access_token", accessToken)
+		if p.ReplyTo != "" {
+			params.Add("reply_to_id", p.ReplyTo)
+		}
 		reqUrl := fmt.Sprintf("%s/%s/threads", threadsUrl, connectionId)
-		resp, err := helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, params, nil)
+		resp, err := helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, params, nil)
 		if err != nil {
-			FailedPost(app, "threads", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		publishParams := url.Values{}
@@ -44,12 +47,11 @@ func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) erro
 		publishParams.Add("access_token", accessToken)
 
 		reqUrl = fmt.Sprintf("%s/%s/threads_publish", threadsUrl, connectionId)
-		resp, err = helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, publishParams, nil)
+		resp, err = helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, publishParams, nil)
 		if err != nil {
-			FailedPost(app, "threads", socialPostId, err)
-			return err
+			return "", err
 		}
-		SuccessPost(app, "threads", socialPostId, resp.ID)
+		return resp.ID, nil
 	} else if len(images) == 1 {
 		if hasVideo {
 			videoURL := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, images[0])
@@ -59,25 +61,25 @@ func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) erro
 			params.Add("text", content)
 			params.Add("video_url", videoURL)
 			params.Add("access_token", accessToken)
+			if p.ReplyTo != "" {
+				params.Add("reply_to_id", p.ReplyTo)
+			}
 
 			reqUrl := fmt.Sprintf("%s/%s/threads", threadsUrl, connectionId)
-			resp, err := helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, params, nil)
+			resp, err := helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, params, nil)
 			if err != nil {
-				FailedPost(app, "threads", socialPostId, err)
-				return err
+				return "", err
 			}
 
 			publishParams := url.Values{}
 			publishParams.Add("creation_id", resp.ID)
 			publishParams.Add("access_token", accessToken)
 			reqUrl = fmt.Sprintf("%s/%s/threads_publish", threadsUrl, connectionId)
-			resp, err = helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, publishParams, nil)
+			resp, err = helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, publishParams, nil)
 			if err != nil {
-				FailedPost(app, "threads", socialPostId, err)
-				return err
+				return "", err
 			}
-			SuccessPost(app, "threads", socialPostId, resp.ID)
-			return nil
+			return resp.ID, nil
 		}
 
 		imageUrl := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, images[0])
@@ -88,29 +90,29 @@ func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) erro
 		params.Add("text", content)
 		params.Add("image_url", imageUrl)
 		params.Add("access_token", accessToken)
+		if p.ReplyTo != "" {
+			params.Add("reply_to_id", p.ReplyTo)
+		}
 
 		reqUrl := fmt.Sprintf("%s/%s/threads", threadsUrl, connectionId)
-		resp, err := helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, params, nil)
+		resp, err := helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, params, nil)
 		if err != nil {
-			FailedPost(app, "threads", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		publishParams := url.Values{}
 		publishParams.Add("creation_id", resp.ID)
 		publishParams.Add("access_token", accessToken)
 		reqUrl = fmt.Sprintf("%s/%s/threads_publish", threadsUrl, connectionId)
-		resp, err = helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, publishParams, nil)
+		resp, err = helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, publishParams, nil)
 		if err != nil {
-			FailedPost(app, "threads", socialPostId, err)
-			return err
+			return "", err
 		}
-		SuccessPost(app, "threads", socialPostId, resp.ID)
+		return resp.ID, nil
 	} else if len(images) > 1 {
 		if hasVideo {
 			err := fmt.Errorf("threads supports only a single video post")
-			FailedPost(app, "threads", socialPostId, err)
-			return err
+			return "", err
 		}
 		var children string
 		for _, image := range images {
@@ -124,10 +126,9 @@ func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) erro
 			params.Add("access_token", accessToken)
 
 			url := fmt.Sprintf("%s/%s/threads", threadsUrl, connectionId)
-			resp, err := helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", url, nil, params, nil)
+			resp, err := helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", url, nil, params, nil)
 			if err != nil {
-				FailedPost(app, "threads", socialPostId, err)
-				return err
+				return "", err
 			}
 			children = children + resp.ID + ","
 
@@ -137,12 +138,14 @@ func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) erro
 		params.Add("media_type", "CAROUSEL")
 		params.Add("children", children)
 		params.Add("access_token", accessToken)
+		if p.ReplyTo != "" {
+			params.Add("reply_to_id", p.ReplyTo)
+		}
 
 		reqUrl := fmt.Sprintf("%s/%s/threads", threadsUrl, connectionId)
-		resp, err := helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, params, nil)
+		resp, err := helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, params, nil)
 		if err != nil {
-			FailedPost(app, "threads", socialPostId, err)
-			return err
+			return "", err
 		}
 
 		paramsPublish := url.Values{}
@@ -150,15 +153,13 @@ func HandlePostToThreads(app *pocketbase.PocketBase, p PostToSocialPayload) erro
 		paramsPublish.Add("access_token", accessToken)
 
 		reqUrl = fmt.Sprintf("%s/%s/threads_publish", threadsUrl, connectionId)
-		resp, err = helpers.MakeHTTPRequest[ThreadsResponse](app, "POST", reqUrl, nil, paramsPublish, nil)
+		resp, err = helpers.MakeHTTPRequestWithClient[ThreadsResponse](client, app, "POST", reqUrl, nil, paramsPublish, nil)
 		if err != nil {
-			FailedPost(app, "threads", socialPostId, err)
-			return err
+			return "", err
 		}
-		SuccessPost(app, "threads", socialPostId, resp.ID)
-
+		return resp.ID, nil
 	}
 
-	return nil
+	return "", nil
 
 }
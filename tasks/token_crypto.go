@@ -0,0 +1,326 @@
+package tasks
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Connection tokens are stored with envelope encryption: every value gets its
+// own random data key (AES-256-GCM), and that data key is stored wrapped with
+// a master key from TOKEN_ENCRYPTION_KEYS. A stored value looks like
+//
+//	enc:v1:<key id>:<wrapped data key>:<ciphertext>
+//
+// TOKEN_ENCRYPTION_KEYS is a comma separated list of id:base64 32-byte keys.
+// The first key encrypts; the others only decrypt, so a key is rotated by
+// putting a new one in front and restarting, which re-wraps every stored
+// data key with it (RotateTokenEncryption). The old key can be dropped once
+// that has run.
+//
+// Values without the prefix were stored before encryption was enabled and
+// are read as they are. Only the publisher registry, the token manager,
+// OAuth handoff redemption and ConnectionAccessToken decrypt; everything else
+// passes the stored value along.
+
+const encryptedTokenPrefix = "enc:v1:"
+
+// tokenFields are the connections fields that hold credentials.
+var tokenFields = []string{"access_token", "refresh_token"}
+
+type tokenKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+type tokenKeyring struct {
+	// current encrypts new values; nil when no key is configured
+	current *tokenKey
+	keys    map[string]*tokenKey
+}
+
+var loadTokenKeyring = sync.OnceValues(func() (*tokenKeyring, error) {
+	return parseTokenKeys(os.Getenv("TOKEN_ENCRYPTION_KEYS"))
+})
+
+func parseTokenKeys(raw string) (*tokenKeyring, error) {
+	keyring := &tokenKeyring{keys: map[string]*tokenKey{}}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, errors.New("TOKEN_ENCRYPTION_KEYS entries must be id:base64key")
+		}
+		if _, exists := keyring.keys[id]; exists {
+			return nil, fmt.Errorf("TOKEN_ENCRYPTION_KEYS lists key %q twice", id)
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(secret) != 32 {
+			return nil, fmt.Errorf("TOKEN_ENCRYPTION_KEYS key %q must be 32 bytes, base64 encoded", id)
+		}
+		aead, err := newAEAD(secret)
+		if err != nil {
+			return nil, err
+		}
+		key := &tokenKey{id: id, aead: aead}
+		if keyring.current == nil {
+			keyring.current = key
+		}
+		keyring.keys[id] = key
+	}
+	return keyring, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBytes encrypts plaintext and prepends the nonce.
+func sealBytes(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openBytes(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// TokenEncryptionEnabled reports whether TOKEN_ENCRYPTION_KEYS holds a key.
+func TokenEncryptionEnabled() (bool, error) {
+	keyring, err := loadTokenKeyring()
+	if err != nil {
+		return false, err
+	}
+	return keyring.current != nil, nil
+}
+
+// EncryptToken encrypts a token for storage with the current key. Empty and
+// already encrypted values are returned unchanged, and so is everything when
+// no key is configured.
+func EncryptToken(token string) (string, error) {
+	if token == "" || strings.HasPrefix(token, encryptedTokenPrefix) {
+		return token, nil
+	}
+	keyring, err := loadTokenKeyring()
+	if err != nil {
+		return "", err
+	}
+	if keyring.current == nil {
+		return token, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealBytes(dataAEAD, []byte(token), nil)
+	if err != nil {
+		return "", err
+	}
+	return wrapToken(keyring.current, dataKey, ciphertext)
+}
+
+func wrapToken(key *tokenKey, dataKey, ciphertext []byte) (string, error) {
+	// the key id is authenticated so a value cannot be relabelled
+	wrapped, err := sealBytes(key.aead, dataKey, []byte(key.id))
+	if err != nil {
+		return "", err
+	}
+	return encryptedTokenPrefix + key.id + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// unwrapToken returns the data key and ciphertext of an encrypted value and
+// the id of the master key that wrapped it.
+func unwrapToken(value string) (dataKey []byte, ciphertext []byte, keyId string, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedTokenPrefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, "", errors.New("malformed encrypted token")
+	}
+	keyId = parts[0]
+	keyring, err := loadTokenKeyring()
+	if err != nil {
+		return nil, nil, keyId, err
+	}
+	key, ok := keyring.keys[keyId]
+	if !ok {
+		return nil, nil, keyId, fmt.Errorf("token was encrypted with key %q, which is not in TOKEN_ENCRYPTION_KEYS", keyId)
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, keyId, errors.New("malformed encrypted token")
+	}
+	ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, keyId, errors.New("malformed encrypted token")
+	}
+	dataKey, err = openBytes(key.aead, wrapped, []byte(keyId))
+	if err != nil {
+		return nil, nil, keyId, fmt.Errorf("failed to unwrap token key with %q: %w", keyId, err)
+	}
+	return dataKey, ciphertext, keyId, nil
+}
+
+// decryptToken returns the plain token of a stored value.
+func decryptToken(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedTokenPrefix) {
+		return value, nil
+	}
+	dataKey, ciphertext, _, err := unwrapToken(value)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	token, err := openBytes(dataAEAD, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token: %w", err)
+	}
+	return string(token), nil
+}
+
+// rewrapToken brings a stored value to the current key: plain values are
+// encrypted and values wrapped by an older key get their data key re-wrapped.
+// It reports whether the value changed.
+func rewrapToken(value string) (string, bool, error) {
+	keyring, err := loadTokenKeyring()
+	if err != nil || keyring.current == nil || value == "" {
+		return value, false, err
+	}
+	if !strings.HasPrefix(value, encryptedTokenPrefix) {
+		encrypted, err := EncryptToken(value)
+		return encrypted, err == nil, err
+	}
+	dataKey, ciphertext, keyId, err := unwrapToken(value)
+	if err != nil {
+		return value, false, err
+	}
+	if keyId == keyring.current.id {
+		return value, false, nil
+	}
+	rewrapped, err := wrapToken(keyring.current, dataKey, ciphertext)
+	return rewrapped, err == nil, err
+}
+
+// publisherToken decrypts the token a publisher is about to use. A token
+// that cannot be read, e.g. because its key was removed from
+// TOKEN_ENCRYPTION_KEYS, is a configuration error.
+func publisherToken(platform string, value string) (string, error) {
+	token, err := decryptToken(value)
+	if err != nil {
+		return "", &PublishError{Class: ErrorConfiguration, Platform: platform, Err: err}
+	}
+	return token, nil
+}
+
+// ConnectionAccessToken decrypts a connection's access token for the API
+// routes that call the platform on the owner's behalf.
+func ConnectionAccessToken(connection *core.Record) (string, error) {
+	return publisherToken(connection.GetString("connection_name"), connection.GetString("access_token"))
+}
+
+// RotateTokenEncryption encrypts connection tokens stored in plain text and
+// re-wraps those of older keys with the current key. It runs at startup;
+// without a configured key tokens are left as they are. It also removes the
+// page tokens that older Facebook and Instagram connections copied into
+// meta_data. Only an invalid TOKEN_ENCRYPTION_KEYS is returned as an error;
+// failures on single connections are logged.
+func RotateTokenEncryption(app *pocketbase.PocketBase) error {
+	enabled, err := TokenEncryptionEnabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		app.Logger().Warn("TOKEN_ENCRYPTION_KEYS is not set; connection tokens are stored unencrypted")
+	}
+
+	connections, err := app.FindAllRecords("connections")
+	if err != nil {
+		app.Logger().Error("Failed to load connections for token encryption", "error", err.Error())
+		return nil
+	}
+	updated := 0
+	for _, connection := range connections {
+		changed := false
+		if metaData, scrubbed := scrubMetaDataTokens(connection.GetString("connection_name"), connection.GetString("meta_data")); scrubbed {
+			connection.Set("meta_data", metaData)
+			changed = true
+		}
+		for _, field := range tokenFields {
+			if !enabled {
+				break
+			}
+			value, fieldChanged, err := rewrapToken(connection.GetString(field))
+			if err != nil {
+				app.Logger().Error("Failed to re-encrypt connection token", "connection", connection.Id, "field", field, "error", err.Error())
+				continue
+			}
+			if fieldChanged {
+				connection.Set(field, value)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := app.Save(connection); err != nil {
+			app.Logger().Error("Failed to save re-encrypted connection tokens", "connection", connection.Id, "error", err.Error())
+			continue
+		}
+		updated++
+	}
+	if updated > 0 {
+		app.Logger().Info("Connection tokens updated", "connections", updated)
+	}
+	return nil
+}
+
+// scrubMetaDataTokens drops the access_token that Facebook and Instagram
+// connections used to keep in meta_data next to the encrypted column.
+func scrubMetaDataTokens(platform string, metaData string) (string, bool) {
+	if platform != "facebook" && platform != "instagram" {
+		return metaData, false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(metaData), &fields); err != nil {
+		return metaData, false
+	}
+	if _, ok := fields["access_token"]; !ok {
+		return metaData, false
+	}
+	delete(fields, "access_token")
+	scrubbed, err := json.Marshal(fields)
+	if err != nil {
+		return metaData, false
+	}
+	return string(scrubbed), true
+}
@@ -0,0 +1,208 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testTokenKey(id string, fill byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+}
+
+// useTokenKeys swaps TOKEN_ENCRYPTION_KEYS for the rest of the test.
+func useTokenKeys(t *testing.T, keys ...string) {
+	t.Helper()
+	previous := loadTokenKeyring
+	raw := strings.Join(keys, ",")
+	loadTokenKeyring = func() (*tokenKeyring, error) { return parseTokenKeys(raw) }
+	t.Cleanup(func() { loadTokenKeyring = previous })
+}
+
+func TestEncryptTokenRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		keys          []string
+		token         string
+		wantEncrypted bool
+	}{
+		{name: "encrypts with the current key", keys: []string{testTokenKey("k1", 1)}, token: "access-token", wantEncrypted: true},
+		{name: "current key is the first one", keys: []string{testTokenKey("k2", 2), testTokenKey("k1", 1)}, token: "access-token", wantEncrypted: true},
+		{name: "token with separators", keys: []string{testTokenKey("k1", 1)}, token: "oauth1-token secret:with:colons", wantEncrypted: true},
+		{name: "empty token stays empty", keys: []string{testTokenKey("k1", 1)}, token: ""},
+		{name: "no key stores plain text", token: "access-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTokenKeys(t, tt.keys...)
+
+			stored, err := EncryptToken(tt.token)
+			if err != nil {
+				t.Fatalf("EncryptToken: %v", err)
+			}
+			if encrypted := strings.HasPrefix(stored, encryptedTokenPrefix); encrypted != tt.wantEncrypted {
+				t.Fatalf("stored %q, encrypted = %v, want %v", stored, encrypted, tt.wantEncrypted)
+			}
+			if tt.wantEncrypted {
+				if strings.Contains(stored, tt.token) {
+					t.Fatalf("stored value contains the plain token: %q", stored)
+				}
+				if keyId := strings.SplitN(strings.TrimPrefix(stored, encryptedTokenPrefix), ":", 2)[0]; !strings.HasPrefix(tt.keys[0], keyId+":") {
+					t.Fatalf("encrypted with key %q, want the first key", keyId)
+				}
+				again, err := EncryptToken(stored)
+				if err != nil || again != stored {
+					t.Fatalf("EncryptToken is not idempotent: %q, %v", again, err)
+				}
+			}
+
+			plain, err := decryptToken(stored)
+			if err != nil {
+				t.Fatalf("decryptToken: %v", err)
+			}
+			if plain != tt.token {
+				t.Fatalf("decryptToken = %q, want %q", plain, tt.token)
+			}
+		})
+	}
+}
+
+func TestEncryptTokenUsesFreshDataKeys(t *testing.T) {
+	useTokenKeys(t, testTokenKey("k1", 1))
+	first, _ := EncryptToken("same-token")
+	second, _ := EncryptToken("same-token")
+	if first == second {
+		t.Fatal("two encryptions of the same token are identical")
+	}
+}
+
+func TestRewrapToken(t *testing.T) {
+	oldKey, newKey := testTokenKey("old", 1), testTokenKey("new", 2)
+	useTokenKeys(t, oldKey)
+	underOld, err := EncryptToken("access-token")
+	if err != nil {
+		t.Fatalf("EncryptToken: %v", err)
+	}
+
+	useTokenKeys(t, newKey, oldKey)
+	tests := []struct {
+		name        string
+		value       string
+		wantChanged bool
+		wantPlain   string
+	}{
+		{name: "older key is re-wrapped", value: underOld, wantChanged: true, wantPlain: "access-token"},
+		{name: "plain value is encrypted", value: "legacy-token", wantChanged: true, wantPlain: "legacy-token"},
+		{name: "empty value is left alone", value: "", wantPlain: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrapped, changed, err := rewrapToken(tt.value)
+			if err != nil {
+				t.Fatalf("rewrapToken: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Fatalf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if tt.wantChanged && !strings.HasPrefix(rewrapped, encryptedTokenPrefix+"new:") {
+				t.Fatalf("rewrapped %q is not under the current key", rewrapped)
+			}
+			plain, err := decryptToken(rewrapped)
+			if err != nil || plain != tt.wantPlain {
+				t.Fatalf("decryptToken = %q, %v; want %q", plain, err, tt.wantPlain)
+			}
+			if !tt.wantChanged {
+				return
+			}
+			again, changedAgain, err := rewrapToken(rewrapped)
+			if err != nil || changedAgain || again != rewrapped {
+				t.Fatalf("second rewrap changed the value: %q, %v, %v", again, changedAgain, err)
+			}
+		})
+	}
+
+	// once rotated, the old key can be dropped
+	rewrapped, _, _ := rewrapToken(underOld)
+	useTokenKeys(t, newKey)
+	if plain, err := decryptToken(rewrapped); err != nil || plain != "access-token" {
+		t.Fatalf("decryptToken after dropping the old key = %q, %v", plain, err)
+	}
+}
+
+func TestDecryptTokenMissingKey(t *testing.T) {
+	useTokenKeys(t, testTokenKey("old", 1))
+	stored, err := EncryptToken("access-token")
+	if err != nil {
+		t.Fatalf("EncryptToken: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		keys  []string
+		value string
+	}{
+		{name: "key removed from the list", keys: []string{testTokenKey("new", 2)}, value: stored},
+		{name: "no keys configured", value: stored},
+		{name: "same id, different key", keys: []string{testTokenKey("old", 3)}, value: stored},
+		{name: "malformed value", keys: []string{testTokenKey("old", 1)}, value: encryptedTokenPrefix + "old:not-base64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTokenKeys(t, tt.keys...)
+			if plain, err := decryptToken(tt.value); err == nil {
+				t.Fatalf("decryptToken = %q, want an error", plain)
+			}
+			_, err := publisherToken("twitter", tt.value)
+			var publishErr *PublishError
+			if !errors.As(err, &publishErr) || publishErr.Class != ErrorConfiguration {
+				t.Fatalf("publisherToken error = %v, want a configuration error", err)
+			}
+		})
+	}
+}
+
+func TestParseTokenKeysRejectsInvalidLists(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "missing id", raw: ":" + base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		{name: "missing separator", raw: "k1"},
+		{name: "short key", raw: "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		{name: "not base64", raw: "k1:%%%"},
+		{name: "duplicate id", raw: testTokenKey("k1", 1) + "," + testTokenKey("k1", 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTokenKeys(tt.raw); err == nil {
+				t.Fatal("parseTokenKeys accepted an invalid list")
+			}
+		})
+	}
+}
+
+func TestScrubMetaDataTokens(t *testing.T) {
+	tests := []struct {
+		name        string
+		platform    string
+		metaData    string
+		want        string
+		wantChanged bool
+	}{
+		{name: "facebook page token", platform: "facebook", metaData: `{"access_token":"page-token","id":"1","name":"Page"}`, want: `{"id":"1","name":"Page"}`, wantChanged: true},
+		{name: "instagram page token", platform: "instagram", metaData: `{"access_token":"page-token","id":"2"}`, want: `{"id":"2"}`, wantChanged: true},
+		{name: "already clean", platform: "facebook", metaData: `{"id":"1"}`, want: `{"id":"1"}`},
+		{name: "other platforms are left alone", platform: "pinterest", metaData: `{"access_token":""}`, want: `{"access_token":""}`},
+		{name: "not a JSON object", platform: "facebook", metaData: `null`, want: `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := scrubMetaDataTokens(tt.platform, tt.metaData)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Fatalf("scrubMetaDataTokens = %s, %v; want %s, %v", got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
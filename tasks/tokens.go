@@ -0,0 +1,341 @@
+package tasks
+
+import (
+	"content-clock/helpers"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// lead time for tokens whose lifetime is not known yet
+	defaultRefreshAhead = 24 * time.Hour
+	// a connection whose refresh failed is not tried again by the cron
+	// before this has passed
+	refreshFailureBackoff = 30 * time.Minute
+	// a token refreshed this recently is not refreshed again on a 401
+	minRefreshInterval = 5 * time.Minute
+	// how long an instance may hold a connection's refresh before another
+	// can take over; far longer than a refresh grant takes
+	refreshLeaseDuration = 2 * time.Minute
+)
+
+// ErrTokenNotRefreshable is returned for connections whose platform has no
+// refresh grant or that have no refresh token.
+var ErrTokenNotRefreshable = errors.New("token cannot be refreshed")
+
+// ErrTokenRecentlyRefreshed is returned by an on-demand refresh when the
+// token was just refreshed, so a new one would not fix the failure.
+var ErrTokenRecentlyRefreshed = errors.New("token was refreshed moments ago")
+
+// ErrTokenRefreshInProgress is returned when another instance or goroutine
+// holds the connection's refresh; its new token will be stored shortly.
+var ErrTokenRefreshInProgress = errors.New("token is being refreshed elsewhere")
+
+// TokenGrant is the result of a refresh grant. A zero ExpiresAt means the
+// token does not expire; an empty RefreshToken keeps the current one.
+type TokenGrant struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (r tokenResponse) grant() TokenGrant {
+	return TokenGrant{AccessToken: r.AccessToken, RefreshToken: r.RefreshToken, ExpiresAt: TokenExpiry(r.ExpiresIn)}
+}
+
+// tokenRefresher runs a platform's refresh grant for a connection.
+// usesRefreshToken marks grants that need connections.refresh_token; the
+// others exchange the current access token for a new one. alwaysExpires
+// marks platforms whose tokens expire even when no expires_at was stored,
+// so those connections are refreshed once to learn their expiry.
+type tokenRefresher struct {
+	refresh          func(app *pocketbase.PocketBase, client *http.Client, accessToken string, refreshToken string) (TokenGrant, error)
+	usesRefreshToken bool
+	alwaysExpires    bool
+}
+
+var tokenRefreshers = map[string]tokenRefresher{
+	"reddit": {usesRefreshToken: true, alwaysExpires: true, refresh: func(app *pocketbase.PocketBase, client *http.Client, accessToken, refreshToken string) (TokenGrant, error) {
+		return postRefreshGrant(app, client, "https://www.reddit.com/api/v1/access_token", map[string]string{
+			"Authorization": "Basic " + basicCredentials(os.Getenv("REDDIT_CLIENT_ID"), os.Getenv("REDDIT_SECRET")),
+			"User-agent":    "Content Clock Local 0.1",
+		}, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+	}},
+	"pinterest": {usesRefreshToken: true, alwaysExpires: true, refresh: func(app *pocketbase.PocketBase, client *http.Client, accessToken, refreshToken string) (TokenGrant, error) {
+		// PINTEREST_SECRET holds the encoded client credentials, as in the connect flow
+		return postRefreshGrant(app, client, "https://api.pinterest.com/v5/oauth/token", map[string]string{
+			"Authorization": "Basic " + os.Getenv("PINTEREST_SECRET"),
+		}, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+	}},
+	"linkedin": {usesRefreshToken: true, alwaysExpires: true, refresh: func(app *pocketbase.PocketBase, client *http.Client, accessToken, refreshToken string) (TokenGrant, error) {
+		return postRefreshGrant(app, client, "https://www.linkedin.com/oauth/v2/accessToken", nil, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"client_id":     {os.Getenv("LINKEDIN_APP_ID")},
+			"client_secret": {os.Getenv("LINKEDIN_SECRET")},
+		})
+	}},
+	"threads": {alwaysExpires: true, refresh: func(app *pocketbase.PocketBase, client *http.Client, accessToken, refreshToken string) (TokenGrant, error) {
+		return getRefreshGrant(app, client, "https://graph.threads.net/refresh_access_token", url.Values{
+			"grant_type":   {"th_refresh_token"},
+			"access_token": {accessToken},
+		})
+	}},
+	// only connections made with OAuth 2.0 have a refresh token; OAuth 1.0a
+	// tokens do not expire
+	"twitter": {usesRefreshToken: true, alwaysExpires: true, refresh: func(app *pocketbase.PocketBase, client *http.Client, accessToken, refreshToken string) (TokenGrant, error) {
+		return postRefreshGrant(app, client, "https://api.x.com/2/oauth2/token", map[string]string{
+			"Authorization": "Basic " + basicCredentials(os.Getenv("TWITTER_CLIENT_ID"), os.Getenv("TWITTER_CLIENT_SECRET")),
+		}, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}, "client_id": {os.Getenv("TWITTER_CLIENT_ID")}})
+	}},
+	"facebook":  {refresh: exchangeFacebookToken},
+	"instagram": {refresh: exchangeFacebookToken},
+}
+
+// TokenExpiry turns an expires_in from a token response into an absolute
+// time; zero or negative means the token does not expire.
+func TokenExpiry(expiresIn int64) time.Time {
+	if expiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(expiresIn) * time.Second).UTC()
+}
+
+// ExchangeFacebookToken swaps a short-lived Facebook user token for a
+// long-lived one (fb_exchange_token). Page tokens read with a long-lived user
+// token do not expire.
+func ExchangeFacebookToken(app *pocketbase.PocketBase, accessToken string) (TokenGrant, error) {
+	return exchangeFacebookToken(app, helpers.NewHTTPClient(), accessToken, "")
+}
+
+func exchangeFacebookToken(app *pocketbase.PocketBase, client *http.Client, accessToken, refreshToken string) (TokenGrant, error) {
+	return getRefreshGrant(app, client, "https://graph.facebook.com/v19.0/oauth/access_token", url.Values{
+		"grant_type":        {"fb_exchange_token"},
+		"client_id":         {os.Getenv("FACEBOOK_APP_ID")},
+		"client_secret":     {os.Getenv("FACEBOOK_SECRET")},
+		"fb_exchange_token": {accessToken},
+	})
+}
+
+func postRefreshGrant(app *pocketbase.PocketBase, client *http.Client, tokenURL string, headers map[string]string, form url.Values) (TokenGrant, error) {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers["Content-Type"] = "application/x-www-form-urlencoded"
+	resp, err := helpers.MakeHTTPRequestWithClient[tokenResponse](client, app, "POST", tokenURL, headers, nil, form)
+	if err != nil {
+		return TokenGrant{}, err
+	}
+	return checkGrant(resp)
+}
+
+func getRefreshGrant(app *pocketbase.PocketBase, client *http.Client, tokenURL string, params url.Values) (TokenGrant, error) {
+	resp, err := helpers.MakeHTTPRequestWithClient[tokenResponse](client, app, "GET", tokenURL, nil, params, nil)
+	if err != nil {
+		return TokenGrant{}, err
+	}
+	return checkGrant(resp)
+}
+
+func checkGrant(resp tokenResponse) (TokenGrant, error) {
+	if resp.AccessToken == "" {
+		return TokenGrant{}, errors.New("token response has no access_token")
+	}
+	return resp.grant(), nil
+}
+
+// RefreshDueTokens refreshes every connection whose token expires within its
+// refresh window: a quarter of the token's lifetime, or a day when the
+// lifetime is unknown. Connections of expiring platforms without expires_at
+// (connected before expiry was tracked) are refreshed right away.
+func RefreshDueTokens(app *pocketbase.PocketBase) {
+	connections, err := app.FindRecordsByFilter(
+		"connections",
+		"deleted = ''",
+		"expires_at",
+		0,
+		0,
+	)
+	if err != nil {
+		app.Logger().Error("Failed to load connections for token refresh", "error", err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, connection := range connections {
+		refresher, ok := tokenRefreshers[connection.GetString("connection_name")]
+		if !ok || !tokenRefreshDue(connection, refresher, now) {
+			continue
+		}
+		failedAt := connection.GetDateTime("token_refresh_failed_at")
+		if !failedAt.IsZero() && now.Sub(failedAt.Time()) < refreshFailureBackoff {
+			continue
+		}
+		if err := RefreshConnectionToken(app, connection.Id, false); err != nil && !errors.Is(err, ErrTokenRefreshInProgress) {
+			app.Logger().Warn("Scheduled token refresh failed", "connection", connection.Id, "platform", connection.GetString("connection_name"), "error", err.Error())
+		}
+	}
+}
+
+func tokenRefreshDue(connection *core.Record, refresher tokenRefresher, now time.Time) bool {
+	if refresher.usesRefreshToken && connection.GetString("refresh_token") == "" {
+		return false
+	}
+	expiresAt := connection.GetDateTime("expires_at")
+	if expiresAt.IsZero() {
+		return refresher.alwaysExpires
+	}
+	ahead := defaultRefreshAhead
+	if issuedAt := connection.GetDateTime("token_refreshed_at"); !issuedAt.IsZero() && expiresAt.Time().After(issuedAt.Time()) {
+		ahead = expiresAt.Time().Sub(issuedAt.Time()) / 4
+	}
+	return expiresAt.Time().Sub(now) <= ahead
+}
+
+// RefreshConnectionToken runs the platform's refresh grant for a connection
+// and stores the new tokens and expires_at. With onDemand set (a publish got
+// a 401) a token refreshed in the last few minutes is not refreshed again.
+// A rejected refresh marks the connection as needing re-authorization.
+//
+// Refresh tokens may be single-use, so the refresh is claimed in the database
+// first: only one instance runs the grant, and the others get
+// ErrTokenRefreshInProgress instead of spending the same refresh token.
+func RefreshConnectionToken(app *pocketbase.PocketBase, connectionId string, onDemand bool) error {
+	claimed, err := claimTokenRefresh(app, connectionId)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrTokenRefreshInProgress
+	}
+	defer releaseTokenRefresh(app, connectionId)
+
+	// reload after the claim: the previous holder may already have rotated
+	// the refresh token
+	connection, err := app.FindRecordById("connections", connectionId)
+	if err != nil {
+		return err
+	}
+	platform := connection.GetString("connection_name")
+	refresher, ok := tokenRefreshers[platform]
+	if !ok || (refresher.usesRefreshToken && connection.GetString("refresh_token") == "") {
+		return ErrTokenNotRefreshable
+	}
+	if !refresher.alwaysExpires && connection.GetDateTime("expires_at").IsZero() {
+		// facebook and instagram page tokens do not expire; an exchange
+		// would not fix a rejected one
+		return ErrTokenNotRefreshable
+	}
+	if refreshedAt := connection.GetDateTime("token_refreshed_at"); onDemand && !refreshedAt.IsZero() && time.Since(refreshedAt.Time()) < minRefreshInterval {
+		return ErrTokenRecentlyRefreshed
+	}
+	if !onDemand && !tokenRefreshDue(connection, refresher, time.Now()) {
+		// another instance refreshed it since the cron picked it
+		return nil
+	}
+
+	accessToken, err := publisherToken(platform, connection.GetString("access_token"))
+	if err != nil {
+		return err
+	}
+	refreshToken, err := publisherToken(platform, connection.GetString("refresh_token"))
+	if err != nil {
+		return err
+	}
+	grant, err := refresher.refresh(app, PlatformClient(platform, connection.Id), accessToken, refreshToken)
+	if err != nil {
+		status, body, _ := helpers.HTTPErrorResponse(err)
+		publishErr := classifyFailure(platform, fmt.Errorf("token refresh failed: %w", err), status, body)
+		// only the failure fields are written, never the tokens loaded above
+		if _, saveErr := app.DB().Update("connections", dbx.Params{
+			"token_refresh_error":     publishErr.Error(),
+			"token_refresh_failed_at": types.NowDateTime().String(),
+		}, dbx.HashExp{"id": connectionId}).Execute(); saveErr != nil {
+			app.Logger().Error("Failed to record token refresh failure", "connection", connectionId, "error", saveErr.Error())
+		}
+		UpdateConnectionHealth(app, connectionId, publishErr)
+		return publishErr
+	}
+
+	encryptedAccessToken, err := EncryptToken(grant.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt refreshed token: %w", err)
+	}
+	connection.Set("access_token", encryptedAccessToken)
+	if grant.RefreshToken != "" {
+		encryptedRefreshToken, err := EncryptToken(grant.RefreshToken)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt refreshed token: %w", err)
+		}
+		connection.Set("refresh_token", encryptedRefreshToken)
+	}
+	if grant.ExpiresAt.IsZero() {
+		connection.Set("expires_at", "")
+	} else {
+		connection.Set("expires_at", grant.ExpiresAt)
+	}
+	connection.Set("token_refreshed_at", types.NowDateTime())
+	connection.Set("token_refresh_error", "")
+	connection.Set("token_refresh_failed_at", "")
+	if err := app.Save(connection); err != nil {
+		return fmt.Errorf("failed to save refreshed token: %w", err)
+	}
+	app.Logger().Info("Connection token refreshed", "connection", connectionId, "platform", platform, "expiresAt", connection.GetDateTime("expires_at").String(), "onDemand", onDemand)
+	if connection.GetString("health") == ConnectionHealthReauth {
+		UpdateConnectionHealth(app, connectionId, nil)
+	}
+	return nil
+}
+
+// claimTokenRefresh atomically leases the connection's token refresh to this
+// instance. It returns false while another holder's lease is live.
+func claimTokenRefresh(app *pocketbase.PocketBase, connectionId string) (bool, error) {
+	result, err := app.DB().NewQuery(`UPDATE connections
+			SET refresh_lease_owner = {:owner}, refresh_lease_expires_at = {:expires}
+			WHERE id = {:id}
+			AND (coalesce(refresh_lease_expires_at, '') = '' OR datetime(refresh_lease_expires_at) <= datetime('now'));`).Bind(dbx.Params{
+		"id":      connectionId,
+		"owner":   InstanceId(),
+		"expires": types.NowDateTime().Add(refreshLeaseDuration).String(),
+	}).Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func releaseTokenRefresh(app *pocketbase.PocketBase, connectionId string) {
+	_, err := app.DB().NewQuery(`UPDATE connections
+			SET refresh_lease_owner = '', refresh_lease_expires_at = ''
+			WHERE id = {:id} AND refresh_lease_owner = {:owner};`).Bind(dbx.Params{
+		"id":    connectionId,
+		"owner": InstanceId(),
+	}).Execute()
+	if err != nil {
+		app.Logger().Error("Failed to release token refresh lease", "connection", connectionId, "error", err.Error())
+	}
+}
+
+func basicCredentials(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"bytes"
+	"content-clock/helpers"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// error bodies longer than this are cut before classification
+const maxFailureBody = 64 * 1024
+
+// platformTransport sits under every publish job's platform calls. It feeds
+// rate-limit headers into the registry and keeps the last failed response so
+// the publisher can classify the error with the platform's own status and
+// error body, whatever the task code turned them into.
+type platformTransport struct {
+	platform   string
+	connection string
+	base       http.RoundTripper
+
+	mu          sync.Mutex
+	failureCode int
+	failureBody string
+}
+
+func (t *platformTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	rateLimits.observe(t.platform, t.connection, rateLimitEndpoint(req.Method, req.URL.Path), resp.StatusCode, resp.Header, time.Now())
+
+	if resp.StatusCode >= 400 {
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxFailureBody))
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		t.mu.Lock()
+		t.failureCode = resp.StatusCode
+		t.failureBody = string(body)
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// PlatformClient returns the client publish jobs use for a connection
+// (connections record id): rate-limit headers are tracked and failed
+// responses are kept for error classification. Requests time out after
+// helpers.HTTPTimeout, so a hung platform cannot hold a worker slot.
+func PlatformClient(platform string, connection string) *http.Client {
+	return &http.Client{
+		Timeout:   helpers.HTTPTimeout(),
+		Transport: &platformTransport{platform: platform, connection: connection, base: http.DefaultTransport},
+	}
+}
+
+// lastFailure returns the status and body of the last failed response sent
+// through a PlatformClient, or zero values for any other client.
+func lastFailure(client *http.Client) (int, string) {
+	if client == nil {
+		return 0, ""
+	}
+	transport, ok := client.Transport.(*platformTransport)
+	if !ok {
+		return 0, ""
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	return transport.failureCode, transport.failureBody
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"github.com/michimani/gotwi/tweet/managetweet"
 	"github.com/michimani/gotwi/tweet/managetweet/types"
 	"github.com/pocketbase/pocketbase"
+	"golang.org/x/oauth2"
 )
 
 type TwitterResponse struct {
@@ -26,47 +28,39 @@ type TwitterResponse struct {
 	} `json:"data"`
 }
 
+// MediaUpload covers both the v1.1 (OAuth 1.0a) and the v2 upload response.
 type MediaUpload struct {
 	MediaId int `json:"media_id"`
+	Data    struct {
+		ID string `json:"id"`
+	} `json:"data"`
 }
 
-func HandleTwitterPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) error {
-	if err := ensureGotwiCredentials(); err != nil {
-		FailedPost(app, "twitter", p.SocialPostId, err)
-		return err
-	}
-
+func HandleTwitterPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) (string, error) {
 	content := p.Content
 	images := p.Images
 	accessToken := p.AccessToken
 	socialPostId := p.SocialPostId
 
-	tokens := strings.Split(accessToken, " ")
-
-	in := &gotwi.NewClientInput{
-		AuthenticationMethod: gotwi.AuthenMethodOAuth1UserContext,
-		OAuthToken:           tokens[0],
-		OAuthTokenSecret:     tokens[1],
-	}
-
-	client, err := gotwi.NewClient(in)
+	client, err := newTwitterClient(p.HTTPClient, accessToken)
 	if err != nil {
-		FailedPost(app, "twitter", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	var post types.CreateInput // Remove the pointer
 	post.Text = gotwi.String(content)
+	if p.ReplyTo != "" {
+		post.Reply = &types.CreateInputReply{InReplyToTweetID: p.ReplyTo}
+	}
 
 	if len(images) > 0 {
 		mediaIds := []string{}
 		for _, image := range images {
 			backendHost := os.Getenv("API_HOST")
 			imageUrl := fmt.Sprintf("%s/api/files/posts/%s/%s", backendHost, socialPostId, image)
-			mediaId, err := uploadTwitterMedia(imageUrl, tokens[0], tokens[1])
+			mediaId, err := uploadTwitterMedia(p.client(), imageUrl, accessToken)
 			if err != nil {
-				FailedPost(app, "twitter", socialPostId, err)
-				return err
+				return "", err
 			}
 			mediaIds = append(mediaIds, mediaId)
 		}
@@ -79,14 +73,52 @@ func HandleTwitterPostTask(app *pocketbase.PocketBase, p PostToSocialPayload) er
 
 	res, err := managetweet.Create(context.Background(), client, &post)
 	if err != nil {
-		FailedPost(app, "twitter", socialPostId, err)
-		return err
+		return "", err
 	}
 
 	tweetId := gotwi.StringValue(res.Data.ID)
-	SuccessPost(app, "twitter", socialPostId, tweetId)
-	return nil
+	return tweetId, nil
+
+}
 
+// twitterOAuth1Token returns the OAuth 1.0a token of a connection made before
+// X moved to OAuth 2.0; those store "token secret". Newer connections store
+// an OAuth 2.0 bearer token, which has no space in it.
+func twitterOAuth1Token(accessToken string) (*oauth1.Token, bool) {
+	token, secret, ok := strings.Cut(accessToken, " ")
+	if !ok {
+		return nil, false
+	}
+	return oauth1.NewToken(token, secret), true
+}
+
+// newTwitterClient is a gotwi client for either kind of stored token.
+func newTwitterClient(httpClient *http.Client, accessToken string) (*gotwi.Client, error) {
+	if token, ok := twitterOAuth1Token(accessToken); ok {
+		if err := ensureGotwiCredentials(); err != nil {
+			return nil, err
+		}
+		return gotwi.NewClient(&gotwi.NewClientInput{
+			AuthenticationMethod: gotwi.AuthenMethodOAuth1UserContext,
+			OAuthToken:           token.Token,
+			OAuthTokenSecret:     token.TokenSecret,
+			HTTPClient:           httpClient,
+		})
+	}
+	return gotwi.NewClientWithAccessToken(&gotwi.NewClientWithAccessTokenInput{
+		AccessToken: accessToken,
+		HTTPClient:  httpClient,
+	})
+}
+
+// twitterHTTPClient wraps base so its requests are authorized with the
+// stored token, signed for OAuth 1.0a or with a bearer header for OAuth 2.0.
+func twitterHTTPClient(base *http.Client, accessToken string) *http.Client {
+	if token, ok := twitterOAuth1Token(accessToken); ok {
+		config := oauth1.NewConfig(os.Getenv("TWITTER_KEY"), os.Getenv("TWITTER_SECRET"))
+		return config.Client(context.WithValue(oauth1.NoContext, oauth1.HTTPClient, base), token)
+	}
+	return oauth2.NewClient(context.WithValue(context.Background(), oauth2.HTTPClient, base), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken}))
 }
 
 func ensureGotwiCredentials() error {
@@ -113,27 +145,14 @@ func ensureGotwiCredentials() error {
 	return nil
 }
 
-func uploadTwitterMedia(path string, oauthToken string, oauthTokenSecret string) (string, error) {
-
-	config := oauth1.NewConfig(os.Getenv("TWITTER_KEY"), os.Getenv("TWITTER_SECRET"))
-
-	var token oauth1.Token
-
-	token.Token = oauthToken
-	token.TokenSecret = oauthTokenSecret
+func uploadTwitterMedia(client *http.Client, path string, accessToken string) (string, error) {
 
 	// httpClient will automatically authorize http.Request's
-	httpClient := config.Client(oauth1.NoContext, &token)
+	httpClient := twitterHTTPClient(client, accessToken)
+	_, oauth1User := twitterOAuth1Token(accessToken)
 	b := &bytes.Buffer{}
 	form := multipart.NewWriter(b)
 
-	// resp, err := http.Get(path)
-	// if err != nil {
-	// 	helpers.Logging("error", err.Error())
-	// 	return "", err
-	// }
-	// defer resp.Body.Close()
-
 	fileLocation, err := helpers.DownloadImage(path, true)
 	if err != nil {
 		helpers.Logging("error", err.Error())
@@ -161,15 +180,24 @@ func uploadTwitterMedia(path string, oauthToken string, oauthTokenSecret string)
 		return "", err
 	}
 
+	// OAuth 1.0a tokens keep using v1.1; OAuth 2.0 tokens only work with v2
+	uploadURL := "https://upload.twitter.com/1.1/media/upload.json?media_category=tweet_image"
+	if !oauth1User {
+		uploadURL = "https://api.x.com/2/media/upload"
+		if err := form.WriteField("media_category", "tweet_image"); err != nil {
+			return "", err
+		}
+	}
+
 	// close form
 	form.Close()
 
-	// example Twitter API request
-	uploadResp, err := httpClient.Post("https://upload.twitter.com/1.1/media/upload.json?media_category=tweet_image", form.FormDataContentType(), bytes.NewReader(b.Bytes()))
+	uploadResp, err := httpClient.Post(uploadURL, form.FormDataContentType(), bytes.NewReader(b.Bytes()))
 	if err != nil {
 		helpers.Logging("error", err.Error())
 		return "", err
 	}
+	defer uploadResp.Body.Close()
 
 	body, err := ioutil.ReadAll(uploadResp.Body)
 	if err != nil {
@@ -183,6 +211,13 @@ func uploadTwitterMedia(path string, oauthToken string, oauthTokenSecret string)
 		return "", err
 	}
 
+	if !oauth1User {
+		if m.Data.ID == "" {
+			return "", fmt.Errorf("twitter media upload failed: %s", string(body))
+		}
+		return m.Data.ID, nil
+	}
+
 	mid := strconv.Itoa(m.MediaId)
 
 	return mid, nil
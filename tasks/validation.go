@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var defaultImageTypes = []string{"jpg", "jpeg", "png", "gif", "webp"}
+
+// ValidationIssue is one reason a post cannot be published to a platform.
+type ValidationIssue struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every issue found for one platform.
+type ValidationError struct {
+	Platform string            `json:"platform"`
+	Issues   []ValidationIssue `json:"issues"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		messages = append(messages, issue.Message)
+	}
+	return e.Platform + ": " + strings.Join(messages, "; ")
+}
+
+// FieldErrors maps each field to its first issue, the shape PocketBase uses
+// for the "data" of a 400 response.
+func (e *ValidationError) FieldErrors() validation.Errors {
+	fields := validation.Errors{}
+	for _, issue := range e.Issues {
+		if _, exists := fields[issue.Field]; !exists {
+			fields[issue.Field] = validation.NewError("validation_"+issue.Code, issue.Message)
+		}
+	}
+	return fields
+}
+
+// CheckCapabilities checks a payload against a platform's limits. Media sizes
+// are only checked for files listed in p.MediaSizes.
+func CheckCapabilities(caps Capabilities, p PostToSocialPayload) []ValidationIssue {
+	var issues []ValidationIssue
+	add := func(field, code, format string, args ...any) {
+		issues = append(issues, ValidationIssue{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if length := utf8.RuneCountInString(p.Content); caps.MaxTextLength > 0 && length > caps.MaxTextLength {
+		add("content", "text_too_long", "text is %d characters, the limit is %d", length, caps.MaxTextLength)
+	}
+	if caps.RequiresTitle && strings.TrimSpace(p.Title) == "" {
+		add("title", "title_required", "a title is required")
+	}
+	if length := utf8.RuneCountInString(p.Title); caps.MaxTitleLength > 0 && length > caps.MaxTitleLength {
+		add("title", "title_too_long", "title is %d characters, the limit is %d", length, caps.MaxTitleLength)
+	}
+	if strings.TrimSpace(p.Content) == "" && len(p.Images) == 0 {
+		add("content", "content_required", "the post has no text or media")
+	}
+
+	if caps.RequiresMedia && len(p.Images) == 0 {
+		add("images", "media_required", "at least one image or video is required")
+	}
+	if caps.MaxMedia > 0 && len(p.Images) > caps.MaxMedia {
+		add("images", "too_many_media", "%d attachments, the limit is %d", len(p.Images), caps.MaxMedia)
+	}
+
+	videos := 0
+	imageTypes := caps.ImageTypes
+	if len(imageTypes) == 0 {
+		imageTypes = defaultImageTypes
+	}
+	for _, name := range p.Images {
+		size := p.MediaSizes[name]
+		if isVideoFileName(name) {
+			videos++
+			if !caps.Video {
+				add("images", "video_not_supported", "video is not supported (%s)", name)
+			} else if caps.MaxVideoSize > 0 && size > caps.MaxVideoSize {
+				add("images", "media_too_large", "%s is %d MB, the video limit is %d MB", name, size>>20, caps.MaxVideoSize>>20)
+			}
+			continue
+		}
+
+		extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		switch {
+		case !caps.Images:
+			add("images", "images_not_supported", "images are not supported (%s)", name)
+		case !slices.Contains(imageTypes, extension):
+			add("images", "media_type_not_supported", "%s is not a supported image type (%s)", name, strings.Join(imageTypes, ", "))
+		case caps.MaxImageSize > 0 && size > caps.MaxImageSize:
+			add("images", "media_too_large", "%s is %d MB, the image limit is %d MB", name, size>>20, caps.MaxImageSize>>20)
+		}
+	}
+	if videos > 1 {
+		add("images", "too_many_videos", "only one video per post is supported")
+	} else if videos == 1 && len(p.Images) > 1 {
+		add("images", "mixed_media", "a video must be the only attachment")
+	}
+
+	return issues
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PostVariant overrides parts of a post for one platform. Empty text fields
+// keep the post's value. Images lists the files to attach on that platform
+// (from the post's images or variant_images); omitted means the post's
+// images and [] means none.
+type PostVariant struct {
+	Title        string   `json:"title,omitempty"`
+	Content      string   `json:"content,omitempty"`
+	Link         string   `json:"link,omitempty"`
+	Images       []string `json:"images"`
+	FirstComment string   `json:"first_comment,omitempty"`
+}
+
+// commentPoster comments on a post right after it was published.
+type commentPoster func(p PostToSocialPayload, publishedPostId string, message string) error
+
+// PostVariants maps a connection_name (facebook, twitter, instagram, ...) to
+// the overrides used when the post goes to that platform.
+type PostVariants map[string]PostVariant
+
+// ParseVariants decodes the variants field of a post. An empty field has no
+// variants.
+func ParseVariants(raw string) (PostVariants, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	var variants PostVariants
+	if err := json.Unmarshal([]byte(raw), &variants); err != nil {
+		return nil, fmt.Errorf("variants must be an object keyed by platform: %w", err)
+	}
+	return variants, nil
+}
+
+// Check reports variants for unknown platforms and images that are not
+// among the post's files.
+func (v PostVariants) Check(files []string) error {
+	platforms := make([]string, 0, len(v))
+	for platform := range v {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	for _, platform := range platforms {
+		if _, err := GetPublisher(platform); err != nil {
+			return fmt.Errorf("variants: unknown platform %q", platform)
+		}
+		for _, name := range v[platform].Images {
+			if !slices.Contains(files, name) {
+				return fmt.Errorf("variants: %s image %s is not attached to the post", platform, name)
+			}
+		}
+	}
+	return nil
+}
+
+// WithVariant returns the payload as it should be published on platform.
+func (p PostToSocialPayload) WithVariant(variants PostVariants, platform string) PostToSocialPayload {
+	variant, ok := variants[platform]
+	if !ok {
+		return p
+	}
+	if variant.Title != "" {
+		p.Title = variant.Title
+	}
+	if variant.Content != "" {
+		p.Content = variant.Content
+	}
+	if variant.Link != "" {
+		p.Link = variant.Link
+	}
+	if variant.Images != nil {
+		p.Images = slices.Clone(variant.Images)
+	}
+	p.FirstComment = variant.FirstComment
+	return p
+}
+
+// graphComment adds a comment to a published Graph API object (facebook
+// post, instagram media).
+func graphComment(baseURL string) commentPoster {
+	return func(p PostToSocialPayload, publishedPostId string, message string) error {
+		form := url.Values{"message": {message}, "access_token": {p.AccessToken}}
+		res, err := p.client().PostForm(fmt.Sprintf("%s/%s/comments", baseURL, publishedPostId), form)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return fmt.Errorf("comment request failed: %s", res.Status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+package tasks
+
+import (
+	"content-clock/helpers"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// publishVerifier reports whether a published object still exists on the platform.
+type publishVerifier func(connectionId string, accessToken string, publishedPostId string) (bool, error)
+
+// VerifyPublished asks the platform whether publishedPostId exists.
+func VerifyPublished(platform string, connectionId string, accessToken string, publishedPostId string) (bool, error) {
+	publisher, err := GetPublisher(platform)
+	if err != nil {
+		return false, err
+	}
+	return publisher.Verify(connectionId, accessToken, publishedPostId)
+}
+
+func objectExists(requestURL string, headers map[string]string) (bool, error) {
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return false, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := helpers.NewHTTPClient()
+	res, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return true, nil
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "does not exist"):
+		// the Graph APIs answer 400 rather than 404 for deleted objects
+		return false, nil
+	default:
+		return false, fmt.Errorf("verification request failed: %s: %s", res.Status, string(body))
+	}
+}
+
+// deleteObject sends a DELETE; an object that is already gone counts as deleted.
+func deleteObject(requestURL string, headers map[string]string) error {
+	req, err := http.NewRequest("DELETE", requestURL, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := helpers.NewHTTPClient()
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if (res.StatusCode >= 200 && res.StatusCode < 300) || res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return fmt.Errorf("delete request failed: %s: %s", res.Status, string(body))
+}
+
+// fetchRaw GETs a URL and returns the body as-is.
+func fetchRaw(requestURL string, headers map[string]string) (string, error) {
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := helpers.NewHTTPClient()
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"content-clock/helpers"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultPublishWorkers      = 10
+	defaultPlatformConcurrency = 2
+)
+
+// workerPool bounds how many publish jobs run at once, both in total and per
+// platform (connection_name), so one slow upload cannot stall other posts.
+type workerPool struct {
+	mu             sync.Mutex
+	maxTotal       int
+	platformLimits map[string]int
+	defaultLimit   int
+	activeTotal    int
+	active         map[string]int
+	inFlight       sync.Map // job id -> true while a worker of this process runs it
+
+	dispatching atomic.Bool
+	pending     atomic.Bool
+}
+
+var (
+	pool     *workerPool
+	poolOnce sync.Once
+)
+
+func publishPool() *workerPool {
+	poolOnce.Do(func() {
+		pool = &workerPool{
+			maxTotal:       helpers.GetEnvInt("PUBLISH_WORKERS", defaultPublishWorkers),
+			platformLimits: parsePlatformLimits(os.Getenv("PUBLISH_PLATFORM_CONCURRENCY")),
+			defaultLimit:   helpers.GetEnvInt("PUBLISH_PLATFORM_DEFAULT_CONCURRENCY", defaultPlatformConcurrency),
+			active:         map[string]int{},
+		}
+		if pool.maxTotal < 1 {
+			pool.maxTotal = 1
+		}
+		if pool.defaultLimit < 1 {
+			pool.defaultLimit = 1
+		}
+	})
+	return pool
+}
+
+// tryAcquire reserves a worker slot for the platform without blocking.
+func (w *workerPool) tryAcquire(platform string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.activeTotal >= w.maxTotal || w.active[platform] >= w.limitFor(platform) {
+		return false
+	}
+	w.activeTotal++
+	w.active[platform]++
+	return true
+}
+
+func (w *workerPool) release(platform string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.activeTotal--
+	w.active[platform]--
+	if w.active[platform] <= 0 {
+		delete(w.active, platform)
+	}
+}
+
+// isRunning reports whether this process is currently executing the job.
+func (w *workerPool) isRunning(jobId string) bool {
+	_, ok := w.inFlight.Load(jobId)
+	return ok
+}
+
+func (w *workerPool) limitFor(platform string) int {
+	if limit, ok := w.platformLimits[platform]; ok {
+		return limit
+	}
+	return w.defaultLimit
+}
+
+// parsePlatformLimits reads values like "linkedin=1,facebook=3".
+func parsePlatformLimits(raw string) map[string]int {
+	limits := map[string]int{}
+	for _, pair := range strings.Split(raw, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || limit < 1 {
+			continue
+		}
+		limits[strings.ToLower(strings.TrimSpace(name))] = limit
+	}
+	return limits
+}